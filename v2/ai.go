@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/xyproto/env/v2"
+)
+
+const (
+	defaultAIBaseURL           = "https://api.openai.com/v1"
+	defaultAIModel             = "gpt-4o-mini"
+	defaultAIContextTokens     = 16000
+	defaultAIMaxResponseTokens = 4000
+)
+
+// aiProvider is the AI backend that is used for generating and fixing code and text,
+// or nil if there is no API key and no other endpoint has been configured
+var aiProvider = NewAIProvider(openAIKeyHolder)
+
+var errNoAIBackend = errors.New("no AI backend is configured")
+
+// AIMessage is a message in a chat with an AI, where the role is "system", "user" or "assistant"
+type AIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// AIProvider is an AI backend that can generate text, given a chat
+type AIProvider interface {
+	// ContextTokens returns the maximum number of tokens for the prompt and the response together
+	ContextTokens() int
+	// Stream sends the messages, and calls newToken with the generated text as it arrives,
+	// until the response is complete or the context is canceled
+	Stream(ctx context.Context, messages []AIMessage, maxTokens int, temperature float32, newToken func(string)) error
+}
+
+// OpenAIProvider is an AIProvider that uses an OpenAI-compatible chat completions API,
+// like the one from OpenAI, or the ones from a local llama.cpp or Ollama server
+type OpenAIProvider struct {
+	BaseURL   string // for example "https://api.openai.com/v1" or "http://localhost:11434/v1"
+	Model     string
+	APIKey    string // can be empty for local servers
+	MaxTokens int    // the size of the context window of the model
+	Client    *http.Client
+}
+
+// NewAIProvider creates an AIProvider from the OPENAI_BASE_URL, OPENAI_MODEL and OPENAI_CONTEXT_TOKENS
+// environment variables and the given API key. Returns nil if there is no API key and the OpenAI API is used,
+// since a key is only optional when another endpoint is configured.
+func NewAIProvider(keyHolder *KeyHolder) AIProvider {
+	baseURL := strings.TrimSuffix(env.StrAlt("OPENAI_BASE_URL", "OPENAI_API_BASE", defaultAIBaseURL), "/")
+	var apiKey string
+	if keyHolder != nil {
+		apiKey = keyHolder.Key
+	}
+	if apiKey == "" && baseURL == defaultAIBaseURL {
+		return nil
+	}
+	return &OpenAIProvider{
+		BaseURL:   baseURL,
+		Model:     env.Str("OPENAI_MODEL", defaultAIModel),
+		APIKey:    apiKey,
+		MaxTokens: env.Int("OPENAI_CONTEXT_TOKENS", defaultAIContextTokens),
+		Client:    http.DefaultClient,
+	}
+}
+
+// ContextTokens returns the size of the context window
+func (p *OpenAIProvider) ContextTokens() int {
+	return p.MaxTokens
+}
+
+// openAIError is the error that is returned from the API, for instance if the API key is wrong
+type openAIError struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// openAIChunk is a part of a streamed response, or a complete response, if the server does not stream
+type openAIChunk struct {
+	Choices []struct {
+		Delta   AIMessage `json:"delta"`
+		Message AIMessage `json:"message"`
+	} `json:"choices"`
+}
+
+// Stream sends a request to the chat completions endpoint, and reads the server-sent events that are returned
+func (p *OpenAIProvider) Stream(ctx context.Context, messages []AIMessage, maxTokens int, temperature float32, newToken func(string)) error {
+	if maxTokens > defaultAIMaxResponseTokens {
+		maxTokens = defaultAIMaxResponseTokens
+	}
+	body, err := json.Marshal(map[string]any{
+		"model":       p.Model,
+		"messages":    messages,
+		"max_tokens":  maxTokens,
+		"temperature": temperature,
+		"stream":      true,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.BaseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		var apiError openAIError
+		if json.Unmarshal(data, &apiError) == nil && apiError.Error.Message != "" {
+			return errors.New(apiError.Error.Message)
+		}
+		return fmt.Errorf("%s from %s", resp.Status, p.BaseURL)
+	}
+
+	// Some servers ignore "stream" and return the complete response at once
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		var chunk openAIChunk
+		if err := json.NewDecoder(resp.Body).Decode(&chunk); err != nil {
+			return err
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Message.Content != "" {
+			newToken(chunk.Choices[0].Message.Content)
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var chunk openAIChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return err
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			newToken(chunk.Choices[0].Delta.Content)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xyproto/env/v2"
+)
+
+func TestOpenAIProviderStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": {"message": "Incorrect API key provided"}}`)
+			return
+		}
+		var request struct {
+			Model    string      `json:"model"`
+			Messages []AIMessage `json:"messages"`
+			Stream   bool        `json:"stream"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Model != "llama3" || !request.Stream || len(request.Messages) != 1 || request.Messages[0].Content != "Say hi" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"error": {"message": "unexpected request: %+v"}}`, request)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, token := range []string{"Hello", ",", " world"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", token)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	p := &OpenAIProvider{BaseURL: server.URL + "/v1", Model: "llama3", APIKey: "secret", MaxTokens: 100}
+	messages := []AIMessage{{Role: "user", Content: "Say hi"}}
+	var tokens []string
+	if err := p.Stream(context.Background(), messages, 10, 0, func(token string) {
+		tokens = append(tokens, token)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 3 || tokens[0]+tokens[1]+tokens[2] != "Hello, world" {
+		t.Fatalf("unexpected tokens: %q", tokens)
+	}
+
+	p.APIKey = "wrong"
+	if err := p.Stream(context.Background(), messages, 10, 0, func(string) {}); err == nil || err.Error() != "Incorrect API key provided" {
+		t.Fatalf("expected the error message from the API, got %v", err)
+	}
+}
+
+func TestNewAIProvider(t *testing.T) {
+	// The env package caches the environment, so reload it after it has been changed, and after the test
+	t.Cleanup(env.Load)
+	t.Setenv("OPENAI_BASE_URL", "")
+	t.Setenv("OPENAI_API_BASE", "")
+	env.Load()
+	if p := NewAIProvider(nil); p != nil {
+		t.Fatal("expected no provider without an API key")
+	}
+	if p, ok := NewAIProvider(NewKeyHolderWithKey("secret")).(*OpenAIProvider); !ok || p.BaseURL != defaultAIBaseURL || p.Model != defaultAIModel {
+		t.Fatalf("expected the default OpenAI provider, got %+v", p)
+	}
+
+	// A local server does not need an API key
+	t.Setenv("OPENAI_BASE_URL", "http://localhost:11434/v1/")
+	t.Setenv("OPENAI_MODEL", "codellama")
+	env.Load()
+	p, ok := NewAIProvider(nil).(*OpenAIProvider)
+	if !ok || p.BaseURL != "http://localhost:11434/v1" || p.Model != "codellama" || p.APIKey != "" {
+		t.Fatalf("expected a provider for the local server, got %+v", p)
+	}
+}
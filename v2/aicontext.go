@@ -0,0 +1,206 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/xyproto/mode"
+)
+
+var (
+	// a function definition or declaration at the start of a line in C or C++, like "static int add(int a, int b) {"
+	cFuncRegexp = regexp.MustCompile(`^[A-Za-z_][\w \t\*&:<>,~]*\(`)
+
+	// a constant at the top level of a Python file, like "MAX_SIZE = 10"
+	pythonConstRegexp = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*\s*(:[^=]*)?=`)
+
+	cDeclarationPrefixes      = []string{"#include", "#define", "typedef ", "struct ", "enum ", "union ", "class ", "namespace ", "template", "extern ", "using "}
+	cControlKeywords          = []string{"if", "for", "while", "switch", "return", "else", "do"}
+	goDeclarationPrefixes     = []string{"func ", "type ", "const ", "var ", "import "}
+	pythonDeclarationPrefixes = []string{"import ", "from ", "def ", "async def ", "class ", "@"}
+	rustDeclarationPrefixes   = []string{"use ", "fn ", "async fn ", "const fn ", "unsafe fn ", "struct ", "enum ", "trait ", "impl", "const ", "static ", "type ", "mod ", "macro_rules!"}
+)
+
+// signature returns the given line of code without the start of the function body, if any
+func signature(line string) string {
+	line = strings.TrimSpace(line)
+	if strings.HasSuffix(line, "{") && !strings.HasSuffix(line, "= {") {
+		line = strings.TrimSpace(strings.TrimSuffix(line, "{"))
+	}
+	return line
+}
+
+// declarations collects the lines that declare functions, types, constants and imports in the given
+// source code, for the current mode. Function bodies are left out. The lines of import, const, var and type
+// blocks in Go are kept, since they are declarations as well, and so are the lines of function signatures
+// that span several lines.
+func (e *Editor) declarations(lines []string) []string {
+	var (
+		collected   []string
+		inBlock     bool // in a Go block of imports, constants, variables or a type declaration
+		inSignature bool // in a Go function signature that spans several lines
+	)
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		switch e.mode {
+		case mode.Go:
+			if inBlock {
+				if !strings.HasPrefix(trimmed, "//") {
+					collected = append(collected, strings.TrimRight(line, " \t"))
+				}
+				if line == ")" || line == "}" {
+					inBlock = false
+				}
+				continue
+			}
+			if inSignature {
+				// The signature ends at the closing parenthesis of the parameters, or at the start of the body
+				if strings.HasPrefix(line, ")") || strings.HasSuffix(trimmed, "{") {
+					collected = append(collected, signature(line))
+					inSignature = false
+				} else if !strings.HasPrefix(trimmed, "//") {
+					collected = append(collected, strings.TrimRight(line, " \t"))
+				}
+				continue
+			}
+			if hasAnyPrefix(line, goDeclarationPrefixes) {
+				switch {
+				case strings.HasPrefix(line, "func ") && strings.HasSuffix(line, "("):
+					collected = append(collected, strings.TrimRight(line, " \t"))
+					inSignature = true
+				case strings.HasSuffix(line, "(") || (strings.HasPrefix(line, "type ") && strings.HasSuffix(line, "{")):
+					collected = append(collected, strings.TrimRight(line, " \t"))
+					inBlock = true
+				default:
+					collected = append(collected, signature(line))
+				}
+			}
+		case mode.C, mode.Cpp:
+			if line[0] == ' ' || line[0] == '\t' || isCComment(trimmed) {
+				continue
+			}
+			if hasAnyPrefix(line, cDeclarationPrefixes) {
+				collected = append(collected, signature(line))
+			} else if cFuncRegexp.MatchString(line) && !hasAnyPrefix(line, cControlKeywords) {
+				collected = append(collected, signature(line))
+			}
+		case mode.Python, mode.Mojo:
+			if strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") {
+				// Methods, but not the function bodies
+				if strings.HasPrefix(trimmed, "def ") || strings.HasPrefix(trimmed, "async def ") {
+					collected = append(collected, strings.TrimRight(line, " \t"))
+				}
+				continue
+			}
+			if hasAnyPrefix(line, pythonDeclarationPrefixes) || pythonConstRegexp.MatchString(line) {
+				collected = append(collected, strings.TrimRight(line, " \t"))
+			}
+		case mode.Rust:
+			declaration := strings.TrimPrefix(trimmed, "pub ")
+			if strings.HasPrefix(declaration, "pub(") {
+				if _, after, ok := strings.Cut(declaration, ") "); ok {
+					declaration = after
+				}
+			}
+			if hasAnyPrefix(declaration, rustDeclarationPrefixes) {
+				collected = append(collected, signature(line))
+			}
+		default:
+			if prefix := strings.TrimSpace(e.FuncPrefix()); prefix != "" && strings.HasPrefix(trimmed, prefix+" ") {
+				collected = append(collected, signature(line))
+			}
+		}
+	}
+	return collected
+}
+
+// isCComment checks if the given trimmed line is a comment in C or C++
+func isCComment(trimmed string) bool {
+	return strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "/*") || strings.HasPrefix(trimmed, "*")
+}
+
+// headerDeclarations returns the lines of the given C or C++ header file, without comments and blank lines,
+// since a header file consists of declarations, also within classes
+func headerDeclarations(lines []string) []string {
+	var collected []string
+	for _, line := range lines {
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !isCComment(trimmed) {
+			collected = append(collected, strings.TrimRight(line, " \t"))
+		}
+	}
+	return collected
+}
+
+// headerFilename returns the header file that belongs to the current C or C++ source file, if any
+func (e *Editor) headerFilename() string {
+	if e.mode != mode.C && e.mode != mode.Cpp {
+		return ""
+	}
+	if !hasS([]string{".cpp", ".cc", ".c", ".cxx", ".c++"}, filepath.Ext(e.filename)) {
+		return ""
+	}
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return ""
+	}
+	headerFilename, err := ExtFileSearch(absFilename, []string{".h", ".hpp", ".h++"}, fileSearchMaxTime)
+	if err != nil {
+		return ""
+	}
+	return headerFilename
+}
+
+// PromptContext collects the declarations in the current file and in the corresponding header file,
+// if there is one, so that generated code can call existing functions and use existing types and
+// constants. The declarations in the current file come first, and the result fits within maxTokens.
+func (e *Editor) PromptContext(maxTokens int) string {
+	type section struct {
+		filename string
+		lines    []string
+	}
+	lines := make([]string, e.Len())
+	for i := range lines {
+		lines[i] = e.Line(LineIndex(i))
+	}
+	sections := []section{{filepath.Base(e.filename), e.declarations(lines)}}
+	if headerFilename := e.headerFilename(); headerFilename != "" {
+		if data, err := os.ReadFile(headerFilename); err == nil {
+			headerLines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+			sections = append(sections, section{filepath.Base(headerFilename), headerDeclarations(headerLines)})
+		}
+	}
+	var (
+		sb     strings.Builder
+		tokens = countTokens("")
+	)
+	// tokensIn counts the tokens in s without the fixed offset, so that a running count can be kept
+	tokensIn := func(s string) int {
+		return countTokens(s) - countTokens("")
+	}
+	for _, s := range sections {
+		if len(s.lines) == 0 {
+			continue
+		}
+		title := "Declarations in " + s.filename + ":\n"
+		if tokens+tokensIn(title+s.lines[0]) > maxTokens {
+			break
+		}
+		sb.WriteString(title)
+		tokens += tokensIn(title)
+		for _, line := range s.lines {
+			lineTokens := tokensIn(line)
+			if tokens+lineTokens > maxTokens {
+				return strings.TrimSpace(sb.String())
+			}
+			sb.WriteString(line + "\n")
+			tokens += lineTokens
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimSpace(sb.String())
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+func TestDeclarations(t *testing.T) {
+	tests := []struct {
+		m        mode.Mode
+		source   string
+		expected []string
+	}{
+		{mode.Go, "package main\n\nimport (\n\t\"fmt\"\n)\n\nconst maxSize = 10\n\ntype Point struct {\n\tX, Y int\n}\n\n// add adds\nfunc add(a, b int) int {\n\treturn a + b\n}\n",
+			[]string{"import (", "\t\"fmt\"", ")", "const maxSize = 10", "type Point struct {", "\tX, Y int", "}", "func add(a, b int) int"}},
+		{mode.Go, "package main\n\nfunc connect(\n\taddress string,\n\ttimeout int,\n) (net.Conn, error) {\n\tif timeout < 0 {\n\t\treturn nil, errTimeout\n\t}\n\treturn net.Dial(\"tcp\", address)\n}\n\nvar (\n\terrTimeout = errors.New(\"timeout\")\n)\n",
+			[]string{"func connect(", "\taddress string,", "\ttimeout int,", ") (net.Conn, error)", "var (", "\terrTimeout = errors.New(\"timeout\")", ")"}},
+		{mode.C, "#include <stdio.h>\n\n/* adds two numbers */\nstatic int add(int a, int b) {\n    return a + b;\n}\n\nint main(void)\n{\n    printf(\"%d\", add(1, 2));\n}\n",
+			[]string{"#include <stdio.h>", "static int add(int a, int b)", "int main(void)"}},
+		{mode.Python, "import os\nMAX_SIZE = 10\n\nclass Point:\n    def __init__(self, x):\n        self.x = x\n\ndef main():\n    print(os.getcwd())\n",
+			[]string{"import os", "MAX_SIZE = 10", "class Point:", "    def __init__(self, x):", "def main():"}},
+		{mode.Rust, "use std::io;\n\npub(crate) struct Point {\n    x: i32,\n}\n\nimpl Point {\n    pub fn new(x: i32) -> Self {\n        Point { x }\n    }\n}\n",
+			[]string{"use std::io;", "pub(crate) struct Point", "impl Point", "pub fn new(x: i32) -> Self"}},
+	}
+	for _, test := range tests {
+		e := NewSimpleEditor(80)
+		e.mode = test.m
+		if got := e.declarations(strings.Split(test.source, "\n")); strings.Join(got, "\n") != strings.Join(test.expected, "\n") {
+			t.Errorf("unexpected declarations for %s:\n%s", test.m, strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestPromptContext(t *testing.T) {
+	dir := t.TempDir()
+	header := "#pragma once\n\n// A point\nstruct point {\n    int x;\n    int y;\n};\n\nint distance(struct point a, struct point b);\n"
+	if err := os.WriteFile(filepath.Join(dir, "point.h"), []byte(header), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewSimpleEditor(80)
+	e.mode = mode.C
+	e.filename = filepath.Join(dir, "point.c")
+	e.InsertStringAndMove(nil, "#include \"point.h\"\n\nint distance(struct point a, struct point b) {\n    return abs(a.x - b.x) + abs(a.y - b.y);\n}\n")
+
+	context := e.PromptContext(1000)
+	expected := "Declarations in point.c:\n#include \"point.h\"\nint distance(struct point a, struct point b)\n\n" +
+		"Declarations in point.h:\n#pragma once\nstruct point {\n    int x;\n    int y;\n};\nint distance(struct point a, struct point b);"
+	if context != expected {
+		t.Fatalf("unexpected prompt context:\n%s", context)
+	}
+
+	// With a smaller budget, the declarations from the header are cut short
+	budget := countTokens(expected) - 5
+	if context := e.PromptContext(budget); countTokens(context) > budget || !strings.HasPrefix(context, "Declarations in point.c:") || strings.HasSuffix(context, "b);") {
+		t.Fatalf("expected the declarations to fit within the budget, got:\n%s", context)
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xyproto/vt100"
+)
+
+var (
+	// breakpointsDir is where the breakpoints are stored, one file per project
+	breakpointsDir = filepath.Join(userCacheDir, "o", "breakpoints")
+
+	// breakpoints are the breakpoints in the current project, across all files, sorted by filename and line number
+	breakpoints    []Breakpoint
+	breakpointRoot string // the project root that the breakpoints belong to
+	breakpointsMut sync.RWMutex
+
+	errNoBreakpoints = errors.New("no breakpoints")
+)
+
+// Breakpoint is a line in a source file where the debugger should stop
+type Breakpoint struct {
+	Filename  string     `json:"filename"`            // absolute path
+	Line      LineNumber `json:"line"`                // the line number, starting at 1
+	Condition string     `json:"condition,omitempty"` // only stop if this expression is true
+	HitCount  int        `json:"hitCount,omitempty"`  // only stop when the line is reached for this many times, if > 1
+	Disabled  bool       `json:"disabled,omitempty"`  // keep the breakpoint, but don't stop at it
+}
+
+// String returns a description of the breakpoint, with the filename relative to the given directory
+func (bp Breakpoint) String(root string) string {
+	filename := bp.Filename
+	if rel, err := filepath.Rel(root, filename); err == nil {
+		filename = rel
+	}
+	s := fmt.Sprintf("%s:%d", filename, bp.Line)
+	if bp.Condition != "" {
+		s += " if " + bp.Condition
+	}
+	if bp.HitCount > 1 {
+		s += fmt.Sprintf(" (hit %d times)", bp.HitCount)
+	}
+	if bp.Disabled {
+		s += " [disabled]"
+	}
+	return s
+}
+
+// breakpointsFilename returns the filename for storing the breakpoints of the given project root
+func breakpointsFilename(root string) string {
+	hash := sha256.Sum256([]byte(root))
+	return filepath.Join(breakpointsDir, hex.EncodeToString(hash[:])+".json")
+}
+
+// LoadBreakpoints reads the breakpoints for the given project root from the cache directory
+func LoadBreakpoints(root string) ([]Breakpoint, error) {
+	data, err := os.ReadFile(breakpointsFilename(root))
+	if err != nil {
+		return nil, err
+	}
+	var bps []Breakpoint
+	if err := json.Unmarshal(data, &bps); err != nil {
+		return nil, err
+	}
+	return bps, nil
+}
+
+// SaveBreakpoints writes the breakpoints for the given project root to the cache directory
+func SaveBreakpoints(root string, bps []Breakpoint) error {
+	if noWriteToCache {
+		return nil
+	}
+	filename := breakpointsFilename(root)
+	if len(bps) == 0 {
+		// Nothing to save, remove any previously saved breakpoints
+		os.Remove(filename)
+		return nil
+	}
+	data, err := json.MarshalIndent(bps, "", "  ")
+	if err != nil {
+		return err
+	}
+	// First create the folder, if needed, in a best effort attempt
+	os.MkdirAll(breakpointsDir, os.ModePerm)
+	return os.WriteFile(filename, data, 0o600)
+}
+
+// LoadProjectBreakpoints makes the breakpoints of the project that the current file is in available,
+// by loading them from the cache directory, if they have not already been loaded
+func (e *Editor) LoadProjectBreakpoints() {
+	root := ProjectRoot(e.filename)
+	breakpointsMut.Lock()
+	defer breakpointsMut.Unlock()
+	if root == breakpointRoot {
+		return
+	}
+	breakpoints, _ = LoadBreakpoints(root)
+	breakpointRoot = root
+}
+
+// updateBreakpoints replaces the breakpoints, sorts them and saves them to the cache directory
+func updateBreakpoints(bps []Breakpoint) error {
+	sort.SliceStable(bps, func(i, j int) bool {
+		if bps[i].Filename != bps[j].Filename {
+			return bps[i].Filename < bps[j].Filename
+		}
+		return bps[i].Line < bps[j].Line
+	})
+	breakpointsMut.Lock()
+	breakpoints = bps
+	root := breakpointRoot
+	breakpointsMut.Unlock()
+	return SaveBreakpoints(root, bps)
+}
+
+// Breakpoints returns a copy of the breakpoints in the current project
+func Breakpoints() []Breakpoint {
+	breakpointsMut.RLock()
+	defer breakpointsMut.RUnlock()
+	return append([]Breakpoint{}, breakpoints...)
+}
+
+// EnabledBreakpoints returns the breakpoints that the debugger should stop at
+func EnabledBreakpoints() []Breakpoint {
+	var bps []Breakpoint
+	for _, bp := range Breakpoints() {
+		if !bp.Disabled {
+			bps = append(bps, bp)
+		}
+	}
+	return bps
+}
+
+// breakpointLines returns the breakpoints in the current file, by line index
+func (e *Editor) breakpointLines() map[LineIndex]Breakpoint {
+	breakpointsMut.RLock()
+	defer breakpointsMut.RUnlock()
+	if len(breakpoints) == 0 {
+		return nil
+	}
+	absFilename, err := filepath.Abs(e.filename)
+	if err != nil {
+		return nil
+	}
+	lines := make(map[LineIndex]Breakpoint)
+	for _, bp := range breakpoints {
+		if bp.Filename == absFilename {
+			lines[bp.Line.LineIndex()] = bp
+		}
+	}
+	return lines
+}
+
+// drawBreakpoint marks a line with a breakpoint in the rightmost column
+func (e *Editor) drawBreakpoint(c *vt100.Canvas, bp Breakpoint, y, w uint) {
+	if w < 2 {
+		return
+	}
+	marker := '●'
+	if bp.Disabled {
+		marker = '○'
+	}
+	c.WriteRuneBNoLock(w-1, y, e.DebugStoppedBackground, e.Background.Background(), marker)
+}
+
+// ToggleBreakpoint adds a breakpoint at the current line, or removes the breakpoint that is already there.
+// The debugger is updated if a debug session is active. Returns true if a breakpoint was added.
+func (e *Editor) ToggleBreakpoint() (bool, error) {
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return false, err
+	}
+	e.LoadProjectBreakpoints()
+	bp := Breakpoint{Filename: absFilename, Line: e.LineNumber()}
+	bps := Breakpoints()
+	for i, existing := range bps {
+		if existing.Filename == bp.Filename && existing.Line == bp.Line {
+			if err := updateBreakpoints(append(bps[:i], bps[i+1:]...)); err != nil {
+				return false, err
+			}
+			if e.debugger != nil && !existing.Disabled {
+				return false, e.debugger.ClearBreakpoint(existing)
+			}
+			return false, nil
+		}
+	}
+	if err := updateBreakpoints(append(bps, bp)); err != nil {
+		return true, err
+	}
+	return true, e.DebugActivateBreakpoint(bp)
+}
+
+// ChangeBreakpoint replaces the given breakpoint with a changed one, at the same location,
+// and passes the change on to the debugger, if a debug session is active
+func (e *Editor) ChangeBreakpoint(old, changed Breakpoint) error {
+	bps := Breakpoints()
+	for i, existing := range bps {
+		if existing.Filename == old.Filename && existing.Line == old.Line {
+			bps[i] = changed
+			break
+		}
+	}
+	if err := updateBreakpoints(bps); err != nil {
+		return err
+	}
+	if e.debugger == nil {
+		return nil
+	}
+	if changed.Disabled {
+		if old.Disabled {
+			return nil
+		}
+		return e.debugger.ClearBreakpoint(old)
+	}
+	return e.debugger.SetBreakpoint(changed)
+}
+
+// RemoveBreakpoint removes the given breakpoint, also from the debugger, if a debug session is active
+func (e *Editor) RemoveBreakpoint(bp Breakpoint) error {
+	bps := Breakpoints()
+	for i, existing := range bps {
+		if existing.Filename == bp.Filename && existing.Line == bp.Line {
+			bps = append(bps[:i], bps[i+1:]...)
+			break
+		}
+	}
+	if err := updateBreakpoints(bps); err != nil {
+		return err
+	}
+	if e.debugger != nil && !bp.Disabled {
+		return e.debugger.ClearBreakpoint(bp)
+	}
+	return nil
+}
+
+// GoToBreakpoint opens the file with the given breakpoint, if needed, and goes to the line
+func (e *Editor) GoToBreakpoint(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, bp Breakpoint) error {
+	return e.GoToProblem(c, tty, status, lk, Problem{Filename: bp.Filename, Line: bp.Line})
+}
+
+// breakpointsPage returns the menu choices for the breakpoints from the start index, and the index after the last
+// breakpoint that is included. If there are more than maxEntries breakpoints in total, the last choice goes to
+// the next page, or back to the first page.
+func breakpointsPage(bps []Breakpoint, root string, start, maxEntries int) ([]string, int) {
+	if len(bps) <= maxEntries {
+		start, maxEntries = 0, len(bps)
+	} else if maxEntries > 1 {
+		maxEntries-- // make room for the choice that changes the page
+	}
+	end := min(start+maxEntries, len(bps))
+	menuChoices := make([]string, 0, end-start+1)
+	for _, bp := range bps[start:end] {
+		menuChoices = append(menuChoices, bp.String(root))
+	}
+	switch {
+	case start == 0 && end == len(bps):
+	case end < len(bps):
+		menuChoices = append(menuChoices, fmt.Sprintf("More (%d)...", len(bps)-end))
+	default:
+		menuChoices = append(menuChoices, "Back to the first breakpoint")
+	}
+	return menuChoices, end
+}
+
+// BreakpointsMenu lists the breakpoints in the current project in a menu. The selected breakpoint
+// can then be jumped to, enabled or disabled, given a condition or hit count, or removed.
+func (e *Editor) BreakpointsMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper) error {
+	e.LoadProjectBreakpoints()
+	bps := Breakpoints()
+	if len(bps) == 0 {
+		return errNoBreakpoints
+	}
+
+	// Make room for the menu title and margins
+	maxEntries := 20
+	if c != nil && int(c.H())-6 > 3 {
+		maxEntries = int(c.H()) - 6
+	}
+
+	root := ProjectRoot(e.filename)
+	title := fmt.Sprintf("%d breakpoints", len(bps))
+	if len(bps) == 1 {
+		title = "1 breakpoint"
+	}
+	selected := -1
+	for start := 0; selected < 0; {
+		menuChoices, end := breakpointsPage(bps, root, start, maxEntries)
+		pageTitle := title
+		if start > 0 || end < len(bps) {
+			pageTitle = fmt.Sprintf("%s (%d to %d)", title, start+1, end)
+		}
+		choice := e.Menu(status, tty, pageTitle, menuChoices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, 0, false)
+		switch {
+		case choice < 0:
+			return nil
+		case start+choice < end:
+			selected = start + choice
+		case end < len(bps): // the next page
+			start = end
+		default: // back to the first page
+			start = 0
+		}
+	}
+	bp := bps[selected]
+
+	toggleText := "Disable"
+	if bp.Disabled {
+		toggleText = "Enable"
+	}
+	actionChoices := []string{"Go to the breakpoint", toggleText, "Set condition", "Set hit count", "Remove"}
+	action := e.Menu(status, tty, bp.String(root), actionChoices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, 0, false)
+
+	changed := bp
+	switch action {
+	case 0: // go to
+		return e.GoToBreakpoint(c, tty, status, lk, bp)
+	case 1: // enable or disable
+		changed.Disabled = !bp.Disabled
+	case 2: // condition
+		condition, ok := e.UserInput(c, tty, status, "Stop if (empty for always)", []string{}, false)
+		if !ok {
+			return nil
+		}
+		changed.Condition = strings.TrimSpace(condition)
+	case 3: // hit count
+		hitCountString, ok := e.UserInput(c, tty, status, "Stop when reached this many times", []string{}, false)
+		if !ok {
+			return nil
+		}
+		hitCount, err := strconv.Atoi(strings.TrimSpace(hitCountString))
+		if err != nil || hitCount < 0 {
+			return fmt.Errorf("not a valid hit count: %s", hitCountString)
+		}
+		changed.HitCount = hitCount
+	case 4: // remove
+		if err := e.RemoveBreakpoint(bp); err != nil {
+			return err
+		}
+		e.redraw = true
+		status.SetMessageAfterRedraw("Removed " + bp.String(root))
+		return nil
+	default:
+		return nil
+	}
+	if err := e.ChangeBreakpoint(bp, changed); err != nil {
+		return err
+	}
+	e.redraw = true
+	status.SetMessageAfterRedraw(changed.String(root))
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBreakpoints(t *testing.T) {
+	oldDir := breakpointsDir
+	breakpointsDir = t.TempDir()
+	defer func() {
+		breakpointsDir = oldDir
+		breakpoints = nil
+		breakpointRoot = ""
+	}()
+
+	root := t.TempDir()
+	filename := filepath.Join(root, "main.go")
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	e.InsertStringAndMove(nil, "package main\n\nfunc main() {\n\tx := 1\n\tprintln(x)\n}\n")
+	e.GoToLineNumber(4, nil, nil, false)
+
+	added, err := e.ToggleBreakpoint()
+	if err != nil || !added {
+		t.Fatalf("expected a breakpoint to be added, got %v", err)
+	}
+	e.GoToLineNumber(5, nil, nil, false)
+	if _, err := e.ToggleBreakpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if lines := e.breakpointLines(); len(lines) != 2 || lines[3].Line != 4 || lines[4].Line != 5 {
+		t.Fatalf("unexpected breakpoint lines: %v", lines)
+	}
+
+	// Change the first breakpoint, then load the breakpoints again, as if the editor had been restarted
+	bp := Breakpoints()[0]
+	changed := bp
+	changed.Condition, changed.HitCount, changed.Disabled = "x > 1", 3, true
+	if err := e.ChangeBreakpoint(bp, changed); err != nil {
+		t.Fatal(err)
+	}
+	breakpoints, breakpointRoot = nil, ""
+	e.LoadProjectBreakpoints()
+	bps := Breakpoints()
+	if len(bps) != 2 || bps[0] != changed {
+		t.Fatalf("expected the breakpoints to be loaded from the cache, got %+v", bps)
+	}
+	if s := bps[0].String(root); s != "main.go:4 if x > 1 (hit 3 times) [disabled]" {
+		t.Fatalf("unexpected description: %q", s)
+	}
+	if enabled := EnabledBreakpoints(); len(enabled) != 1 || enabled[0].Line != 5 {
+		t.Fatalf("expected only the breakpoint at line 5 to be enabled, got %+v", enabled)
+	}
+
+	// Toggling at the same line again removes the breakpoint
+	added, err = e.ToggleBreakpoint()
+	if err != nil || added {
+		t.Fatalf("expected the breakpoint to be removed, got %v", err)
+	}
+	if err := e.RemoveBreakpoint(changed); err != nil {
+		t.Fatal(err)
+	}
+	if bps, err := LoadBreakpoints(root); err == nil || len(bps) != 0 {
+		t.Fatalf("expected the saved breakpoints to be removed, got %+v", bps)
+	}
+}
+
+func TestBreakpointsPage(t *testing.T) {
+	var bps []Breakpoint
+	for line := LineNumber(1); line <= 7; line++ {
+		bps = append(bps, Breakpoint{Filename: "/project/main.go", Line: line})
+	}
+	if choices, end := breakpointsPage(bps, "/project", 0, 10); len(choices) != 7 || end != 7 {
+		t.Fatalf("expected all breakpoints on one page, got %v", choices)
+	}
+	choices, end := breakpointsPage(bps, "/project", 0, 4)
+	if len(choices) != 4 || end != 3 || choices[3] != "More (4)..." {
+		t.Fatalf("expected three breakpoints and a choice for the next page, got %v", choices)
+	}
+	choices, end = breakpointsPage(bps, "/project", 6, 4)
+	if len(choices) != 2 || end != 7 || choices[0] != "main.go:7" || choices[1] != "Back to the first breakpoint" {
+		t.Fatalf("expected the last breakpoint and a choice for the first page, got %v", choices)
+	}
+}
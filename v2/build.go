@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,8 +21,35 @@ var (
 	errNoSuitableBuildCommand = errors.New("no suitable build command")
 
 	pandocMutex sync.RWMutex
+
+	buildingMut sync.Mutex // guards e.building, which is also changed when a build or a test run in the background is done
 )
 
+// IsBuilding checks if a build or a test run is in progress
+func (e *Editor) IsBuilding() bool {
+	buildingMut.Lock()
+	defer buildingMut.Unlock()
+	return e.building
+}
+
+// setBuilding marks that a build or a test run is in progress, or done
+func (e *Editor) setBuilding(building bool) {
+	buildingMut.Lock()
+	e.building = building
+	buildingMut.Unlock()
+}
+
+// startBuilding marks that a build or a test run is in progress. Returns false if one already is.
+func (e *Editor) startBuilding() bool {
+	buildingMut.Lock()
+	defer buildingMut.Unlock()
+	if e.building {
+		return false
+	}
+	e.building = true
+	return true
+}
+
 // exeName tries to find a suitable name for the executable, given a source filename
 // For instance, "main" or the name of the directory holding the source filename.
 // If shouldExist is true, the function will try to select either "main" or the parent
@@ -98,6 +126,13 @@ func (e *Editor) GenerateBuildCommand(filename string) (*exec.Cmd, func() (bool,
 		return cmd, nothingIsFine, err
 	}
 
+	// A build command in the project configuration file takes precedence
+	if cfg, err := LoadProjectConfig(sourceFilename, e.mode); err != nil {
+		return cmd, nothingIsFine, err
+	} else if cfg != nil && cfg.Build != "" {
+		return cfg.Command(cfg.Build, sourceFilename), everythingIsFine, nil
+	}
+
 	// Set up a few basic variables about the given source file
 	var (
 		sourceDir      = filepath.Dir(sourceFilename)
@@ -194,6 +229,10 @@ func (e *Editor) GenerateBuildCommand(filename string) (*exec.Cmd, func() (bool,
 		}, nil
 	case mode.Go:
 		cmd := exec.Command("go", "build")
+		if e.debugMode {
+			// Disable optimizations and inlining, so that all the local variables can be inspected when debugging
+			cmd = exec.Command("go", "build", "-gcflags=all=-N -l")
+		}
 		if strings.HasSuffix(sourceFilename, "_test.go") {
 			// go test run a test that does not exist in order to build just the tests
 			// thanks @cespare at github
@@ -554,6 +593,24 @@ func (e *Editor) BuildOrExport(c *vt100.Canvas, tty *vt100.TTY, status *StatusBa
 	// Ignore the status code / error, only look at the output.
 	output, err := cmd.CombinedOutput()
 
+	// Collect all errors and warnings with a location, for the problems list.
+	// A regular expression for error lines in the project configuration file takes precedence.
+	if cfg, _ := LoadProjectConfig(sourceFilename, e.mode); cfg != nil && cfg.ErrorRegex != "" {
+		buildProblems := ParseProblemsWithRegexp(string(output), cmd.Dir, regexp.MustCompile(cfg.ErrorRegex))
+		SetProblems(buildProblems, err != nil)
+		if err != nil {
+			return "", e.moveToFirstProblem(c, tty, status, sourceFilename, buildProblems, string(output))
+		}
+	} else {
+		buildProblems := ParseProblems(string(output), cmd.Dir)
+		SetProblems(buildProblems, err != nil)
+		// cargo gives filenames relative to the directory of Cargo.toml, go test gives failures and panics without
+		// "error:" and so does erlc, so go directly to the first problem for these
+		if err != nil && len(buildProblems) > 0 && (e.mode == mode.Rust || e.mode == mode.Erlang || strings.HasSuffix(sourceFilename, "_test.go")) {
+			return "", e.moveToFirstProblem(c, tty, status, sourceFilename, buildProblems, string(output))
+		}
+	}
+
 	// Done building, clear the "Building" message
 	if status != nil {
 		status.ClearAll(c)
@@ -1086,7 +1143,7 @@ func (e *Editor) Build(c *vt100.Canvas, status *StatusBar, tty *vt100.TTY, andRu
 	}
 
 	// debug stepping
-	if e.debugMode && e.gdb != nil {
+	if e.debugMode && e.debugger != nil {
 		if !programRunning {
 			e.DebugEnd()
 			status.SetMessage("Program stopped")
@@ -1096,10 +1153,10 @@ func (e *Editor) Build(c *vt100.Canvas, status *StatusBar, tty *vt100.TTY, andRu
 			return
 		}
 		status.ClearAll(c)
-		// If we have a breakpoint, continue to it
-		if e.breakpoint != nil { // exists
+		// If we have breakpoints, continue to the next one
+		if len(EnabledBreakpoints()) > 0 {
 			// continue forward to the end or to the next breakpoint
-			if err := e.DebugContinue(); err != nil {
+			if err := e.debugger.Continue(); err != nil {
 				// logf("[continue] gdb output: %s\n", gdbOutput)
 				e.DebugEnd()
 				status.SetMessage("Done")
@@ -1108,7 +1165,7 @@ func (e *Editor) Build(c *vt100.Canvas, status *StatusBar, tty *vt100.TTY, andRu
 				status.SetMessage("Continue")
 			}
 		} else { // if not, make one step
-			err := e.DebugStep()
+			err := e.debugger.Step()
 			if err != nil {
 				if errorMessage := err.Error(); strings.Contains(errorMessage, "is not being run") {
 					e.DebugEnd()
@@ -1161,7 +1218,7 @@ func (e *Editor) Build(c *vt100.Canvas, status *StatusBar, tty *vt100.TTY, andRu
 	// to avoid the first accidental ctrl-space key press.
 
 	// Run after building, for some modes
-	if e.building && !e.runAfterBuild {
+	if e.IsBuilding() && !e.runAfterBuild {
 		if e.CanRun() {
 			status.ClearAll(c)
 			e.DrawOutput(c, 20, "", "Building and running...", e.DebugRegistersBackground, true)
@@ -1169,16 +1226,16 @@ func (e *Editor) Build(c *vt100.Canvas, status *StatusBar, tty *vt100.TTY, andRu
 		}
 		return
 	}
-	if e.building && e.runAfterBuild {
+	if e.IsBuilding() && e.runAfterBuild {
 		// do nothing when ctrl-space is pressed more than 2 times when building
 		return
 	}
 
 	// Not building anything right now
 	go func() {
-		e.building = true
+		e.setBuilding(true)
 		defer func() {
-			e.building = false
+			e.setBuilding(false)
 			if e.runAfterBuild {
 				e.runAfterBuild = false
 
@@ -1221,12 +1278,12 @@ func (e *Editor) Build(c *vt100.Canvas, status *StatusBar, tty *vt100.TTY, andRu
 			return // return from goroutine
 		}
 		// Not building any more
-		e.building = false
+		e.setBuilding(false)
 
 		// --- success ---
 
 		// ctrl-space was pressed while in debug mode, and without a debug session running
-		if e.debugMode && e.gdb == nil {
+		if e.debugMode && e.debugger == nil {
 			if err := e.DebugStartSession(c, tty, status, outputExecutable); err != nil {
 				status.ClearAll(c)
 				status.SetError(err)
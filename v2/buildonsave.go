@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/xyproto/files"
+	"github.com/xyproto/mode"
+)
+
+var (
+	// for canceling the background build that is currently running, if a new save happens before it is done
+	backgroundBuildCancel context.CancelFunc
+	backgroundBuildMut    sync.Mutex
+
+	// the result of the most recent background build, until the key loop shows it. Guarded by backgroundBuildMut.
+	backgroundBuildDone *BackgroundBuildResult
+
+	errNoCheckCommand = errors.New("no build command for this file")
+)
+
+// CheckCommand creates a command that checks the given source file for errors, without running anything.
+// Go files are checked with "go vet" and Rust files with "cargo check", if there is a Cargo.toml file.
+// A build command in the project configuration file takes precedence, and other files are built as usual.
+func (e *Editor) CheckCommand(sourceFilename string) (*exec.Cmd, error) {
+	cfg, err := LoadProjectConfig(sourceFilename, e.mode)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil || cfg.Build == "" {
+		sourceDir := filepath.Dir(sourceFilename)
+		switch e.mode {
+		case mode.Go:
+			cmd := exec.Command("go", "vet", ".")
+			cmd.Dir = sourceDir
+			return cmd, nil
+		case mode.Rust:
+			if dir := cargoDir(sourceDir); files.IsFile(filepath.Join(dir, "Cargo.toml")) {
+				cmd := exec.Command("cargo", "check")
+				cmd.Dir = dir
+				return cmd, nil
+			}
+		}
+	}
+	cmd, _, err := e.GenerateBuildCommand(sourceFilename)
+	if err != nil {
+		return nil, err
+	}
+	if cmd == nil {
+		return nil, errNoCheckCommand
+	}
+	return cmd, nil
+}
+
+// BackgroundBuildResult is the status message from a build in the background, for the file that was built
+type BackgroundBuildResult struct {
+	Filename string // the absolute filename
+	Message  string
+	Failed   bool
+}
+
+// TakeBackgroundBuildResult returns the result of the most recent background build, if it has not already been taken
+func TakeBackgroundBuildResult() *BackgroundBuildResult {
+	backgroundBuildMut.Lock()
+	defer backgroundBuildMut.Unlock()
+	result := backgroundBuildDone
+	backgroundBuildDone = nil
+	return result
+}
+
+// problemCountMessage returns a short summary of the given problems, like "2 errors and 1 warning"
+func problemCountMessage(ps []Problem) string {
+	errorCount, warningCount := 0, 0
+	for _, p := range ps {
+		if p.Warning {
+			warningCount++
+		} else {
+			errorCount++
+		}
+	}
+	plural := func(n int, word string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, word)
+		}
+		return fmt.Sprintf("%d %ss", n, word)
+	}
+	switch {
+	case errorCount > 0 && warningCount > 0:
+		return plural(errorCount, "error") + " and " + plural(warningCount, "warning")
+	case warningCount > 0:
+		return plural(warningCount, "warning")
+	}
+	return plural(errorCount, "error")
+}
+
+// UpdateProblems replaces the problems list and the markers, like SetProblems, but without letting ctrl-n
+// and ctrl-p step through the problems, since this happens in the background, after every save.
+func UpdateProblems(ps []Problem) {
+	problemsMut.Lock()
+	problems = ps
+	problemIndex = -1
+	problemsVersion++
+	problemsMut.Unlock()
+}
+
+// BuildInBackground checks the current file for errors in a goroutine, after it has been saved.
+// When done, the key loop highlights the problems and shows the number of problems in the status bar.
+// A background build that is still running is canceled first.
+func (e *Editor) BuildInBackground() {
+	sourceFilename, err := filepath.Abs(e.filename)
+	if err != nil {
+		return
+	}
+	buildCmd, err := e.CheckCommand(sourceFilename)
+	if err != nil {
+		return
+	}
+	var errorRegexp *regexp.Regexp
+	if cfg, _ := LoadProjectConfig(sourceFilename, e.mode); cfg != nil && cfg.ErrorRegex != "" {
+		errorRegexp = regexp.MustCompile(cfg.ErrorRegex)
+	}
+
+	// Cancel the stale build, if any
+	ctx, cancel := context.WithCancel(context.Background())
+	backgroundBuildMut.Lock()
+	if backgroundBuildCancel != nil {
+		backgroundBuildCancel()
+	}
+	backgroundBuildCancel = cancel
+	backgroundBuildMut.Unlock()
+
+	// Make the command cancelable, by creating it again with the context
+	cmd := exec.CommandContext(ctx, buildCmd.Path, buildCmd.Args[1:]...)
+	cmd.Dir = buildCmd.Dir
+	cmd.Env = buildCmd.Env
+	cmd.WaitDelay = time.Second // don't wait for child processes of a canceled "sh -c" to finish
+
+	go func() {
+		output, _ := cmd.CombinedOutput()
+		backgroundBuildMut.Lock()
+		defer backgroundBuildMut.Unlock()
+		if ctx.Err() != nil { // canceled by a newer save
+			return
+		}
+		backgroundBuildCancel = nil
+		cancel()
+
+		var buildProblems []Problem
+		if errorRegexp != nil {
+			buildProblems = ParseProblemsWithRegexp(string(output), cmd.Dir, errorRegexp)
+		} else {
+			buildProblems = ParseProblems(string(output), cmd.Dir)
+		}
+		UpdateProblems(buildProblems)
+
+		// The key loop redraws the highlighted lines and shows the result, if the same file is still being edited
+		backgroundBuildDone = &BackgroundBuildResult{Filename: sourceFilename, Message: "Build: OK"}
+		if len(buildProblems) > 0 {
+			backgroundBuildDone.Message, backgroundBuildDone.Failed = "Build: "+problemCountMessage(buildProblems), true
+		}
+	}()
+}
+
+// StopBackgroundBuild cancels the background build that is currently running, if any
+func StopBackgroundBuild() {
+	backgroundBuildMut.Lock()
+	defer backgroundBuildMut.Unlock()
+	if backgroundBuildCancel != nil {
+		backgroundBuildCancel()
+		backgroundBuildCancel = nil
+	}
+}
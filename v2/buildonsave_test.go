@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xyproto/mode"
+)
+
+func TestProblemCountMessage(t *testing.T) {
+	ps := []Problem{{Message: "a"}, {Message: "b"}, {Message: "c", Warning: true}}
+	if s := problemCountMessage(ps); s != "2 errors and 1 warning" {
+		t.Fatalf("unexpected message: %q", s)
+	}
+	if s := problemCountMessage(ps[2:]); s != "1 warning" {
+		t.Fatalf("unexpected message: %q", s)
+	}
+	if s := problemCountMessage(ps[:1]); s != "1 error" {
+		t.Fatalf("unexpected message: %q", s)
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Cargo.toml"), []byte("[package]\nname = \"hello\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewSimpleEditor(80)
+	e.mode = mode.Rust
+	cmd, err := e.CheckCommand(filepath.Join(dir, "src", "main.rs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(cmd.Args, " ") != "cargo check" || cmd.Dir != dir {
+		t.Fatalf("expected cargo check in the directory of Cargo.toml, got %q in %q", cmd.Args, cmd.Dir)
+	}
+
+	e.mode = mode.Go
+	cmd, err = e.CheckCommand(filepath.Join(dir, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(cmd.Args, " ") != "go vet ." || cmd.Dir != dir {
+		t.Fatalf("expected go vet in the source directory, got %q in %q", cmd.Args, cmd.Dir)
+	}
+}
+
+func TestUpdateProblems(t *testing.T) {
+	SetProblems(nil, false)
+	defer SetProblems(nil, false)
+	grepMatches = []GrepMatch{{}}
+	defer func() {
+		grepMatches = nil
+	}()
+	UpdateProblems([]Problem{{Message: "a"}})
+	if !HasProblems() || ProblemStepping() || len(grepMatches) == 0 {
+		t.Fatal("expected the problems to be updated, without taking over ctrl-n from the search results")
+	}
+
+	// A background build does not take over ctrl-n and ctrl-p, even if there are no search results
+	grepMatches = nil
+	UpdateProblems([]Problem{{Message: "b", Warning: true}})
+	if !HasProblems() || ProblemStepping() {
+		t.Fatal("expected the problems to be updated, without taking over ctrl-n and ctrl-p")
+	}
+}
+
+func TestBuildInBackground(t *testing.T) {
+	SetProblems(nil, false)
+	defer SetProblems(nil, false)
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sourceFilename := filepath.Join(root, "main.c")
+	if err := os.WriteFile(sourceFilename, []byte("int main() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := "build = 'echo main.c:1:5: error: oops; false'\n"
+	if err := os.WriteFile(filepath.Join(root, ".orbiton.toml"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewSimpleEditor(80)
+	e.mode = mode.C
+	e.filename = sourceFilename
+	version := ProblemsVersion()
+	e.BuildInBackground()
+
+	// The result is left for the key loop to show
+	var result *BackgroundBuildResult
+	for deadline := time.Now().Add(10 * time.Second); result == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		result = TakeBackgroundBuildResult()
+	}
+	if result == nil {
+		t.Fatal("expected the background build to finish")
+	}
+	if result.Filename != sourceFilename || !result.Failed || result.Message != "Build: 1 error" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if ProblemsVersion() == version || !HasProblems() {
+		t.Fatal("expected the problems to be updated")
+	}
+	if TakeBackgroundBuildResult() != nil {
+		t.Fatal("expected the result to only be taken once")
+	}
+}
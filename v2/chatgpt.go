@@ -7,7 +7,6 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/PullRequestInc/go-gpt3"
 	"github.com/xyproto/env/v2"
 	"github.com/xyproto/mode"
 	"github.com/xyproto/vt100"
@@ -42,29 +41,20 @@ func (e *Editor) AddSpaceAfterComments(generatedLine string) string {
 	return generatedLine
 }
 
-// GenerateTokens uses the ChatGTP API to generate text. n is the maximum number of tokens.
-// The global atomic Bool "ContinueGeneratingTokens" controls when the text generation should stop.
-func (e *Editor) GenerateTokens(keyHolder *KeyHolder, prompt string, n int, temperature float32, model string, newToken func(string)) error {
-	if keyHolder == nil {
+// GenerateTokens uses the given AI provider to generate text. n is the maximum number of tokens.
+// The e.generatingTokens flag controls when the text generation should stop.
+func (e *Editor) GenerateTokens(provider AIProvider, prompt string, n int, temperature float32, newToken func(string)) error {
+	if provider == nil {
 		return errors.New("no API key")
 	}
-	client := gpt3.NewClient(keyHolder.Key)
 	chatContext, cancelFunction := context.WithCancel(context.Background())
 	defer cancelFunction()
-	err := client.CompletionStreamWithEngine(
-		chatContext,
-		model,
-		gpt3.CompletionRequest{
-			Prompt:      []string{prompt},
-			MaxTokens:   gpt3.IntPtr(n),
-			Temperature: gpt3.Float32Ptr(temperature),
-		}, func(resp *gpt3.CompletionResponse) {
-			newToken(resp.Choices[0].Text)
-			if !e.generatingTokens {
-				cancelFunction()
-			}
-		})
-	return err
+	return provider.Stream(chatContext, []AIMessage{{Role: "user", Content: prompt}}, n, temperature, func(token string) {
+		newToken(token)
+		if !e.generatingTokens {
+			cancelFunction()
+		}
+	})
 }
 
 // TODO: Find an exact way to find the number of tokens in the prompt, from a ChatGPT point of view
@@ -84,22 +74,16 @@ func (e *Editor) FixLine(c *vt100.Canvas, status *StatusBar, lineIndex LineIndex
 
 	var temperature float32 // Low temperature for fixing grammar and issues
 
-	// Select a model
-	gptModel, gptModelTokens := gpt3.TextDavinci003Engine, 4000
-	// gptModel, gptModelTokens := "gpt-3.5-turbo", 4000 // only for chat
-	// gptModel, gptModelTokens := "text-curie-001", 2048 // simpler and faster
-	// gptModel, gptModelTokens := "text-ada-001", 2048 // even simpler and even faster
-
 	prompt := "Make as few changes as possible to this line in order to correct any typos or obvious grammatical errors, but only output EITHER the exact same line OR the corrected line! Here it is: " + line
 	if e.ProgrammingLanguage() { // fix a line of code or a line of text?
 		prompt = "Make as few changes as possible to this line of " + e.mode.String() + " code in order to correct any typos or obvious grammatical errors, but only output EITHER the exact same line OR the corrected line! Here it is: " + line
 	}
 
-	// Find the maxTokens value that will be sent to the OpenAI API
+	// Find the maxTokens value that will be sent to the AI API
 	amountOfPromptTokens := countTokens(prompt)
-	maxTokens := gptModelTokens - amountOfPromptTokens // The user can press Esc when there are enough tokens
+	maxTokens := aiProvider.ContextTokens() - amountOfPromptTokens // The user can press Esc when there are enough tokens
 	if maxTokens < 1 {
-		status.SetErrorMessage("ChatGPT API request is too long")
+		status.SetErrorMessage("AI API request is too long")
 		status.Show(c, e)
 		// Don't disable "fix as you type" if this happens
 		return
@@ -115,7 +99,7 @@ func (e *Editor) FixLine(c *vt100.Canvas, status *StatusBar, lineIndex LineIndex
 	)
 
 	fixLineMut.Lock()
-	if err := e.GenerateTokens(openAIKeyHolder, prompt, maxTokens, temperature, gptModel, func(word string) {
+	if err := e.GenerateTokens(aiProvider, prompt, maxTokens, temperature, func(word string) {
 		generatedLine = strings.TrimSpace(generatedLine) + word
 		newTrimmedContents = e.AddSpaceAfterComments(generatedLine)
 		newContents = currentLeadingWhitespace + newTrimmedContents
@@ -145,8 +129,8 @@ func (e *Editor) FixLine(c *vt100.Canvas, status *StatusBar, lineIndex LineIndex
 
 // FixCodeOrText tries to fix the current line
 func (e *Editor) FixCodeOrText(c *vt100.Canvas, status *StatusBar, disableFixAsYouTypeOnError bool) {
-	if openAIKeyHolder == nil {
-		status.SetErrorMessage("ChatGPT API key is empty")
+	if aiProvider == nil {
+		status.SetError(errNoAIBackend)
 		status.Show(c, e)
 		if disableFixAsYouTypeOnError {
 			e.fixAsYouType = false
@@ -158,8 +142,8 @@ func (e *Editor) FixCodeOrText(c *vt100.Canvas, status *StatusBar, disableFixAsY
 
 // GenerateCodeOrText will try to generate and insert text at the corrent position in the editor, given a ChatGPT prompt
 func (e *Editor) GenerateCodeOrText(c *vt100.Canvas, status *StatusBar, bookmark *Position) {
-	if openAIKeyHolder == nil {
-		status.SetErrorMessage("ChatGPT API key is empty")
+	if aiProvider == nil {
+		status.SetError(errNoAIBackend)
 		status.Show(c, e)
 		return
 	}
@@ -196,27 +180,28 @@ func (e *Editor) GenerateCodeOrText(c *vt100.Canvas, status *StatusBar, bookmark
 		}
 		temperature := env.Float32("CHATGPT_TEMPERATURE", defaultTemperature)
 
-		// Select a model
-		gptModel, gptModelTokens := gpt3.TextDavinci003Engine, 4000
-		// gptModel, gptModelTokens := "gpt-3.5-turbo", 4000 // only for chat
-		// gptModel, gptModelTokens := "text-curie-001", 2048 // simpler and faster
-		// gptModel, gptModelTokens := "text-ada-001", 2048 // even simpler and even faster
+		// The same model is used for text and code, with a context window of this size
+		gptModelTokens := aiProvider.ContextTokens()
 
-		switch generationType {
-		case continueCode:
-			gptModel, gptModelTokens = "code-davinci-002", 8000
-			// gptModel, gptModelTokens = "code-cushman-001", 2048 // slightly simpler and slightly faster
+		// Let the generated code use the existing functions, types and constants,
+		// by including the declarations in this file and in the header file, if any
+		var declarationContext string
+		if generationType != generateText {
+			if declarations := e.PromptContext(gptModelTokens / 4); declarations != "" {
+				declarationContext = "\n\nThese are the existing declarations, that can be used:\n" + declarations + "\n\n"
+			}
 		}
 
 		// Prefix the prompt
 		switch generationType {
 		case generateCode:
-			prompt += ". " + fmt.Sprintf(codePrompt, e.mode.String())
+			prompt += ". " + fmt.Sprintf(codePrompt, e.mode.String()) + declarationContext
 		case continueCode:
-			prompt += ". " + fmt.Sprintf(continuePrompt, e.mode.String()) + "\n"
-			// gather about 2000 tokens/fields from the current file and use that as the prompt
+			prompt += ". " + declarationContext + fmt.Sprintf(continuePrompt, e.mode.String()) + "\n"
+			// gather tokens/fields from the current file and use that as the prompt,
+			// but leave half of the context window for the response
 			startTokens := strings.Fields(e.String())
-			gatherNTokens := gptModelTokens - countTokens(prompt)
+			gatherNTokens := (gptModelTokens - countTokens(prompt)) / 2
 			if len(startTokens) > gatherNTokens {
 				startTokens = startTokens[len(startTokens)-gatherNTokens:]
 			}
@@ -237,11 +222,11 @@ func (e *Editor) GenerateCodeOrText(c *vt100.Canvas, status *StatusBar, bookmark
 		}
 		status.Show(c, e)
 
-		// Find the maxTokens value that will be sent to the OpenAI API
+		// Find the maxTokens value that will be sent to the AI API
 		amountOfPromptTokens := countTokens(prompt)
 		maxTokens := gptModelTokens - amountOfPromptTokens // The user can press Esc when there are enough tokens
 		if maxTokens < 1 {
-			status.SetErrorMessage("ChatGPT API request is too long")
+			status.SetErrorMessage("AI API request is too long")
 			status.Show(c, e)
 			return
 		}
@@ -251,7 +236,7 @@ func (e *Editor) GenerateCodeOrText(c *vt100.Canvas, status *StatusBar, bookmark
 		e.generatingTokens = true // global
 		first := true
 		var generatedLine string
-		if err := e.GenerateTokens(openAIKeyHolder, prompt, maxTokens, temperature, gptModel, func(word string) {
+		if err := e.GenerateTokens(aiProvider, prompt, maxTokens, temperature, func(word string) {
 			generatedLine += word
 			if strings.HasSuffix(generatedLine, "\n") {
 				newContents := currentLeadingWhitespace + e.AddSpaceAfterComments(generatedLine)
@@ -269,8 +254,6 @@ func (e *Editor) GenerateCodeOrText(c *vt100.Canvas, status *StatusBar, bookmark
 			} else {
 				e.SetCurrentLine(currentLeadingWhitespace + e.AddSpaceAfterComments(generatedLine))
 			}
-			// "refresh"
-			e.MakeConsistent()
 			e.DrawLines(c, true, false)
 			e.redrawCursor = true
 		}); err != nil {
@@ -66,6 +66,14 @@ func (e *Editor) UserSave(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) {
 		e.SaveLocation(absFilename, locationHistory)
 	}
 
+	// Let the language server know, so that the diagnostics are updated
+	e.LSPDidSave()
+
+	// Check the code for errors in the background, if enabled
+	if e.buildOnSave {
+		e.BuildInBackground()
+	}
+
 	// Status message
 	status.Clear(c)
 	status.SetMessage("Saved " + e.filename)
@@ -140,8 +148,88 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 	// TODO: Create a string->[]string map from title to command, then add them
 	// TODO: Add the 6 first arguments to a context struct instead
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Save and quit", "savequitclear")
+	if undo.CanRedo() {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Redo", "redo")
+	}
+	if undo.Len() > 0 || undo.CanRedo() {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Undo tree", "undotree")
+	}
+	if !e.readOnly {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Add a cursor on the line below", "addcursorbelow")
+		if e.searchTerm != "" || e.stickySearchTerm != "" {
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Add a cursor at every search match", "addcursors")
+		}
+		if e.HasRectangularSelection() {
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Type on every selected line", "cursorsincolumns")
+		}
+		if e.HasSelection() {
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Indent the selected lines", "indent")
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Dedent the selected lines", "dedent")
+			actions.Add("Toggle comments for the selected lines", func() {
+				undo.Snapshot(e)
+				e.ToggleCommentSelection()
+			})
+			actions.Add("Stop selecting", func() {
+				e.ClearSelection()
+				e.redraw = true
+			})
+		} else {
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Start selecting text", "select")
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Start selecting lines", "selectlines")
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Start selecting columns", "selectcolumns")
+		}
+	}
+	if !e.readOnly {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Search and replace, with confirmation", "replace")
+	}
+	if LSPAvailable(e.mode) {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Show information about the symbol under the cursor", "hover")
+	}
+	if HasProblems() {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "List the errors and warnings from the last build", "problems")
+	}
+	if e.CanExplainProblem() {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Explain the build error with AI", "explain")
+	}
+	if e.CanGenerateCommitMessage() {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Generate a commit message with AI", "commitmsg")
+	}
+	if e.CanRunTest() {
+		if testName := e.TestUnderCursor(); testName != "" {
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Run "+testName, "test")
+		}
+	}
+	actions.Add("Open file...", func() {
+		if err := e.OpenFileWithFinder(c, tty, status, lk); err != nil {
+			status.Clear(c)
+			status.SetError(err)
+			status.Show(c, e)
+		}
+	})
+	actions.Add("Find in all files...", func() {
+		prompt := "Find in all files"
+		if regexpSearch {
+			prompt = "Find a regular expression in all files"
+		}
+		searchFor, ok := e.UserInput(c, tty, status, prompt, []string{}, false)
+		if !ok {
+			return
+		}
+		if searchFor == "" {
+			searchFor = e.stickySearchTerm
+		}
+		if err := e.FindInFilesMenu(c, tty, status, lk, searchFor); err != nil {
+			status.Clear(c)
+			status.SetError(err)
+			status.Show(c, e)
+		}
+	})
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Sort strings on the current line", "sortwords")
-	actions.AddCommand(e, c, tty, status, bookmark, undo, "Sort the current block of lines", "sortblock")
+	if e.HasSelection() {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Sort the selected lines", "sortblock")
+	} else {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Sort the current block of lines", "sortblock")
+	}
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Insert \""+insertFilename+"\" at the current line", "insertfile", insertFilename)
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Insert the current date", "insertdate") // in the RFC 3339 format
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Insert the current time", "inserttime")
@@ -168,10 +256,11 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 	})
 
 	// Enter ChatGPT API key, if it's not already set
-	if openAIKeyHolder == nil {
+	if aiProvider == nil {
 		actions.Add("Enter ChatGPT API key...", func() {
 			if enteredAPIKey, ok := e.UserInput(c, tty, status, "API key from https://platform.openai.com/account/api-keys", []string{}, false); ok {
 				openAIKeyHolder = NewKeyHolderWithKey(enteredAPIKey)
+				aiProvider = NewAIProvider(openAIKeyHolder)
 				// env.Set("CHATGPT_API_KEY", enteredAPIKey)
 				status.SetMessageAfterRedraw("Using API key " + enteredAPIKey)
 				// Write the OpenAI API Key to a file in the cache directory as well, but ignore errors
@@ -194,6 +283,22 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 		}
 	}
 
+	// Build on save, on/off
+	if e.CanRun() && !e.readOnly {
+		if e.buildOnSave {
+			actions.Add("Build on save [turn off]", func() {
+				e.buildOnSave = false
+				StopBackgroundBuild()
+				status.SetMessageAfterRedraw("Build on save turned off")
+			})
+		} else {
+			actions.Add("Build on save", func() {
+				e.buildOnSave = true
+				status.SetMessageAfterRedraw("Build on save turned on")
+			})
+		}
+	}
+
 	// Disable or enable word wrap when typing
 	if e.wrapWhenTyping {
 		actions.Add("Disable word wrap when typing", func() {
@@ -283,18 +388,15 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 		}
 	}
 
-	// Find the path to either "rust-gdb" or "gdb", depending on the mode, then check if it's there
-	foundGDB := e.findGDB() != ""
-
-	// Debug mode on/off, if gdb is found and the mode is tested
-	if foundGDB && e.usingGDBMightWork() {
+	// Debug mode on/off, if dlv or gdb is found and the mode is tested
+	if e.DebuggerAvailable() {
 		if e.debugMode {
 			actions.Add("Exit debug mode", func() {
 				status.Clear(c)
 				status.SetMessage("Debug mode disabled")
 				status.Show(c, e)
 				e.debugMode = false
-				// Also end the gdb session if there is one in progress
+				// Also end the debug session if there is one in progress
 				e.DebugEnd()
 				status.SetMessageAfterRedraw("Normal mode")
 			})
@@ -305,12 +407,15 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 				e.UserSave(c, tty, status)
 				status.SetMessageAfterRedraw("Debug mode enabled")
 				e.debugMode = true
+				// Show the breakpoints that were saved for this project
+				e.LoadProjectBreakpoints()
+				e.redraw = true
 			})
 		}
 	}
 
 	// Fix as you type mode, on/off
-	if openAIKeyHolder != nil { // has AI
+	if aiProvider != nil { // has AI
 		if e.fixAsYouType {
 			actions.Add("Fix as you type [turn off]", func() {
 				e.fixAsYouType = false
@@ -324,7 +429,27 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 		}
 	}
 
+	// Ghost text completion, on/off
+	if e.ProgrammingLanguage() {
+		if e.ghostTextEnabled {
+			actions.Add("Ghost text completion [turn off]", func() {
+				e.ghostTextEnabled = false
+				DismissGhostText()
+				status.SetMessageAfterRedraw("Ghost text completion turned off")
+			})
+		} else {
+			actions.Add("Ghost text completion", func() {
+				e.ghostTextEnabled = true
+				status.SetMessageAfterRedraw("Ghost text completion turned on")
+			})
+		}
+	}
+
 	if e.debugMode {
+		e.LoadProjectBreakpoints()
+		if len(Breakpoints()) > 0 {
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "List breakpoints", "breakpoints")
+		}
 		hasOutputData := len(strings.TrimSpace(gdbOutput.String())) > 0
 		if hasOutputData {
 			if e.debugHideOutput {
@@ -353,31 +478,20 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 	// Delete the rest of the file
 	actions.Add("Delete the rest of the file", func() { // copy file to clipboard
 
-		prepareFunction := func() {
+		// Get the current index and remove the rest of the lines
+		currentLineIndex := int(e.DataY())
+
+		if e.lines.Has(currentLineIndex) {
 			// Prepare to delete all lines from this one and out
 			undo.Snapshot(e)
 			// Also close the portal, if any
 			e.ClosePortal()
 			// Mark the file as changed
 			e.changed = true
-		}
-
-		// Get the current index and remove the rest of the lines
-		currentLineIndex := int(e.DataY())
-
-		for y := range e.lines {
-			if y >= currentLineIndex {
-				// Run the prepareFunction, but only once, if there was changes to be made
-				if prepareFunction != nil {
-					prepareFunction()
-					prepareFunction = nil
-				}
-				delete(e.lines, y)
-			}
+			e.lines.Truncate(currentLineIndex)
 		}
 
 		if e.changed {
-			e.MakeConsistent()
 			e.redraw = true
 			e.redrawCursor = true
 		}
@@ -33,7 +33,11 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 				cmd.Args = args[1:]
 			}
 
-			// Now run the cmd with the current block of lines as input
+			// Now run the cmd with the selected text, or the current block of lines, as input
+			input := e.Block(e.LineIndex())
+			if e.HasSelection() {
+				input = e.SelectedText()
+			}
 			stdin, err := cmd.StdinPipe()
 			if err != nil {
 				status.Clear(c)
@@ -43,7 +47,7 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			}
 			go func() {
 				defer stdin.Close()
-				io.WriteString(stdin, e.Block(e.LineIndex()))
+				io.WriteString(stdin, input)
 			}()
 
 			// Gather the output in the same way as CombinedOutput and Run
@@ -94,6 +98,14 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			}
 
 			undo.Snapshot(e)
+			if e.HasSelection() {
+				if !strings.HasSuffix(input, "\n") {
+					outputString = strings.TrimSuffix(outputString, "\n")
+				}
+				e.ReplaceSelection(c, outputString)
+				e.redraw = true
+				return
+			}
 			e.ReplaceBlock(c, status, bookmark, outputString)
 		}, nil
 	}
@@ -112,23 +124,67 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 
 	const (
 		nothing = iota
+		addcursorbelow
+		addcursors
+		breakpoints
 		build
+		commitmessage
 		copyall
+		cursorsincolumns
+		dedent
+		explain
 		help
+		hover
+		indent
 		insertdate
 		insertfile
 		inserttime
+		problems
 		quit
+		redo
+		replace
 		save
 		savequit
 		savequitclear
+		selectcolumns
+		selectlines
+		selecttext
 		sortblock
 		sortstrings
+		test
+		undotree
 		version
 	)
 
 	// Define args and corresponding functions
 	commandLookup := map[int]func(){
+		addcursorbelow: func() { // add a cursor on the line below the lowest cursor
+			if err := e.AddCursorBelow(); err != nil {
+				status.Clear(c)
+				status.SetError(err)
+				status.Show(c, e)
+				return
+			}
+			e.redraw = true
+			status.SetMessageAfterRedraw(fmt.Sprintf("%d cursors", len(e.cursors)+1))
+		},
+		addcursors: func() { // add a cursor at every match of the search term
+			n, err := e.AddCursorsAtMatches(c)
+			if err != nil {
+				status.Clear(c)
+				status.SetError(err)
+				status.Show(c, e)
+				return
+			}
+			e.redraw = true
+			e.redrawCursor = true
+			status.SetMessageAfterRedraw(fmt.Sprintf("%d cursors", n))
+		},
+		breakpoints: func() { // list the breakpoints in the current project
+			if err := e.BreakpointsMenu(c, tty, status, fileLock); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
 		build: func() { // build
 			if e.Empty() {
 				// Empty file, nothing to build
@@ -160,6 +216,11 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			status.SetMessage("Success, built " + outputExecutable)
 			status.Show(c, e)
 		},
+		commitmessage: func() { // generate a commit message for the staged changes, with AI
+			if err := e.GenerateCommitMessage(c, status, undo); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
 		copyall: func() { // copy all contents to the clipboard
 			if err := clip.WriteAll(e.String(), e.primaryClipboard); err != nil {
 				status.Clear(c)
@@ -169,9 +230,45 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 				status.SetMessageAfterRedraw("Copied everything")
 			}
 		},
+		cursorsincolumns: func() { // place a cursor at the left edge of the rectangular selection, on every selected line
+			if !e.HasRectangularSelection() {
+				status.Clear(c)
+				status.SetError(errNoSelection)
+				status.Show(c, e)
+				return
+			}
+			undo.Snapshot(e)
+			e.RectangleToCursors(c, false)
+			status.SetMessageAfterRedraw(fmt.Sprintf("%d cursors", len(e.cursors)+1))
+		},
+		dedent: func() { // remove one level of indentation from the selected lines
+			if !e.HasSelection() {
+				status.Clear(c)
+				status.SetError(errNoSelection)
+				status.Show(c, e)
+				return
+			}
+			undo.Snapshot(e)
+			e.DedentSelection()
+		},
+		explain: func() { // explain the build error at the current line with AI, and suggest a fix
+			if err := e.ExplainProblem(c, tty, status, undo); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
 		help: func() { // display an informative status message
 			// TODO: Draw the same type of box that is used in debug mode, listing all possible commands
-			status.SetMessageAfterRedraw("sq, wq, savequit, s, save, q, quit, h, help, sort, v, version, date, insertfile [filename], build")
+			status.SetMessageAfterRedraw("sq, wq, savequit, s, save, q, quit, h, help, sort, v, version, date, insertfile [filename], build, redo, undotree, addcursorbelow, addcursors, select, selectlines, selectcolumns, indent, dedent, replace, hover, problems, test, breakpoints, commitmsg, explain")
+		},
+		indent: func() { // indent the selected lines
+			if !e.HasSelection() {
+				status.Clear(c)
+				status.SetError(errNoSelection)
+				status.Show(c, e)
+				return
+			}
+			undo.Snapshot(e)
+			e.IndentSelection()
 		},
 		insertdate: func() { // insert the current date
 			undo.Snapshot(e)
@@ -198,6 +295,47 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			e.InsertString(c, timeString)
 			e.addSpace = true
 		},
+		hover: func() { // show information about the symbol under the cursor, from the language server
+			text, err := e.LSPHover(c, status)
+			if err != nil {
+				status.ShowErrorAfterRedraw(err)
+				return
+			}
+			status.SetMessageAfterRedraw(text)
+		},
+		problems: func() { // list the errors and warnings from the last build
+			if err := e.ProblemsMenu(c, tty, status, fileLock); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
+		replace: func() { // search and replace, with a confirmation for every match
+			prompt := "Search for"
+			if regexpSearch {
+				prompt = "Search for a regular expression"
+			}
+			searchFor, ok := e.UserInput(c, tty, status, prompt, []string{}, false)
+			if !ok {
+				return
+			}
+			if searchFor == "" {
+				searchFor = e.stickySearchTerm
+			}
+			if searchFor == "" {
+				status.SetMessageAfterRedraw("Nothing to search for")
+				return
+			}
+			replaceWith, ok := e.UserInput(c, tty, status, "Replace with ($1 for the first group)", []string{}, false)
+			if !ok {
+				return
+			}
+			n := e.ReplaceWithConfirmation(c, tty, status, undo, searchFor, replaceWith)
+			e.stickySearchTerm = searchFor
+			if n == 1 {
+				status.SetMessageAfterRedraw("Replaced 1 match")
+			} else {
+				status.SetMessageAfterRedraw(fmt.Sprintf("Replaced %d matches", n))
+			}
+		},
 		save: func() { // save the current file
 			e.UserSave(c, tty, status)
 		},
@@ -210,8 +348,27 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			e.quit = true
 			e.clearOnQuit = true
 		},
-		sortblock: func() { // sort the current block of lines, until the next blank line or EOF
+		selectcolumns: func() { // start selecting a rectangle of columns, from the current position
+			e.StartRectangularSelection()
+			e.redraw = true
+			status.SetMessageAfterRedraw("Selecting columns")
+		},
+		selectlines: func() { // start selecting whole lines, from the current line
+			e.StartSelection(true)
+			e.redraw = true
+			status.SetMessageAfterRedraw("Selecting lines")
+		},
+		selecttext: func() { // start selecting text, from the current position
+			e.StartSelection(false)
+			e.redraw = true
+			status.SetMessageAfterRedraw("Selecting text")
+		},
+		sortblock: func() { // sort the selected lines, or the current block of lines, until the next blank line or EOF
 			undo.Snapshot(e)
+			if e.HasSelection() {
+				e.SortSelection()
+				return
+			}
 			e.SortBlock(c, status, bookmark)
 		},
 		sortstrings: func() { // sort the words on the current line
@@ -220,9 +377,25 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			e.redraw = true
 			e.redrawCursor = true
 		},
+		test: func() { // run the test function that the cursor is in
+			if err := e.RunTestUnderCursor(c, status); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
 		quit: func() { // quit
 			e.quit = true
 		},
+		redo: func() { // redo the edit operation that was most recently undone
+			if err := undo.Redo(e); err != nil {
+				status.SetMessageAfterRedraw("Nothing more to redo")
+				return
+			}
+			e.redraw = true
+			e.redrawCursor = true
+		},
+		undotree: func() { // select a branch and a state in the undo tree to jump to
+			e.UndoTreeMenu(c, tty, status, undo)
+		},
 		version: func() { // display the program name and version as a status message
 			status.SetMessageAfterRedraw(versionString)
 		},
@@ -236,12 +409,38 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 	switch trimmedCommand {
 	case "bye", "cu", "ee", "exit", "q", "qq", "qu", "qui", "quit":
 		functionID = quit
+	case "redo", "re", "red":
+		functionID = redo
+	case "problems", "problem", "prob", "errors", "quickfix", "qf", "copen":
+		functionID = problems
+	case "test", "te", "runtest", "testfunc":
+		functionID = test
+	case "hover", "ho", "info", "doc":
+		functionID = hover
+	case "replace", "rep", "substitute", "sub", "%s":
+		functionID = replace
+	case "addcursorbelow", "cursorbelow", "acb":
+		functionID = addcursorbelow
+	case "addcursors", "cursors", "multicursor", "mc":
+		functionID = addcursors
+	case "breakpoints", "breakpoint", "bp", "breaks":
+		functionID = breakpoints
 	case "build", "b", "bu", "bui":
 		functionID = build
+	case "commitmessage", "commitmsg", "commit", "cm", "aicommit":
+		functionID = commitmessage
 	case "copyall", "copya":
 		functionID = copyall
+	case "cursorsincolumns", "columncursors", "cic":
+		functionID = cursorsincolumns
+	case "dedent", "unindent", "outdent", "<":
+		functionID = dedent
+	case "explain", "explainerror", "ex", "aifix", "fixerror":
+		functionID = explain
 	case "h", "he", "hh", "hel", "help":
 		functionID = help
+	case "indent", "ind", ">":
+		functionID = indent
 	case "if", "i", "insertfile", "insert", "insertf":
 		functionID = insertfile
 	case "insertdate", "insertd", "id", "date", "d":
@@ -252,12 +451,20 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 		functionID = savequit
 	case "s", "sa", "sav", "save", "w", "ww", "↓":
 		functionID = save
+	case "select", "sel", "selecttext", "vs":
+		functionID = selecttext
+	case "selectcolumns", "selectrectangle", "rectangle", "rect", "sc", "vb":
+		functionID = selectcolumns
+	case "selectlines", "sl", "vl":
+		functionID = selectlines
 	case "sb", "so", "sor", "sort", "sortblock":
 		functionID = sortblock
 	case "sortstrings", "sortw", "sortwords", "sow", "ss", "sw", "sortfields", "sf":
 		functionID = sortstrings
 	case "sqc", "savequitclear":
 		functionID = savequitclear
+	case "undotree", "ut", "tree", "branches":
+		functionID = undotree
 	case "v", "ver", "vv", "version":
 		functionID = version
 	default:
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/xyproto/env/v2"
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+const (
+	commitSubjectWidth  = 50  // the maximum length of the subject line of a commit message
+	commitBodyWidth     = 72  // the body of a commit message is wrapped at this width
+	maxFileDiffLines    = 150 // the maximum number of lines to include from the diff of a single file
+	commitMessagePrompt = "Write a git commit message for the staged changes below. The first line is a subject line in the imperative mood, at most 50 characters long and without a trailing period. If the changes need more explanation, add a blank line and then a short body that explains what was changed and why. Only output the commit message, without any Markdown formatting.\n\n"
+)
+
+var errNothingStaged = errors.New("no staged changes, nothing to describe")
+
+// CanGenerateCommitMessage checks if a commit message is being edited and an AI backend is configured
+func (e *Editor) CanGenerateCommitMessage() bool {
+	return aiProvider != nil && e.mode == mode.Git && filepath.Base(e.filename) == "COMMIT_EDITMSG"
+}
+
+// gitStagedDiff returns the output of "git diff --cached" for the repository that the given COMMIT_EDITMSG file is in
+func gitStagedDiff(commitMessageFilename string) (string, error) {
+	cmd := exec.Command("git", "diff", "--cached", "--no-color", "--no-ext-diff")
+	// git runs the editor from the top level directory of the repository, but check for .git/COMMIT_EDITMSG as well
+	if absFilename, err := filepath.Abs(commitMessageFilename); err == nil && filepath.Base(filepath.Dir(absFilename)) == ".git" {
+		cmd.Dir = filepath.Dir(filepath.Dir(absFilename))
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git diff --cached: %w", err)
+	}
+	if strings.TrimSpace(string(output)) == "" {
+		return "", errNothingStaged
+	}
+	return string(output), nil
+}
+
+// trimDiff shortens the diff of each file to maxFileDiffLines lines, and leaves out the files
+// that do not fit within the given number of tokens, but lists their names at the end
+func trimDiff(diff string, maxTokens int) string {
+	var fileDiffs []string
+	for i, fileDiff := range strings.Split(diff, "\ndiff --git ") {
+		if i > 0 {
+			fileDiff = "diff --git " + fileDiff
+		}
+		lines := strings.Split(strings.TrimRight(fileDiff, "\n"), "\n")
+		if len(lines) > maxFileDiffLines {
+			lines = append(lines[:maxFileDiffLines], fmt.Sprintf("[%d more lines]", len(lines)-maxFileDiffLines))
+		}
+		fileDiffs = append(fileDiffs, strings.Join(lines, "\n"))
+	}
+	var (
+		sb      strings.Builder
+		skipped []string
+	)
+	for _, fileDiff := range fileDiffs {
+		if len(skipped) == 0 && countTokens(sb.String()+fileDiff) <= maxTokens {
+			sb.WriteString(fileDiff + "\n")
+			continue
+		}
+		// Only list the name of the file
+		firstLine, _, _ := strings.Cut(fileDiff, "\n")
+		if fields := strings.Fields(firstLine); len(fields) > 0 {
+			skipped = append(skipped, strings.TrimPrefix(fields[len(fields)-1], "b/"))
+		}
+	}
+	if len(skipped) > 0 {
+		sb.WriteString("[the diff is too long, these files were also changed: " + strings.Join(skipped, ", ") + "]\n")
+	}
+	return sb.String()
+}
+
+// wrapWords joins the given words into lines that are at most width runes long,
+// where all lines but the first are prefixed with the given indentation
+func wrapWords(words []string, width int, indentation string) []string {
+	var (
+		lines []string
+		line  string
+	)
+	for _, word := range words {
+		switch {
+		case line == "":
+			line = word
+		case len([]rune(line))+1+len([]rune(word)) <= width:
+			line += " " + word
+		default:
+			lines = append(lines, line)
+			line = indentation + word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// formatCommitMessage shortens the subject line of a generated commit message to
+// commitSubjectWidth characters, and wraps the body at commitBodyWidth characters.
+// List items in the body are wrapped separately, with a hanging indentation.
+func formatCommitMessage(message string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(message), "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "```") {
+			lines = append(lines, strings.TrimRight(line, " \t\r"))
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	// The subject line, without a trailing period
+	subject := strings.TrimSuffix(strings.Trim(strings.TrimSpace(lines[0]), "\"`"), ".")
+	if words := strings.Fields(subject); len([]rune(subject)) > commitSubjectWidth {
+		subject = wrapWords(words, commitSubjectWidth, "")[0]
+	}
+	formatted := []string{subject}
+
+	// The body, one paragraph or list item at a time
+	var (
+		paragraph []string
+		blankLine = true // there should be a blank line between the subject and the body
+	)
+	isListItem := func(line string) bool {
+		return strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* ")
+	}
+	flush := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		if blankLine {
+			formatted = append(formatted, "")
+			blankLine = false
+		}
+		indentation := ""
+		if isListItem(paragraph[0]) {
+			indentation = "  "
+		}
+		formatted = append(formatted, wrapWords(strings.Fields(strings.Join(paragraph, " ")), commitBodyWidth, indentation)...)
+		paragraph = nil
+	}
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+			blankLine = true
+		case isListItem(trimmed):
+			flush()
+			paragraph = []string{trimmed}
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+	return formatted
+}
+
+// commitMessageLineCount returns the number of lines above the first comment from git, which is the commit message
+func (e *Editor) commitMessageLineCount() int {
+	for i := 0; i < e.Len(); i++ {
+		if strings.HasPrefix(e.Line(LineIndex(i)), "#") {
+			return i
+		}
+	}
+	return e.Len()
+}
+
+// GenerateCommitMessage sends the staged changes to the AI backend, and streams the generated
+// commit message into the editor, above the comments from git. Esc stops the generation.
+func (e *Editor) GenerateCommitMessage(c *vt100.Canvas, status *StatusBar, undo *Undo) error {
+	if aiProvider == nil {
+		return errNoAIBackend
+	}
+	diff, err := gitStagedDiff(e.filename)
+	if err != nil {
+		return err
+	}
+	prompt := commitMessagePrompt + trimDiff(diff, aiProvider.ContextTokens()/2)
+	maxTokens := aiProvider.ContextTokens() - countTokens(prompt)
+	if maxTokens < 1 {
+		return errors.New("AI API request is too long")
+	}
+
+	undo.Snapshot(e)
+	status.ClearAll(c)
+	status.SetMessage("Generating a commit message...")
+	status.Show(c, e)
+
+	temperature := env.Float32("CHATGPT_TEMPERATURE", 0)
+	e.generatingTokens = true // global
+	go func() {
+		var generated string
+		err := e.GenerateTokens(aiProvider, prompt, maxTokens, temperature, func(word string) {
+			generated += word
+			// Replace the commit message with the generated one, followed by a blank line
+			formatted := formatCommitMessage(generated)
+			newLines := make([][]rune, 0, len(formatted)+1)
+			for _, line := range formatted {
+				newLines = append(newLines, []rune(line))
+			}
+			newLines = append(newLines, []rune{})
+			e.lines.Splice(0, e.commitMessageLineCount(), newLines)
+			e.changed = true
+			e.GoToTop(nil, nil)
+			e.DrawLines(c, true, false)
+			e.redrawCursor = true
+		})
+		stopped := !e.generatingTokens
+		e.generatingTokens = false
+		switch {
+		case err != nil && !strings.Contains(err.Error(), "context"):
+			status.SetErrorMessage(err.Error())
+		case stopped:
+			status.SetMessageAfterRedraw("Stopped")
+		case strings.TrimSpace(generated) == "":
+			status.SetMessageAfterRedraw("Nothing was generated")
+		default:
+			status.SetMessageAfterRedraw("Done, press ctrl-z to undo")
+		}
+		e.redraw = true
+		e.RedrawAtEndOfKeyLoop(c, status)
+	}()
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatCommitMessage(t *testing.T) {
+	generated := "```\nAdd a menu for listing the breakpoints in the current project, with more words.\n" +
+		"Breakpoints can now be set in several files. They are saved per project in the cache directory, so that they are kept between sessions.\n\n" +
+		"- Add conditions and hit counts to the breakpoints, for gdb, Delve and the debug adapters\n" +
+		"- Mark breakpoints in the rightmost column\n```\n"
+	lines := formatCommitMessage(generated)
+	if len([]rune(lines[0])) > commitSubjectWidth || lines[0] != "Add a menu for listing the breakpoints in the" {
+		t.Fatalf("unexpected subject line: %q", lines[0])
+	}
+	if lines[1] != "" {
+		t.Fatalf("expected a blank line after the subject, got %q", lines[1])
+	}
+	for _, line := range lines {
+		if len([]rune(line)) > commitBodyWidth {
+			t.Fatalf("line is longer than %d characters: %q", commitBodyWidth, line)
+		}
+		if strings.HasPrefix(line, "```") {
+			t.Fatalf("expected the Markdown code fences to be removed: %q", lines)
+		}
+	}
+	joined := strings.Join(lines, "\n")
+	if !strings.Contains(joined, "\n\n- Add conditions and hit counts to the breakpoints, for gdb, Delve and\n  the debug adapters\n- Mark breakpoints") {
+		t.Fatalf("expected the list items to be wrapped with a hanging indentation, got:\n%s", joined)
+	}
+
+	// While streaming, only the subject line may have arrived so far
+	if lines := formatCommitMessage("Fix the build."); len(lines) != 1 || lines[0] != "Fix the build" {
+		t.Fatalf("unexpected commit message: %q", lines)
+	}
+}
+
+func TestTrimDiff(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n")
+	for i := 0; i < 300; i++ {
+		sb.WriteString("+x := 1\n")
+	}
+	sb.WriteString("diff --git a/b.go b/b.go\n--- a/b.go\n+++ b/b.go\n")
+	for i := 0; i < 100; i++ {
+		sb.WriteString("+some more words on this line\n")
+	}
+	trimmed := trimDiff(sb.String(), 600)
+	if strings.Count(trimmed, "+x := 1") != maxFileDiffLines-3 || !strings.Contains(trimmed, "[153 more lines]") {
+		t.Fatalf("expected the diff of a.go to be shortened, got:\n%s", trimmed)
+	}
+	if strings.Contains(trimmed, "+some more words") || !strings.HasSuffix(trimmed, "these files were also changed: b.go]\n") {
+		t.Fatalf("expected b.go to only be listed, got:\n%s", trimmed)
+	}
+}
+
+func TestCommitMessageLineCount(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.InsertStringAndMove(nil, "Fix the parser\n\n# Please enter the commit message\n# On branch main\n")
+	if n := e.commitMessageLineCount(); n != 2 {
+		t.Fatalf("expected 2 lines above the comments, got %d", n)
+	}
+	// Lines that are added while the message is generated are counted too
+	e.lines.Splice(0, 0, [][]rune{[]rune("Typed by the user")})
+	if n := e.commitMessageLineCount(); n != 3 {
+		t.Fatalf("expected 3 lines above the comments, got %d", n)
+	}
+}
@@ -0,0 +1,688 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xyproto/files"
+	"github.com/xyproto/mode"
+)
+
+const (
+	dapRequestTimeout = 10 * time.Second
+	dapStopTimeout    = 2 * time.Second // how long to wait for the program to stop after stepping or continuing
+)
+
+var (
+	errDAPStopped = errors.New("the debug adapter has stopped")
+	errDAPTimeout = errors.New("timeout while waiting for the debug adapter")
+
+	// cache of which debug adapters have been found, since checking for debugpy means running Python
+	dapAvailable    = make(map[string]bool)
+	dapAvailableMut sync.Mutex
+)
+
+// DAPAdapter is a debug adapter that is started as a process, and that speaks the Debug Adapter Protocol over stdin and stdout
+type DAPAdapter struct {
+	Command      []string // the command that starts the debug adapter
+	AdapterID    string   // the ID of the adapter, as given in the initialize request
+	LaunchSource bool     // launch the source file instead of an executable, like for Python
+	StopAtMain   bool     // stop at the start of the main function, instead of stopping at the entry point
+}
+
+// dapAdapters are the debug adapters for the modes that can be debugged with a DAP client
+var dapAdapters = map[mode.Mode]DAPAdapter{
+	mode.C:      {Command: []string{"lldb-dap"}, AdapterID: "lldb-dap", StopAtMain: true},
+	mode.Cpp:    {Command: []string{"lldb-dap"}, AdapterID: "lldb-dap", StopAtMain: true},
+	mode.Python: {Command: []string{"python3", "-m", "debugpy.adapter"}, AdapterID: "debugpy", LaunchSource: true},
+	mode.Rust:   {Command: []string{"lldb-dap"}, AdapterID: "lldb-dap", StopAtMain: true},
+}
+
+// Available checks if the debug adapter is installed
+func (adapter DAPAdapter) Available() bool {
+	key := strings.Join(adapter.Command, " ")
+	dapAvailableMut.Lock()
+	defer dapAvailableMut.Unlock()
+	if available, ok := dapAvailable[key]; ok {
+		return available
+	}
+	available := files.Which(adapter.Command[0]) != ""
+	if available && len(adapter.Command) > 2 && adapter.Command[1] == "-m" {
+		// Check that the Python module can be imported
+		available = exec.Command(adapter.Command[0], "-c", "import "+strings.Split(adapter.Command[2], ".")[0]).Run() == nil
+	}
+	dapAvailable[key] = available
+	return available
+}
+
+// dapMessage is a request, response or event in the Debug Adapter Protocol
+type dapMessage struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command,omitempty"`
+	Event      string          `json:"event,omitempty"`
+	RequestSeq int             `json:"request_seq,omitempty"`
+	Success    bool            `json:"success,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+}
+
+// DAPStackFrame is a function call in the call stack
+type DAPStackFrame struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Line   int    `json:"line"`
+	Source *struct {
+		Name string `json:"name"`
+		Path string `json:"path"`
+	} `json:"source,omitempty"`
+}
+
+// DAPClient is a client for a debug adapter
+type DAPClient struct {
+	stdin       io.WriteCloser
+	writeMut    sync.Mutex
+	mut         sync.Mutex
+	pending     map[int]chan dapMessage
+	seq         int
+	stopped     bool
+	events      chan dapMessage // stopped, exited and terminated events
+	initialized chan struct{}
+	output      func(string)
+}
+
+// NewDAPClient creates a client that sends requests to w and reads responses and events from r.
+// Output from the program that is being debugged is passed to the given output function.
+func NewDAPClient(r io.Reader, w io.WriteCloser, output func(string)) *DAPClient {
+	client := &DAPClient{
+		stdin:       w,
+		pending:     make(map[int]chan dapMessage),
+		seq:         1,
+		events:      make(chan dapMessage, 16),
+		initialized: make(chan struct{}),
+		output:      output,
+	}
+	go client.readLoop(bufio.NewReader(r))
+	return client
+}
+
+// write sends one message to the debug adapter
+func (client *DAPClient) write(msg map[string]any) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	client.writeMut.Lock()
+	defer client.writeMut.Unlock()
+	return writeContentLengthMessage(client.stdin, data)
+}
+
+// readLoop handles the messages from the debug adapter, until it stops
+func (client *DAPClient) readLoop(r *bufio.Reader) {
+	initialized := false
+	for {
+		data, err := readContentLengthMessage(r)
+		if err != nil {
+			break
+		}
+		var msg dapMessage
+		if json.Unmarshal(data, &msg) != nil {
+			continue
+		}
+		switch msg.Type {
+		case "response":
+			client.mut.Lock()
+			ch, ok := client.pending[msg.RequestSeq]
+			delete(client.pending, msg.RequestSeq)
+			client.mut.Unlock()
+			if ok {
+				ch <- msg
+			}
+		case "request": // a reverse request, like runInTerminal, which is not supported
+			client.write(map[string]any{"seq": 0, "type": "response", "request_seq": msg.Seq, "command": msg.Command, "success": false})
+		case "event":
+			switch msg.Event {
+			case "initialized":
+				if !initialized {
+					initialized = true
+					close(client.initialized)
+				}
+			case "output":
+				var body struct {
+					Category string `json:"category"`
+					Output   string `json:"output"`
+				}
+				if json.Unmarshal(msg.Body, &body) == nil && body.Category != "telemetry" && client.output != nil {
+					client.output(body.Output)
+				}
+			case "stopped", "exited", "terminated":
+				select {
+				case client.events <- msg:
+				default: // drop the event if nobody is waiting for events
+				}
+			}
+		}
+	}
+	// The debug adapter has stopped, let all waiting requests know
+	client.mut.Lock()
+	client.stopped = true
+	for seq, ch := range client.pending {
+		close(ch)
+		delete(client.pending, seq)
+	}
+	client.mut.Unlock()
+	close(client.events)
+}
+
+// send sends a request, and returns a channel for the response
+func (client *DAPClient) send(command string, arguments any) (chan dapMessage, error) {
+	client.mut.Lock()
+	if client.stopped {
+		client.mut.Unlock()
+		return nil, errDAPStopped
+	}
+	seq := client.seq
+	client.seq++
+	ch := make(chan dapMessage, 1)
+	client.pending[seq] = ch
+	client.mut.Unlock()
+	if err := client.write(map[string]any{"seq": seq, "type": "request", "command": command, "arguments": arguments}); err != nil {
+		client.mut.Lock()
+		delete(client.pending, seq)
+		client.mut.Unlock()
+		return nil, err
+	}
+	return ch, nil
+}
+
+// wait waits for the response on the given channel
+func (client *DAPClient) wait(ch chan dapMessage, timeout time.Duration) (json.RawMessage, error) {
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return nil, errDAPStopped
+		}
+		if !msg.Success {
+			if msg.Message == "" {
+				return nil, fmt.Errorf("%s failed", msg.Command)
+			}
+			return nil, errors.New(msg.Message)
+		}
+		return msg.Body, nil
+	case <-time.After(timeout):
+		return nil, errDAPTimeout
+	}
+}
+
+// Request sends a request to the debug adapter and waits for the response body
+func (client *DAPClient) Request(command string, arguments any) (json.RawMessage, error) {
+	ch, err := client.send(command, arguments)
+	if err != nil {
+		return nil, err
+	}
+	return client.wait(ch, dapRequestTimeout)
+}
+
+// Close closes the connection to the debug adapter
+func (client *DAPClient) Close() error {
+	return client.stdin.Close()
+}
+
+// DAPBackend is a DebugBackend that uses a debug adapter, like debugpy for Python or lldb-dap for C, C++ and Rust
+type DAPBackend struct {
+	e           *Editor
+	adapter     DAPAdapter
+	cmd         *exec.Cmd
+	client      *DAPClient
+	threadID    int
+	frames      []DAPStackFrame
+	breakpoints map[string][]Breakpoint
+	doneFunc    func()
+	running     bool              // still running after the last wait for the program to stop timed out
+	locals      map[string]string // the local variables, from when the program last stopped
+}
+
+// NewDAPBackend creates a new DebugBackend that uses the given debug adapter
+func NewDAPBackend(e *Editor, adapter DAPAdapter) *DAPBackend {
+	return &DAPBackend{e: e, adapter: adapter, breakpoints: make(map[string][]Breakpoint)}
+}
+
+// Start starts the debug adapter, launches the program and waits until it stops at the start
+func (d *DAPBackend) Start(sourceDir, sourceBaseFilename, executableBaseFilename string, doneFunc func()) (string, error) {
+	if !noWriteToCache {
+		flogf(gdbLogFile, "[dap] %s: dir %s, src %s, exe %s\n", d.adapter.AdapterID, sourceDir, sourceBaseFilename, executableBaseFilename)
+	}
+	d.End()
+	cmd := exec.Command(d.adapter.Command[0], d.adapter.Command[1:]...)
+	cmd.Dir = sourceDir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return "", err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	d.cmd = cmd
+	d.client = NewDAPClient(stdout, stdin, func(s string) {
+		gdbOutput.WriteString(s)
+	})
+	program := filepath.Join(sourceDir, executableBaseFilename)
+	if d.adapter.LaunchSource {
+		program = filepath.Join(sourceDir, sourceBaseFilename)
+	}
+	if err := d.launch(program, sourceDir, doneFunc); err != nil {
+		d.End()
+		return strings.TrimSpace(gdbOutput.String()), err
+	}
+	return "started " + d.adapter.AdapterID, nil
+}
+
+// newDAPBackendWithClient creates a DAPBackend that uses an already connected client
+func newDAPBackendWithClient(e *Editor, adapter DAPAdapter, client *DAPClient) *DAPBackend {
+	d := NewDAPBackend(e, adapter)
+	d.client = client
+	return d
+}
+
+// launch initializes the debug adapter, launches the program, passes on the breakpoints and
+// waits until the program stops at the entry point or at the start of main
+func (d *DAPBackend) launch(program, dir string, doneFunc func()) error {
+	d.doneFunc = doneFunc
+	if _, err := d.client.Request("initialize", map[string]any{
+		"clientID":        "orbiton",
+		"adapterID":       d.adapter.AdapterID,
+		"linesStartAt1":   true,
+		"columnsStartAt1": true,
+		"pathFormat":      "path",
+	}); err != nil {
+		return err
+	}
+	// Some adapters, like debugpy, only respond to launch after the configuration is done
+	launchResponse, err := d.client.send("launch", map[string]any{
+		"program":     program,
+		"cwd":         dir,
+		"stopOnEntry": !d.adapter.StopAtMain,
+		"console":     "internalConsole",
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case <-d.client.initialized:
+	case <-time.After(dapRequestTimeout):
+		return errDAPTimeout
+	}
+	programRunning = true
+	for _, bp := range EnabledBreakpoints() {
+		if err := d.SetBreakpoint(bp); err != nil {
+			return err
+		}
+	}
+	if d.adapter.StopAtMain {
+		if _, err := d.client.Request("setFunctionBreakpoints", map[string]any{"breakpoints": []map[string]string{{"name": "main"}}}); err != nil {
+			return err
+		}
+	}
+	if _, err := d.client.Request("configurationDone", map[string]any{}); err != nil {
+		return err
+	}
+	if _, err := d.client.wait(launchResponse, dapRequestTimeout); err != nil {
+		return err
+	}
+	if err := d.waitForStop(dapRequestTimeout); err != nil {
+		return err
+	}
+	if d.adapter.StopAtMain {
+		// The breakpoint at main is only for starting, like "exec-run --start" for gdb
+		d.client.Request("setFunctionBreakpoints", map[string]any{"breakpoints": []any{}})
+	}
+	return nil
+}
+
+// handleEvent handles a stopped, exited or terminated event.
+// Returns errProgramStopped if the program is done.
+func (d *DAPBackend) handleEvent(msg dapMessage) error {
+	d.running = false
+	if msg.Event != "stopped" {
+		if programRunning {
+			programRunning = false
+			if d.doneFunc != nil {
+				d.doneFunc()
+			}
+		}
+		return errProgramStopped
+	}
+	var body struct {
+		ThreadID int `json:"threadId"`
+	}
+	json.Unmarshal(msg.Body, &body)
+	if body.ThreadID != 0 {
+		d.threadID = body.ThreadID
+	}
+	d.updateLocation()
+	d.updateWatches()
+	d.locals, _ = d.fetchLocals()
+	return nil
+}
+
+// waitForStop waits for the program to stop, and then moves the cursor to where it stopped.
+// If the program is still running after the timeout, it continues running in the background.
+func (d *DAPBackend) waitForStop(timeout time.Duration) error {
+	select {
+	case msg, ok := <-d.client.events:
+		if !ok {
+			programRunning = false
+			return errProgramStopped
+		}
+		return d.handleEvent(msg)
+	case <-time.After(timeout):
+		d.running = true
+		return nil
+	}
+}
+
+// handlePendingEvents handles the events that arrived after the last wait had timed out
+func (d *DAPBackend) handlePendingEvents() error {
+	for {
+		select {
+		case msg, ok := <-d.client.events:
+			if !ok {
+				programRunning = false
+				return errProgramStopped
+			}
+			if err := d.handleEvent(msg); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// Running checks if the program is still running after the last command
+func (d *DAPBackend) Running() bool {
+	if d.client == nil || !programRunning || !d.running {
+		return false
+	}
+	d.handlePendingEvents()
+	return programRunning && d.running
+}
+
+// Halt pauses the program, if it is still running after the last command
+func (d *DAPBackend) Halt() error {
+	if !d.Running() {
+		return nil
+	}
+	if _, err := d.client.Request("pause", map[string]any{"threadId": d.threadID}); err != nil {
+		return err
+	}
+	if err := d.waitForStop(dapRequestTimeout); err != nil {
+		return err
+	}
+	if d.running {
+		return errors.New("the program could not be paused")
+	}
+	return nil
+}
+
+// command sends a request for stepping or continuing, and waits for the program to stop
+func (d *DAPBackend) command(command string, arguments map[string]any) error {
+	if !programRunning {
+		return errProgramStopped
+	}
+	if err := d.handlePendingEvents(); err != nil {
+		return err
+	}
+	arguments["threadId"] = d.threadID
+	if _, err := d.client.Request(command, arguments); err != nil {
+		return err
+	}
+	return d.waitForStop(dapStopTimeout)
+}
+
+// updateLocation fetches the call stack, and moves the cursor to the current line, if it is in the current file
+func (d *DAPBackend) updateLocation() {
+	if d.threadID == 0 {
+		if body, err := d.client.Request("threads", map[string]any{}); err == nil {
+			var threads struct {
+				Threads []struct {
+					ID int `json:"id"`
+				} `json:"threads"`
+			}
+			if json.Unmarshal(body, &threads) == nil && len(threads.Threads) > 0 {
+				d.threadID = threads.Threads[0].ID
+			}
+		}
+	}
+	body, err := d.client.Request("stackTrace", map[string]any{"threadId": d.threadID, "startFrame": 0, "levels": 20})
+	if err != nil {
+		return
+	}
+	var stackTrace struct {
+		StackFrames []DAPStackFrame `json:"stackFrames"`
+	}
+	if json.Unmarshal(body, &stackTrace) != nil {
+		return
+	}
+	d.frames = stackTrace.StackFrames
+	if len(d.frames) == 0 || d.frames[0].Source == nil || d.frames[0].Line < 1 {
+		return
+	}
+	if absFilename, err := d.e.AbsFilename(); err == nil && absFilename == d.frames[0].Source.Path {
+		d.e.GoToLineNumber(LineNumber(d.frames[0].Line), nil, nil, true)
+	}
+}
+
+// frameID returns the ID of the current stack frame
+func (d *DAPBackend) frameID() int {
+	if len(d.frames) == 0 {
+		return 0
+	}
+	return d.frames[0].ID
+}
+
+// evaluate evaluates the given expression in the current stack frame
+func (d *DAPBackend) evaluate(expression string) (string, error) {
+	body, err := d.client.Request("evaluate", map[string]any{"expression": expression, "frameId": d.frameID(), "context": "watch"})
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Result string `json:"result"`
+	}
+	err = json.Unmarshal(body, &result)
+	return result.Result, err
+}
+
+// updateWatches evaluates all watch expressions, and moves the one that changed to the top of the list
+func (d *DAPBackend) updateWatches() {
+	for expression, oldValue := range watchMap {
+		if newValue, err := d.evaluate(expression); err == nil && newValue != oldValue {
+			watchMap[expression] = newValue
+			lastSeenWatchVariable = expression
+		}
+	}
+}
+
+// SetBreakpoint adds or updates a breakpoint. All the breakpoints for a file are sent together.
+func (d *DAPBackend) SetBreakpoint(bp Breakpoint) error {
+	var bps []Breakpoint
+	for _, existing := range d.breakpoints[bp.Filename] {
+		if existing.Line != bp.Line {
+			bps = append(bps, existing)
+		}
+	}
+	return d.sendBreakpoints(bp.Filename, append(bps, bp))
+}
+
+// ClearBreakpoint removes the breakpoint at the given line
+func (d *DAPBackend) ClearBreakpoint(bp Breakpoint) error {
+	var bps []Breakpoint
+	for _, existing := range d.breakpoints[bp.Filename] {
+		if existing.Line != bp.Line {
+			bps = append(bps, existing)
+		}
+	}
+	return d.sendBreakpoints(bp.Filename, bps)
+}
+
+// sendBreakpoints replaces all breakpoints in the given source file
+func (d *DAPBackend) sendBreakpoints(sourceFilename string, bps []Breakpoint) error {
+	if d.client == nil {
+		return errDAPStopped
+	}
+	breakpoints := make([]map[string]any, len(bps))
+	for i, bp := range bps {
+		breakpoints[i] = map[string]any{"line": int(bp.Line)}
+		if bp.Condition != "" {
+			breakpoints[i]["condition"] = bp.Condition
+		}
+		if bp.HitCount > 1 {
+			breakpoints[i]["hitCondition"] = strconv.Itoa(bp.HitCount)
+		}
+	}
+	if _, err := d.client.Request("setBreakpoints", map[string]any{"source": map[string]string{"path": sourceFilename}, "breakpoints": breakpoints}); err != nil {
+		return err
+	}
+	d.breakpoints[sourceFilename] = bps
+	return nil
+}
+
+// Continue continues to the next breakpoint, or to the end of the program
+func (d *DAPBackend) Continue() error {
+	return d.command("continue", map[string]any{})
+}
+
+// Next steps over the next line
+func (d *DAPBackend) Next() error {
+	return d.command("next", map[string]any{})
+}
+
+// Step steps into the next line
+func (d *DAPBackend) Step() error {
+	return d.command("stepIn", map[string]any{})
+}
+
+// NextInstruction steps one instruction
+func (d *DAPBackend) NextInstruction() error {
+	return d.command("next", map[string]any{"granularity": "instruction"})
+}
+
+// Finish steps out of the current function
+func (d *DAPBackend) Finish() error {
+	return d.command("stepOut", map[string]any{})
+}
+
+// AddWatch evaluates the given expression now, and then every time the program stops
+func (d *DAPBackend) AddWatch(expression string) (string, error) {
+	if d.client == nil {
+		return "", errDAPStopped
+	}
+	value, err := d.evaluate(expression)
+	if err != nil {
+		return "", err
+	}
+	watchMap[expression] = value
+	return "", nil
+}
+
+// Locals returns the local variables from when the program last stopped
+func (d *DAPBackend) Locals() (map[string]string, error) {
+	if d.client == nil {
+		return nil, errDAPStopped
+	}
+	return d.locals, nil
+}
+
+// fetchLocals requests the variables in the first scope of the current stack frame, which is usually the local variables
+func (d *DAPBackend) fetchLocals() (map[string]string, error) {
+	body, err := d.client.Request("scopes", map[string]any{"frameId": d.frameID()})
+	if err != nil {
+		return nil, err
+	}
+	var scopes struct {
+		Scopes []struct {
+			Name               string `json:"name"`
+			VariablesReference int    `json:"variablesReference"`
+			Expensive          bool   `json:"expensive"`
+		} `json:"scopes"`
+	}
+	if err := json.Unmarshal(body, &scopes); err != nil {
+		return nil, err
+	}
+	for _, scope := range scopes.Scopes {
+		if scope.Expensive || scope.VariablesReference == 0 {
+			continue
+		}
+		body, err := d.client.Request("variables", map[string]any{"variablesReference": scope.VariablesReference})
+		if err != nil {
+			return nil, err
+		}
+		var variables struct {
+			Variables []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			} `json:"variables"`
+		}
+		if err := json.Unmarshal(body, &variables); err != nil {
+			return nil, err
+		}
+		m := make(map[string]string, len(variables.Variables))
+		for _, v := range variables.Variables {
+			// Skip special variables, like the ones debugpy groups under "special variables"
+			if v.Name != "" && !strings.HasPrefix(v.Name, "special ") && !strings.HasPrefix(v.Name, "function ") {
+				m[v.Name] = v.Value
+			}
+		}
+		return m, nil
+	}
+	return nil, nil
+}
+
+// CallStack returns the function calls in the call stack, with the current function first
+func (d *DAPBackend) CallStack() []string {
+	calls := make([]string, 0, len(d.frames))
+	for _, frame := range d.frames {
+		call := frame.Name
+		if frame.Source != nil && frame.Source.Path != "" {
+			call += fmt.Sprintf(" (%s:%d)", filepath.Base(frame.Source.Path), frame.Line)
+		}
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+// End disconnects from the debug adapter, which also stops the program
+func (d *DAPBackend) End() {
+	if d.client != nil {
+		if ch, err := d.client.send("disconnect", map[string]any{"terminateDebuggee": true}); err == nil {
+			d.client.wait(ch, time.Second)
+		}
+		d.client.Close()
+		d.client = nil
+	}
+	if d.cmd != nil {
+		if d.cmd.Process != nil {
+			d.cmd.Process.Kill()
+		}
+		d.cmd.Wait()
+		d.cmd = nil
+	}
+	d.frames = nil
+	d.threadID = 0
+	d.running = false
+	d.locals = nil
+}
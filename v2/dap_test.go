@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+// fakeDebugAdapter is a scripted debug adapter, that steps one line at a time and exits when continuing.
+// Like debugpy, it only responds to the launch request after the configuration is done.
+// If loop is true, the program keeps running after continuing, until it is paused.
+func fakeDebugAdapter(r io.Reader, w io.Writer, filename string, loop bool, requests chan<- string) {
+	var (
+		reader    = bufio.NewReader(r)
+		seq       = 1000
+		line      = 1
+		launchSeq int
+	)
+	send := func(msg map[string]any) {
+		seq++
+		msg["seq"] = seq
+		data, _ := json.Marshal(msg)
+		writeContentLengthMessage(w, data)
+	}
+	respond := func(requestSeq int, command string, body any) {
+		send(map[string]any{"type": "response", "request_seq": requestSeq, "command": command, "success": true, "body": body})
+	}
+	event := func(name string, body any) {
+		send(map[string]any{"type": "event", "event": name, "body": body})
+	}
+	for {
+		data, err := readContentLengthMessage(reader)
+		if err != nil {
+			close(requests)
+			return
+		}
+		var request struct {
+			Seq       int                    `json:"seq"`
+			Command   string                 `json:"command"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		json.Unmarshal(data, &request)
+		requests <- request.Command + " " + string(mustMarshal(request.Arguments))
+		switch request.Command {
+		case "initialize":
+			respond(request.Seq, request.Command, map[string]any{})
+			event("initialized", nil)
+		case "launch":
+			launchSeq = request.Seq
+		case "configurationDone":
+			respond(request.Seq, request.Command, nil)
+			respond(launchSeq, "launch", nil)
+			event("output", map[string]any{"category": "stdout", "output": "hello\n"})
+			event("stopped", map[string]any{"reason": "entry", "threadId": 1})
+		case "stackTrace":
+			respond(request.Seq, request.Command, map[string]any{"stackFrames": []map[string]any{
+				{"id": 100 + line, "name": "main", "line": line, "source": map[string]string{"path": filename}},
+				{"id": 1, "name": "<module>", "line": 1, "source": map[string]string{"path": filename}},
+			}})
+		case "scopes":
+			respond(request.Seq, request.Command, map[string]any{"scopes": []map[string]any{{"name": "Locals", "variablesReference": 7}}})
+		case "variables":
+			respond(request.Seq, request.Command, map[string]any{"variables": []map[string]any{
+				{"name": "x", "value": strconv.Itoa(line)},
+				{"name": "special variables", "value": ""},
+			}})
+		case "evaluate":
+			respond(request.Seq, request.Command, map[string]any{"result": strconv.Itoa(line * 10)})
+		case "next":
+			respond(request.Seq, request.Command, nil)
+			line++
+			event("stopped", map[string]any{"reason": "step", "threadId": 1})
+		case "continue":
+			respond(request.Seq, request.Command, nil)
+			if loop {
+				break
+			}
+			event("exited", map[string]any{"exitCode": 0})
+			event("terminated", nil)
+		case "pause":
+			respond(request.Seq, request.Command, nil)
+			line = 3
+			event("stopped", map[string]any{"reason": "pause", "threadId": 1})
+		default:
+			respond(request.Seq, request.Command, nil)
+		}
+	}
+}
+
+func mustMarshal(v any) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+func TestDAPBackend(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "main.py")
+	clientReader, adapterWriter := io.Pipe()
+	adapterReader, clientWriter := io.Pipe()
+	requests := make(chan string, 100)
+	go fakeDebugAdapter(adapterReader, adapterWriter, filename, false, requests)
+
+	var output strings.Builder
+	client := NewDAPClient(clientReader, clientWriter, func(s string) {
+		output.WriteString(s)
+	})
+
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	e.InsertStringAndMove(nil, "x = 1\nx = 2\nx = 3\nprint(x)\n")
+	breakpoints = []Breakpoint{{Filename: filename, Line: 3, Condition: "x > 1", HitCount: 2}}
+
+	done := false
+	d := newDAPBackendWithClient(e, dapAdapters[mode.Python], client)
+	defer func() {
+		programRunning = false
+		breakpoints = nil
+		watchMap = make(map[string]string)
+		lastSeenWatchVariable = ""
+	}()
+	if err := d.launch(filename, filepath.Dir(filename), func() {
+		done = true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !programRunning || e.LineNumber() != 1 {
+		t.Fatalf("expected the program to stop at line 1, got %d", e.LineNumber())
+	}
+	if output.String() != "hello\n" {
+		t.Fatalf("expected the output from the program, got %q", output.String())
+	}
+
+	if _, err := d.AddWatch("x*10"); err != nil || watchMap["x*10"] != "10" {
+		t.Fatalf("expected the watch to be evaluated, got %q (%v)", watchMap["x*10"], err)
+	}
+	if err := d.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if e.LineNumber() != 2 || watchMap["x*10"] != "20" || lastSeenWatchVariable != "x*10" {
+		t.Fatalf("expected to be at line 2 with an updated watch, got line %d and %q", e.LineNumber(), watchMap["x*10"])
+	}
+	for i := 0; i < 2; i++ {
+		if locals, err := d.Locals(); err != nil || len(locals) != 1 || locals["x"] != "2" {
+			t.Fatalf("unexpected local variables: %v (%v)", locals, err)
+		}
+	}
+	if calls := d.CallStack(); len(calls) != 2 || calls[0] != "main (main.py:2)" {
+		t.Fatalf("unexpected call stack: %q", calls)
+	}
+
+	if err := d.ClearBreakpoint(breakpoints[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Continue(); err != errProgramStopped || !done || programRunning {
+		t.Fatalf("expected the program to be done, got %v", err)
+	}
+	d.End()
+
+	var sent []string
+	for request := range requests {
+		sent = append(sent, request)
+	}
+	all := strings.Join(sent, "\n")
+	if !strings.Contains(all, `setBreakpoints {"breakpoints":[{"condition":"x \u003e 1","hitCondition":"2","line":3}],"source":{"path":"`+filename+`"}}`) {
+		t.Fatalf("expected the breakpoint to be set before the configuration was done, got:\n%s", all)
+	}
+	if !strings.Contains(all, `setBreakpoints {"breakpoints":[],"source":{"path":"`+filename+`"}}`) {
+		t.Fatalf("expected the breakpoint to be cleared, got:\n%s", all)
+	}
+	// The local variables are only requested when the program stops, at the entry and after stepping
+	if n := strings.Count(all, "scopes "); n != 2 {
+		t.Fatalf("expected the local variables to be requested twice, got %d requests", n)
+	}
+	if !strings.Contains(all, `disconnect {"terminateDebuggee":true}`) {
+		t.Fatalf("expected a disconnect request, got:\n%s", all)
+	}
+}
+
+func TestDAPBackendHalt(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "main.py")
+	clientReader, adapterWriter := io.Pipe()
+	adapterReader, clientWriter := io.Pipe()
+	requests := make(chan string, 100)
+	go fakeDebugAdapter(adapterReader, adapterWriter, filename, true, requests)
+	client := NewDAPClient(clientReader, clientWriter, func(string) {})
+
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	e.InsertStringAndMove(nil, "x = 1\nwhile True:\n    x += 1\n")
+
+	d := newDAPBackendWithClient(e, dapAdapters[mode.Python], client)
+	defer func() {
+		programRunning = false
+	}()
+	if err := d.launch(filename, filepath.Dir(filename), func() {}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The program keeps running after continuing, until it is paused
+	if d.Running() {
+		t.Fatal("expected the program to be stopped at the entry")
+	}
+	if err := d.Continue(); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Running() {
+		t.Fatal("expected the program to still be running")
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Running() || !programRunning || e.LineNumber() != 3 {
+		t.Fatalf("expected the program to be paused at line 3, got line %d", e.LineNumber())
+	}
+	d.End()
+
+	var sent []string
+	for request := range requests {
+		sent = append(sent, request)
+	}
+	if all := strings.Join(sent, "\n"); !strings.Contains(all, `pause {"threadId":1}`) {
+		t.Fatalf("expected a pause request, got:\n%s", all)
+	}
+}
@@ -41,15 +41,13 @@ var (
 	gdbPathRegular           *string
 )
 
-// DebugActivateBreakpoint sends break-insert to gdb together with the breakpoint in e.breakpoint, if available
-func (e *Editor) DebugActivateBreakpoint(sourceBaseFilename string) (string, error) {
-	if e.breakpoint != nil {
-		if retvalMap, err := e.gdb.CheckedSend("break-insert", fmt.Sprintf("%s:%d", sourceBaseFilename, e.breakpoint.LineNumber())); err != nil {
-			return fmt.Sprintf("%v", retvalMap), err
-		}
-		return "", nil
+// DebugActivateBreakpoint passes the given breakpoint to the debugger, if a debug session is active.
+// If not, the breakpoint is passed on when the debug session starts.
+func (e *Editor) DebugActivateBreakpoint(bp Breakpoint) error {
+	if e.debugger == nil || bp.Disabled {
+		return nil
 	}
-	return "", errors.New("e.breakpoint is not set")
+	return e.debugger.SetBreakpoint(bp)
 }
 
 // DebugStart will start a new debug session, using gdb.
@@ -140,13 +138,6 @@ func (e *Editor) DebugStart(sourceDir, sourceBaseFilename, executableBaseFilenam
 	// Pass in arguments
 	// e.gdb.Send("exec-arguments", "--version")
 
-	// Pass the breakpoint, if it has been set with ctrl-b
-	if e.breakpoint != nil {
-		if retvalMap, err := e.gdb.CheckedSend("break-insert", fmt.Sprintf("%s:%d", sourceBaseFilename, e.breakpoint.LineNumber())); err != nil {
-			return fmt.Sprintf("%v", retvalMap), err
-		}
-	}
-
 	// Assembly specific
 	if e.mode == mode.Assembly {
 		e.gdb.Send("break-insert", "-t", "1")
@@ -584,8 +575,12 @@ func (e *Editor) DebugRegisterMap() (map[string]string, error) {
 	return nil, errors.New("could not find the register values in the payload returned from gdb")
 }
 
-// DebugEnd will end the current gdb session, but not set debugMode to false
+// DebugEnd will end the current debug session, but not set debugMode to false
 func (e *Editor) DebugEnd() {
+	if e.debugger != nil {
+		e.debugger.End()
+		e.debugger = nil
+	}
 	if e.gdb != nil {
 		e.gdb.Exit()
 	}
@@ -606,20 +601,20 @@ func (e *Editor) DebugEnd() {
 	// flogf(gdbLogFile, "[gdb] %s\n", "stopped")
 }
 
-// AddWatch will add a watchpoint / watch expression to gdb
+// AddWatch will add a watchpoint / watch expression to the debugger
 func (e *Editor) AddWatch(expression string) (string, error) {
 	var output string
-	if e.gdb != nil {
+	watchMap[expression] = "?"
+	if e.debugger != nil {
 		// flogf(gdbLogFile, "[gdb] adding watch: %s\n", expression)
-		_, err := e.gdb.CheckedSend("break-watch", "-a", expression)
+		var err error
+		output, err = e.debugger.AddWatch(expression)
 		if err != nil {
+			delete(watchMap, expression)
 			return "", err
 		}
-		output = gdbOutput.String()
-		gdbOutput.Reset()
 		// flogf(gdbLogFile, "[gdb] output after adding watch: %s\n", output)
 	}
-	watchMap[expression] = "?"
 
 	// Don't set this, the variable watch has not been seen yet
 	// lastSeenWatchVariable = expression
@@ -670,7 +665,13 @@ func (e *Editor) DrawWatches(c *vt100.Canvas, repositionCursor bool) {
 		// Draw at least two rows of help text, no matter what
 		availableHeight = 2
 	}
-	if len(watchMap) == 0 {
+	// Get the local variables, if the program is running. The backends keep them until the program is stepped or continued.
+	var locals map[string]string
+	if e.debugger != nil && programRunning {
+		locals, _ = e.debugger.Locals()
+	}
+
+	if len(watchMap) == 0 && len(locals) == 0 {
 		// Draw the help text, if the screen is wide enough
 		if w > 120 {
 			helpSlice := []string{
@@ -731,8 +732,22 @@ func (e *Editor) DrawWatches(c *vt100.Canvas, repositionCursor bool) {
 			overview = append(overview, k+": "+v)
 		}
 
+		// Then add the local variables that are not also watched
+		for _, local := range sortedLocals(locals) {
+			if name, _, _ := strings.Cut(local, ": "); watchMap[name] == "" {
+				overview = append(overview, local)
+			}
+		}
+
+		// Then add the call stack, if the debugger can list it
+		if callStackBackend, ok := e.debugger.(CallStackBackend); ok && programRunning {
+			for i, call := range callStackBackend.CallStack() {
+				overview = append(overview, fmt.Sprintf("#%d %s", i, call))
+			}
+		}
+
 		// Highlight the top item if a debug session is active, and it was changed during this session
-		if foundLastSeen && e.gdb != nil {
+		if foundLastSeen && e.debugger != nil {
 			// Draw the list of watches, where the last changed one is highlighted (and at the top)
 			e.DrawList(bt, c, listBox, overview, 0)
 		} else {
@@ -1088,7 +1103,7 @@ func (e *Editor) usingGDBMightWork() bool {
 // DrawGDBOutput will draw a pane with the 5 last lines of the collected stdoutput from GDB
 func (e *Editor) DrawGDBOutput(c *vt100.Canvas, repositionCursor bool) {
 	// Check if the output pane should be shown or not
-	if e.debugHideOutput || e.gdb == nil {
+	if e.debugHideOutput || e.debugger == nil {
 		return
 	}
 
@@ -1145,7 +1160,7 @@ func (e *Editor) DrawGDBOutput(c *vt100.Canvas, repositionCursor bool) {
 	}
 }
 
-// DebugStartSession builds and then connects to gdb
+// DebugStartSession builds and then starts a debug session, with Delve for Go, if available, or with gdb
 func (e *Editor) DebugStartSession(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, optionalOutputExecutable string) error {
 	absFilename, err := e.AbsFilename()
 	if err != nil {
@@ -1171,15 +1186,19 @@ func (e *Editor) DebugStartSession(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 		return errors.New("could not find " + outputExecutableClean)
 	}
 
-	// Start GDB execution from the top
-	msg, err := e.DebugStart(filepath.Dir(absFilename), filepath.Base(absFilename), outputExecutable, func() {
+	// Start the execution from the top
+	e.DebugEnd()
+	e.LoadProjectBreakpoints()
+	debugger := e.NewDebugBackend()
+	msg, err := debugger.Start(filepath.Dir(absFilename), filepath.Base(absFilename), outputExecutable, func() {
 		// This happens when the program running under GDB is done running.
 		programRunning = false
 		status.SetMessageAfterRedraw("Execution complete")
 		e.redraw = true
 		e.redrawCursor = true
 	})
-	if err != nil || e.gdb == nil {
+	if err != nil {
+		debugger.End()
 		e.redrawCursor = true
 		if msg != "" {
 			msg += ", "
@@ -1187,14 +1206,18 @@ func (e *Editor) DebugStartSession(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 		msg += err.Error()
 		return errors.New("could not start debugging: " + msg)
 	}
+	e.debugger = debugger
 
 	e.GoToTop(c, nil)
 
 	status.ClearAll(c)
-	if e.breakpoint == nil {
+	switch n := len(EnabledBreakpoints()); n {
+	case 0:
 		status.SetMessage("Running")
-	} else {
-		status.SetMessage("Running. Breakpoint at line " + e.breakpoint.LineNumber().String() + ".")
+	case 1:
+		status.SetMessage("Running. 1 breakpoint.")
+	default:
+		status.SetMessage(fmt.Sprintf("Running. %d breakpoints.", n))
 	}
 	status.Show(c, e)
 	return nil
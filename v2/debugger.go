@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/xyproto/env/v2"
+	"github.com/xyproto/files"
+	"github.com/xyproto/mode"
+)
+
+// DebugBackend is a debugger that can be controlled from debug mode, like gdb or Delve.
+// The same keys are used for all backends: ctrl-space steps or continues, ctrl-n steps one instruction,
+// ctrl-f finishes the current function, ctrl-r continues, ctrl-w adds a watch and ctrl-b sets a breakpoint.
+type DebugBackend interface {
+	// Start starts the given executable, stops at the start of main and returns a message if it fails
+	Start(sourceDir, sourceBaseFilename, executableBaseFilename string, doneFunc func()) (string, error)
+	// SetBreakpoint sets the given breakpoint, or updates it if there already is one at the same line
+	SetBreakpoint(bp Breakpoint) error
+	// ClearBreakpoint removes the breakpoint at the same line as the given breakpoint
+	ClearBreakpoint(bp Breakpoint) error
+	// Continue continues the execution until the next breakpoint or until the program ends
+	Continue() error
+	// Next steps to the next line, over function calls
+	Next() error
+	// Step steps to the next line, into function calls
+	Step() error
+	// NextInstruction steps one instruction
+	NextInstruction() error
+	// Finish continues until the current function returns
+	Finish() error
+	// AddWatch adds a watch expression, and returns any output from the debugger
+	AddWatch(expression string) (string, error)
+	// Locals returns the names and values of the local variables in the current function
+	Locals() (map[string]string, error)
+	// End ends the debug session
+	End()
+}
+
+// CallStackBackend is a DebugBackend that can also list the function calls in the current call stack
+type CallStackBackend interface {
+	CallStack() []string
+}
+
+// HaltBackend is a DebugBackend where the program can keep running in the background after
+// stepping or continuing, and then be halted with esc
+type HaltBackend interface {
+	// Running checks if the program is still running after the last command
+	Running() bool
+	// Halt stops the program, and moves the cursor to where it stopped
+	Halt() error
+}
+
+// GDBBackend is a DebugBackend that uses gdb, or rust-gdb for Rust
+type GDBBackend struct {
+	e       *Editor
+	numbers map[string]string // breakpoint numbers, by "filename:line"
+	locals  map[string]string // the local variables, until the program is stepped or continued
+}
+
+// NewDebugBackend returns Delve for Go, if dlv is installed, a debug adapter if one is installed for this mode,
+// or gdb for everything else. O_DEBUGGER can be set to "gdb" to use gdb instead of a debug adapter.
+func (e *Editor) NewDebugBackend() DebugBackend {
+	if e.mode == mode.Go && files.Which("dlv") != "" {
+		return NewDelveBackend(e)
+	}
+	preferGDB := env.Str("O_DEBUGGER") == "gdb" && e.findGDB() != "" && e.usingGDBMightWork()
+	if adapter, ok := dapAdapters[e.mode]; ok && !preferGDB && adapter.Available() {
+		return NewDAPBackend(e, adapter)
+	}
+	return &GDBBackend{e: e, numbers: make(map[string]string)}
+}
+
+// DebuggerAvailable checks if there is a debugger that might work for the current mode
+func (e *Editor) DebuggerAvailable() bool {
+	if e.mode == mode.Go && files.Which("dlv") != "" {
+		return true
+	}
+	if adapter, ok := dapAdapters[e.mode]; ok && adapter.Available() {
+		return true
+	}
+	// Find the path to either "rust-gdb" or "gdb", depending on the mode, then check if it's there
+	return e.findGDB() != "" && e.usingGDBMightWork()
+}
+
+// Start starts a new gdb session
+func (g *GDBBackend) Start(sourceDir, sourceBaseFilename, executableBaseFilename string, doneFunc func()) (string, error) {
+	msg, err := g.e.DebugStart(sourceDir, sourceBaseFilename, executableBaseFilename, doneFunc)
+	if err == nil && g.e.gdb == nil {
+		return msg, errors.New("gdb is not running")
+	}
+	if err != nil {
+		return msg, err
+	}
+	// Pass on the breakpoints, now that the program has stopped at the start of main
+	for _, bp := range EnabledBreakpoints() {
+		if err := g.SetBreakpoint(bp); err != nil {
+			return msg, err
+		}
+	}
+	return msg, nil
+}
+
+// SetBreakpoint sends break-insert to gdb, with the condition and an ignore count for the hit count
+func (g *GDBBackend) SetBreakpoint(bp Breakpoint) error {
+	if g.e.gdb == nil {
+		return errors.New("gdb must be running")
+	}
+	g.ClearBreakpoint(bp)
+	location := fmt.Sprintf("%s:%d", bp.Filename, bp.Line)
+	var args []string
+	if bp.Condition != "" {
+		args = append(args, "-c", strconv.Quote(bp.Condition))
+	}
+	if bp.HitCount > 1 {
+		args = append(args, "-i", strconv.Itoa(bp.HitCount-1))
+	}
+	retvalMap, err := g.e.gdb.CheckedSend("break-insert", append(args, location)...)
+	if err != nil {
+		return fmt.Errorf("%v: %v", err, retvalMap)
+	}
+	if payload, ok := retvalMap["payload"].(map[string]interface{}); ok {
+		if bkpt, ok := payload["bkpt"].(map[string]interface{}); ok {
+			if number, ok := bkpt["number"].(string); ok {
+				g.numbers[location] = number
+			}
+		}
+	}
+	return nil
+}
+
+// ClearBreakpoint sends break-delete to gdb
+func (g *GDBBackend) ClearBreakpoint(bp Breakpoint) error {
+	location := fmt.Sprintf("%s:%d", bp.Filename, bp.Line)
+	number, ok := g.numbers[location]
+	if !ok || g.e.gdb == nil {
+		return nil
+	}
+	delete(g.numbers, location)
+	_, err := g.e.gdb.CheckedSend("break-delete", number)
+	return err
+}
+
+// Continue continues the execution with gdb
+func (g *GDBBackend) Continue() error {
+	g.locals = nil
+	return g.e.DebugContinue()
+}
+
+// Next steps over the next line with gdb
+func (g *GDBBackend) Next() error {
+	g.locals = nil
+	return g.e.DebugNext()
+}
+
+// Step steps into the next line with gdb
+func (g *GDBBackend) Step() error {
+	g.locals = nil
+	return g.e.DebugStep()
+}
+
+// NextInstruction steps one instruction with gdb
+func (g *GDBBackend) NextInstruction() error {
+	g.locals = nil
+	return g.e.DebugNextInstruction()
+}
+
+// Finish steps out of the current function with gdb
+func (g *GDBBackend) Finish() error {
+	g.locals = nil
+	return g.e.DebugFinish()
+}
+
+// AddWatch adds a watchpoint to gdb
+func (g *GDBBackend) AddWatch(expression string) (string, error) {
+	if _, err := g.e.gdb.CheckedSend("break-watch", "-a", expression); err != nil {
+		return "", err
+	}
+	output := gdbOutput.String()
+	gdbOutput.Reset()
+	return output, nil
+}
+
+// Locals returns the local variables of the current frame, as reported by gdb.
+// Variables that are not of a simple type are listed with their type instead of a value.
+func (g *GDBBackend) Locals() (map[string]string, error) {
+	if g.e.gdb == nil {
+		return nil, errors.New("gdb must be running")
+	}
+	if g.locals == nil {
+		var err error
+		if g.locals, err = g.fetchLocals(); err != nil {
+			return nil, err
+		}
+	}
+	return g.locals, nil
+}
+
+// fetchLocals sends stack-list-locals to gdb
+func (g *GDBBackend) fetchLocals() (map[string]string, error) {
+	notification, err := g.e.gdb.CheckedSend("stack-list-locals", "--simple-values")
+	if err != nil {
+		return nil, err
+	}
+	payload, ok := notification["payload"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("no payload from gdb")
+	}
+	locals, ok := payload["locals"].([]interface{})
+	if !ok {
+		return nil, nil
+	}
+	m := make(map[string]string)
+	for _, local := range locals {
+		localMap, ok := local.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := localMap["name"].(string)
+		if name == "" {
+			continue
+		}
+		if value, ok := localMap["value"].(string); ok {
+			m[name] = value
+		} else if typeName, ok := localMap["type"].(string); ok {
+			m[name] = typeName
+		}
+	}
+	return m, nil
+}
+
+// End ends the gdb session
+func (g *GDBBackend) End() {
+	g.locals = nil
+	if g.e.gdb != nil {
+		g.e.gdb.Exit()
+		g.e.gdb = nil
+	}
+}
+
+// sortedLocals returns the given local variables as "name: value" strings, sorted by name
+func sortedLocals(locals map[string]string) []string {
+	names := make([]string, 0, len(locals))
+	for name := range locals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = name + ": " + locals[name]
+	}
+	return lines
+}
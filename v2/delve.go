@@ -0,0 +1,524 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	delveStartTimeout = 10 * time.Second
+	delveStopTimeout  = 2 * time.Second // how long to wait for the program to stop after stepping or continuing
+)
+
+var (
+	errDelveNotStarted = errors.New("dlv did not start")
+	errDelveRunning    = errors.New("the program is running, press esc to halt it")
+)
+
+// The types below mirror the parts of the Delve JSON-RPC API (version 2) that are used here
+
+// DelveLocation is the current location of a thread in the program that is being debugged
+type DelveLocation struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Function *struct {
+		Name string `json:"name"`
+	} `json:"function,omitempty"`
+}
+
+// DelveState is the state of the program that is being debugged
+type DelveState struct {
+	Running       bool           `json:"Running"`
+	CurrentThread *DelveLocation `json:"currentThread,omitempty"`
+	Exited        bool           `json:"exited"`
+	ExitStatus    int            `json:"exitStatus"`
+}
+
+// DelveVariable is a variable, or the result of evaluating an expression
+type DelveVariable struct {
+	Name     string          `json:"name"`
+	Type     string          `json:"type"`
+	Value    string          `json:"value"`
+	Children []DelveVariable `json:"children"`
+}
+
+// DelveBreakpoint is a breakpoint at a line in a file, or at the start of a function
+type DelveBreakpoint struct {
+	ID           int    `json:"id"`
+	File         string `json:"file"`
+	Line         int    `json:"line"`
+	FunctionName string `json:"functionName,omitempty"`
+	Cond         string `json:"Cond,omitempty"`
+	HitCond      string `json:"hitCond,omitempty"`
+}
+
+type delveCommand struct {
+	Name string `json:"name"`
+}
+
+type delveCommandOut struct {
+	State DelveState
+}
+
+type delveEvalScope struct {
+	GoroutineID  int64
+	Frame        int
+	DeferredCall int
+}
+
+type delveLoadConfig struct {
+	FollowPointers     bool
+	MaxVariableRecurse int
+	MaxStringLen       int
+	MaxArrayValues     int
+	MaxStructFields    int
+}
+
+// the current goroutine, and enough of each variable to display it on one line
+var (
+	delveScope          = delveEvalScope{GoroutineID: -1}
+	delveVariableConfig = delveLoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 64, MaxArrayValues: 16, MaxStructFields: -1}
+)
+
+// DelveClient is a client for the headless JSON-RPC API of Delve, the Go debugger
+type DelveClient struct {
+	client *rpc.Client
+}
+
+// NewDelveClient connects to a headless Delve server at the given address
+func NewDelveClient(address string) (*DelveClient, error) {
+	client, err := jsonrpc.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &DelveClient{client}, nil
+}
+
+// call calls a method of the Delve RPC server
+func (dc *DelveClient) call(method string, args, reply interface{}) error {
+	return dc.client.Call("RPCServer."+method, args, reply)
+}
+
+// CreateBreakpoint creates the given breakpoint, at a line in a file, or at the start
+// of a function, if the filename is empty
+func (dc *DelveClient) CreateBreakpoint(bp DelveBreakpoint) (DelveBreakpoint, error) {
+	var out struct {
+		Breakpoint DelveBreakpoint
+	}
+	in := struct {
+		Breakpoint DelveBreakpoint
+	}{bp}
+	err := dc.call("CreateBreakpoint", in, &out)
+	return out.Breakpoint, err
+}
+
+// ClearBreakpoint removes the breakpoint with the given ID
+func (dc *DelveClient) ClearBreakpoint(id int) error {
+	var out struct {
+		Breakpoint *DelveBreakpoint
+	}
+	return dc.call("ClearBreakpoint", struct{ Id int }{id}, &out)
+}
+
+// Command sends a command like "continue", "next", "step", "stepOut" or "stepInstruction",
+// and returns the state of the program when it stops again
+func (dc *DelveClient) Command(name string) (DelveState, error) {
+	var out delveCommandOut
+	err := dc.call("Command", delveCommand{name}, &out)
+	return out.State, err
+}
+
+// StartCommand sends a command without waiting for the program to stop.
+// The returned call is done when it stops, and then call.Reply is a *delveCommandOut.
+func (dc *DelveClient) StartCommand(name string) *rpc.Call {
+	return dc.client.Go("RPCServer.Command", delveCommand{name}, &delveCommandOut{}, nil)
+}
+
+// LocalVariables returns the local variables in the current function
+func (dc *DelveClient) LocalVariables() ([]DelveVariable, error) {
+	var out struct {
+		Variables []DelveVariable
+	}
+	in := struct {
+		Scope delveEvalScope
+		Cfg   delveLoadConfig
+	}{delveScope, delveVariableConfig}
+	err := dc.call("ListLocalVars", in, &out)
+	return out.Variables, err
+}
+
+// Eval evaluates the given expression in the current function
+func (dc *DelveClient) Eval(expression string) (DelveVariable, error) {
+	var out struct {
+		Variable *DelveVariable
+	}
+	in := struct {
+		Scope delveEvalScope
+		Expr  string
+		Cfg   *delveLoadConfig
+	}{delveScope, expression, &delveVariableConfig}
+	if err := dc.call("Eval", in, &out); err != nil {
+		return DelveVariable{}, err
+	}
+	if out.Variable == nil {
+		return DelveVariable{}, errors.New("no value for " + expression)
+	}
+	return *out.Variable, nil
+}
+
+// Detach ends the debug session, and kills the program that is being debugged if kill is true
+func (dc *DelveClient) Detach(kill bool) error {
+	var out struct{}
+	return dc.call("Detach", struct{ Kill bool }{kill}, &out)
+}
+
+// Close closes the connection to the Delve server
+func (dc *DelveClient) Close() error {
+	return dc.client.Close()
+}
+
+// String returns the value of the variable on one line, like {X: 1, Y: 2} for a struct
+func (v DelveVariable) String() string {
+	if v.Value != "" {
+		if v.Type == "string" {
+			return fmt.Sprintf("%q", v.Value)
+		}
+		return v.Value
+	}
+	if len(v.Children) == 0 {
+		return v.Type
+	}
+	parts := make([]string, len(v.Children))
+	for i, child := range v.Children {
+		if child.Name != "" && !strings.HasPrefix(child.Name, "[") {
+			parts[i] = child.Name + ": " + child.String()
+		} else {
+			parts[i] = child.String()
+		}
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// DelveBackend is a DebugBackend that uses a headless Delve server for debugging Go programs
+type DelveBackend struct {
+	e        *Editor
+	cmd      *exec.Cmd
+	client   *DelveClient
+	doneFunc func()
+	ids      map[string]int    // breakpoint IDs, by "filename:line"
+	running  *rpc.Call         // a command that had not returned when the last wait timed out
+	locals   map[string]string // the local variables, from when the program last stopped
+}
+
+// NewDelveBackend creates a new DebugBackend that uses Delve
+func NewDelveBackend(e *Editor) *DelveBackend {
+	return &DelveBackend{e: e, ids: make(map[string]int)}
+}
+
+// Start starts "dlv exec" in headless mode, connects to it and continues to the start of main.main
+func (d *DelveBackend) Start(sourceDir, sourceBaseFilename, executableBaseFilename string, doneFunc func()) (string, error) {
+	if !noWriteToCache {
+		flogf(gdbLogFile, "[dlv] dir %s, src %s, exe %s\n", sourceDir, sourceBaseFilename, executableBaseFilename)
+	}
+	d.End()
+	d.doneFunc = doneFunc
+
+	cmd := exec.Command("dlv", "exec", "--headless", "--api-version=2", "--listen=127.0.0.1:0", filepath.Join(sourceDir, executableBaseFilename))
+	cmd.Dir = sourceDir
+	// Both the output from Delve and from the program goes to the same pipe
+	stdout, pw, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	err = cmd.Start()
+	pw.Close()
+	if err != nil {
+		stdout.Close()
+		return "", err
+	}
+	d.cmd = cmd
+
+	// Wait for the address of the server, then collect the output of the program
+	addressChan := make(chan string, 1)
+	go func() {
+		reader := bufio.NewReader(stdout)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(addressChan)
+				stdout.Close()
+				return
+			}
+			if _, address, ok := strings.Cut(line, "API server listening at:"); ok {
+				addressChan <- strings.TrimSpace(address)
+				break
+			}
+			gdbOutput.WriteString(line)
+		}
+		io.Copy(&gdbOutput, reader)
+		stdout.Close()
+	}()
+	var address string
+	select {
+	case address = <-addressChan:
+	case <-time.After(delveStartTimeout):
+	}
+	if address == "" {
+		d.End()
+		return gdbOutput.String(), errDelveNotStarted
+	}
+	if d.client, err = NewDelveClient(address); err != nil {
+		d.End()
+		return "", err
+	}
+
+	// Pass on the breakpoints that have been set with ctrl-b
+	for _, bp := range EnabledBreakpoints() {
+		if err := d.SetBreakpoint(bp); err != nil {
+			d.End()
+			return "", err
+		}
+	}
+
+	// Start from the top of main.main, like "exec-run --start" does for gdb
+	bp, err := d.client.CreateBreakpoint(DelveBreakpoint{FunctionName: "main.main"})
+	if err != nil {
+		d.End()
+		return "", err
+	}
+	programRunning = true
+	if err := d.command("continue", delveStartTimeout); err != nil {
+		d.End()
+		return "", err
+	}
+	d.client.ClearBreakpoint(bp.ID)
+
+	return "started dlv", nil
+}
+
+// newDelveBackendWithClient creates a DelveBackend that uses an already connected client
+func newDelveBackendWithClient(e *Editor, client *DelveClient, doneFunc func()) *DelveBackend {
+	return &DelveBackend{e: e, client: client, doneFunc: doneFunc, ids: make(map[string]int)}
+}
+
+// command sends a command to Delve, and waits for the program to stop. If the program is still running
+// after the timeout, it keeps running in the background, until it is halted by the next command or with esc.
+func (d *DelveBackend) command(name string, timeout time.Duration) error {
+	if !programRunning {
+		return errProgramStopped
+	}
+	if err := d.Halt(); err != nil {
+		return err
+	}
+	if !programRunning { // the program exited while running in the background
+		return errProgramStopped
+	}
+	d.running = d.client.StartCommand(name)
+	return d.wait(timeout)
+}
+
+// wait waits for the running command to return, then moves the cursor to where the program stopped,
+// and updates the watches. If the program has exited, doneFunc is called.
+func (d *DelveBackend) wait(timeout time.Duration) error {
+	if d.running == nil {
+		return nil
+	}
+	var call *rpc.Call
+	select {
+	case call = <-d.running.Done:
+	default:
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case call = <-d.running.Done:
+		case <-timer.C:
+			return nil
+		}
+	}
+	d.running = nil
+	state, err := call.Reply.(*delveCommandOut).State, call.Error
+	if err != nil && strings.Contains(err.Error(), "has exited") {
+		state.Exited, err = true, nil
+	}
+	if err != nil {
+		return err
+	}
+	if state.Exited {
+		programRunning = false
+		if d.doneFunc != nil {
+			d.doneFunc()
+		}
+		return errProgramStopped
+	}
+	if t := state.CurrentThread; t != nil && t.Line > 0 {
+		if absFilename, err := d.e.AbsFilename(); err == nil && absFilename == t.File {
+			d.e.GoToLineNumber(LineNumber(t.Line), nil, nil, true)
+		}
+	}
+	d.updateWatches()
+	d.locals, _ = d.fetchLocals()
+	return nil
+}
+
+// Running checks if the program is still running after the last command
+func (d *DelveBackend) Running() bool {
+	d.wait(0)
+	return d.running != nil
+}
+
+// Halt stops the program, if it is still running after the last command
+func (d *DelveBackend) Halt() error {
+	if !d.Running() {
+		return nil
+	}
+	if _, err := d.client.Command("halt"); err != nil {
+		return err
+	}
+	if err := d.wait(delveStopTimeout); err != nil {
+		return err
+	}
+	if d.running != nil {
+		return errors.New("the program could not be halted")
+	}
+	return nil
+}
+
+// updateWatches evaluates all watch expressions, and moves the one that changed to the top of the list
+func (d *DelveBackend) updateWatches() {
+	for expression, oldValue := range watchMap {
+		v, err := d.client.Eval(expression)
+		if err != nil {
+			continue
+		}
+		if newValue := v.String(); newValue != oldValue {
+			watchMap[expression] = newValue
+			lastSeenWatchVariable = expression
+		}
+	}
+}
+
+// SetBreakpoint sets a breakpoint at the given line, with a condition and a hit count, if given
+func (d *DelveBackend) SetBreakpoint(bp Breakpoint) error {
+	if d.client == nil {
+		return errDelveNotStarted
+	}
+	if err := d.ClearBreakpoint(bp); err != nil {
+		return err
+	}
+	delveBreakpoint := DelveBreakpoint{File: bp.Filename, Line: int(bp.Line), Cond: bp.Condition}
+	if bp.HitCount > 1 {
+		delveBreakpoint.HitCond = ">= " + strconv.Itoa(bp.HitCount)
+	}
+	created, err := d.client.CreateBreakpoint(delveBreakpoint)
+	if err != nil {
+		return err
+	}
+	d.ids[fmt.Sprintf("%s:%d", bp.Filename, bp.Line)] = created.ID
+	return nil
+}
+
+// ClearBreakpoint removes the breakpoint at the given line, if it has been set
+func (d *DelveBackend) ClearBreakpoint(bp Breakpoint) error {
+	location := fmt.Sprintf("%s:%d", bp.Filename, bp.Line)
+	id, ok := d.ids[location]
+	if !ok || d.client == nil {
+		return nil
+	}
+	delete(d.ids, location)
+	return d.client.ClearBreakpoint(id)
+}
+
+// Continue continues to the next breakpoint, or to the end of the program
+func (d *DelveBackend) Continue() error {
+	return d.command("continue", delveStopTimeout)
+}
+
+// Next steps over the next line
+func (d *DelveBackend) Next() error {
+	return d.command("next", delveStopTimeout)
+}
+
+// Step steps into the next line
+func (d *DelveBackend) Step() error {
+	return d.command("step", delveStopTimeout)
+}
+
+// NextInstruction steps one instruction
+func (d *DelveBackend) NextInstruction() error {
+	return d.command("stepInstruction", delveStopTimeout)
+}
+
+// Finish steps out of the current function
+func (d *DelveBackend) Finish() error {
+	return d.command("stepOut", delveStopTimeout)
+}
+
+// AddWatch evaluates the given expression now, and then every time the program stops
+func (d *DelveBackend) AddWatch(expression string) (string, error) {
+	if d.client == nil {
+		return "", errDelveNotStarted
+	}
+	if d.Running() {
+		return "", errDelveRunning
+	}
+	v, err := d.client.Eval(expression)
+	if err != nil {
+		return "", err
+	}
+	watchMap[expression] = v.String()
+	return "", nil
+}
+
+// Locals returns the local variables in the current function, from when the program last stopped
+func (d *DelveBackend) Locals() (map[string]string, error) {
+	if d.client == nil {
+		return nil, errDelveNotStarted
+	}
+	if d.Running() {
+		return nil, errDelveRunning
+	}
+	return d.locals, nil
+}
+
+// fetchLocals requests the local variables in the current function from Delve
+func (d *DelveBackend) fetchLocals() (map[string]string, error) {
+	variables, err := d.client.LocalVariables()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string, len(variables))
+	for _, v := range variables {
+		m[v.Name] = v.String()
+	}
+	return m, nil
+}
+
+// End detaches from Delve, which also stops the program and the Delve server
+func (d *DelveBackend) End() {
+	d.running = nil
+	d.locals = nil
+	if d.client != nil {
+		d.client.Detach(true)
+		d.client.Close()
+		d.client = nil
+	}
+	if d.cmd != nil {
+		if d.cmd.Process != nil {
+			d.cmd.Process.Kill()
+		}
+		d.cmd.Wait()
+		d.cmd = nil
+	}
+}
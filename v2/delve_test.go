@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// FakeDelve is a fake Delve RPC server, that steps one line at a time and exits when continuing,
+// or keeps running when continuing until it is halted, if halt is set
+type FakeDelve struct {
+	filename    string
+	line        int
+	breakpoints []DelveBreakpoint
+	lastID      int
+	detached    bool
+	halt        chan struct{}
+}
+
+type FakeDelveBreakpoint struct {
+	Breakpoint DelveBreakpoint
+}
+
+type FakeDelveState struct {
+	State DelveState
+}
+
+type FakeDelveCommand struct {
+	Name string `json:"name"`
+}
+
+type FakeDelveEvalIn struct {
+	Expr string
+}
+
+type FakeDelveEvalOut struct {
+	Variable *DelveVariable
+}
+
+type FakeDelveVariables struct {
+	Variables []DelveVariable
+}
+
+type FakeDelveDetachIn struct {
+	Kill bool
+}
+
+func (f *FakeDelve) CreateBreakpoint(in FakeDelveBreakpoint, out *FakeDelveBreakpoint) error {
+	f.lastID++
+	in.Breakpoint.ID = f.lastID
+	f.breakpoints = append(f.breakpoints, in.Breakpoint)
+	out.Breakpoint = in.Breakpoint
+	return nil
+}
+
+type FakeDelveClearIn struct {
+	Id int
+}
+
+func (f *FakeDelve) ClearBreakpoint(in FakeDelveClearIn, out *FakeDelveBreakpoint) error {
+	for i, bp := range f.breakpoints {
+		if bp.ID == in.Id {
+			f.breakpoints = append(f.breakpoints[:i], f.breakpoints[i+1:]...)
+			out.Breakpoint = bp
+			return nil
+		}
+	}
+	return errors.New("no breakpoint with that ID")
+}
+
+func (f *FakeDelve) Command(in FakeDelveCommand, out *FakeDelveState) error {
+	switch {
+	case in.Name == "halt":
+		f.halt <- struct{}{}
+		return nil
+	case in.Name == "continue" && f.halt != nil:
+		<-f.halt
+		out.State.CurrentThread = &DelveLocation{File: f.filename, Line: f.line}
+		return nil
+	case in.Name == "continue":
+		out.State.Exited = true
+		return nil
+	}
+	f.line++
+	out.State.CurrentThread = &DelveLocation{File: f.filename, Line: f.line}
+	return nil
+}
+
+func (f *FakeDelve) Eval(in FakeDelveEvalIn, out *FakeDelveEvalOut) error {
+	out.Variable = &DelveVariable{Name: in.Expr, Type: "int", Value: strconv.Itoa(f.line)}
+	return nil
+}
+
+func (f *FakeDelve) ListLocalVars(in FakeDelveEvalIn, out *FakeDelveVariables) error {
+	out.Variables = []DelveVariable{
+		{Name: "s", Type: "string", Value: "hi"},
+		{Name: "p", Type: "main.Point", Children: []DelveVariable{{Name: "X", Type: "int", Value: "1"}, {Name: "Y", Type: "int", Value: "2"}}},
+	}
+	return nil
+}
+
+func (f *FakeDelve) Detach(in FakeDelveDetachIn, out *struct{}) error {
+	f.detached = in.Kill
+	return nil
+}
+
+// startFakeDelve serves the given fake Delve server, and returns a client that is connected to it
+func startFakeDelve(t *testing.T, fake *FakeDelve) *DelveClient {
+	server := rpc.NewServer()
+	if err := server.RegisterName("RPCServer", fake); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+		}
+	}()
+	client, err := NewDelveClient(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestDelveBackend(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "main.go")
+	fake := &FakeDelve{filename: filename, line: 2}
+	client := startFakeDelve(t, fake)
+
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	e.InsertStringAndMove(nil, "package main\n\nfunc main() {\n\tx := 1\n\tx++\n\tprintln(x)\n}\n")
+	e.GoToTop(nil, nil)
+
+	done := false
+	d := newDelveBackendWithClient(e, client, func() {
+		done = true
+	})
+	programRunning = true
+	defer func() {
+		programRunning = false
+		watchMap = make(map[string]string)
+		lastSeenWatchVariable = ""
+	}()
+
+	if _, err := d.AddWatch("x"); err != nil || watchMap["x"] != "2" {
+		t.Fatalf("expected the watch to be evaluated, got %q (%v)", watchMap["x"], err)
+	}
+	if err := d.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if e.LineNumber() != 3 {
+		t.Fatalf("expected the cursor to be at line 3, got %d", e.LineNumber())
+	}
+	if watchMap["x"] != "3" || lastSeenWatchVariable != "x" {
+		t.Fatalf("expected the watch to be updated after stepping, got %q", watchMap["x"])
+	}
+
+	locals, err := d.Locals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locals["s"] != `"hi"` || locals["p"] != "{X: 1, Y: 2}" {
+		t.Fatalf("unexpected local variables: %v", locals)
+	}
+
+	bp := Breakpoint{Filename: filename, Line: 6}
+	if err := d.SetBreakpoint(bp); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.breakpoints) != 1 || fake.breakpoints[0].File != filename || fake.breakpoints[0].Line != 6 {
+		t.Fatalf("unexpected breakpoints: %+v", fake.breakpoints)
+	}
+	// Changing the condition replaces the breakpoint
+	bp.Condition, bp.HitCount = "x > 2", 3
+	if err := d.SetBreakpoint(bp); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.breakpoints) != 1 || fake.breakpoints[0].Cond != "x > 2" || fake.breakpoints[0].HitCond != ">= 3" {
+		t.Fatalf("unexpected breakpoints: %+v", fake.breakpoints)
+	}
+	if err := d.ClearBreakpoint(bp); err != nil || len(fake.breakpoints) != 0 {
+		t.Fatalf("expected the breakpoint to be cleared, got %+v (%v)", fake.breakpoints, err)
+	}
+
+	if err := d.Continue(); err != errProgramStopped || !done || programRunning {
+		t.Fatalf("expected the program to be done, got %v", err)
+	}
+
+	d.End()
+	if !fake.detached {
+		t.Fatal("expected Delve to be detached and the program to be killed")
+	}
+}
+
+func TestDelveBackendHalt(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "main.go")
+	fake := &FakeDelve{filename: filename, line: 4, halt: make(chan struct{}, 1)}
+	client := startFakeDelve(t, fake)
+
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	e.InsertStringAndMove(nil, "package main\n\nfunc main() {\n\tfor {\n\t}\n}\n")
+	e.GoToTop(nil, nil)
+
+	d := newDelveBackendWithClient(e, client, nil)
+	programRunning = true
+	defer func() {
+		programRunning = false
+	}()
+
+	// The program keeps running after continuing, and can not be inspected until it is halted
+	if err := d.Continue(); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Running() {
+		t.Fatal("expected the program to still be running")
+	}
+	if _, err := d.Locals(); err != errDelveRunning {
+		t.Fatalf("expected errDelveRunning, got %v", err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Running() || e.LineNumber() != 4 {
+		t.Fatalf("expected the program to be halted at line 4, got line %d", e.LineNumber())
+	}
+	d.End()
+}
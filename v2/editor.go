@@ -22,12 +22,17 @@ import (
 // Editor represents the contents and editor settings, but not settings related to the viewport or scrolling
 type Editor struct {
 	detectedTabs       *bool           // were tab or space indentations detected when loading the data?
-	breakpoint         *Position       // for the breakpoint/jump functionality in debug mode
 	gdb                *gdb.Gdb        // connection to gdb, if debugMode is enabled
+	debugger           DebugBackend    // the debugger for the current debug session, gdb or Delve
 	sameFilePortal     *Portal         // a portal that points to the same file
-	lines              map[int][]rune  // the contents of the current document
+	lines              Rope            // the contents of the current document
+	cursors            []Cursor        // extra cursors, for editing at several places at once
+	selection          *Selection      // the current selection, if text is being selected
 	macro              *Macro          // the contents of the current macro (will be cleared when esc is pressed)
 	filename           string          // the current filename
+	pathsFilename      string          // the filename that absFilename and projectRoot were found for
+	absFilename        string          // the absolute path of pathsFilename, cached by projectPaths
+	projectRoot        string          // the project root of pathsFilename, cached by projectPaths
 	searchTerm         string          // the current search term, used when searching
 	stickySearchTerm   string          // used when going to the next match with ctrl-n, unless esc has been pressed
 	Theme                              // editor theme, embedded struct
@@ -63,6 +68,8 @@ type Editor struct {
 	generatingTokens   bool            // is code or text being generated right now?
 	redrawCursor       bool            // if the cursor should be moved to the location it is supposed to be
 	fixAsYouType       bool            // fix each line as you type it in, using AI?
+	ghostTextEnabled   bool            // suggest a completion after a typing pause, drawn dimmed after the cursor?
+	buildOnSave        bool            // check the code for errors in the background, after every save?
 	monitorAndReadOnly bool            // monitor the file for changes and open it as read-only
 	primaryClipboard   bool            // use the primary or the secondary clipboard on UNIX?
 	jumpToLetterMode   bool            // jump directly to a highlighted letter
@@ -85,7 +92,6 @@ type Editor struct {
 func NewCustomEditor(indentation mode.TabsSpaces, scrollSpeed int, m mode.Mode, theme Theme, syntaxHighlight, rainbowParenthesis, monitorAndReadOnly bool) *Editor {
 	e := &Editor{}
 	e.SetTheme(theme)
-	e.lines = make(map[int][]rune)
 	e.indentation = indentation
 	e.syntaxHighlight = syntaxHighlight
 	e.rainbowParenthesis = rainbowParenthesis
@@ -123,54 +129,36 @@ func NewSimpleEditor(wordWrapLimit int) *Editor {
 	return e
 }
 
-// CopyLines will create a new map[int][]rune struct that is the copy of all the lines in the editor
-func (e *Editor) CopyLines() map[int][]rune {
-	lines2 := make(map[int][]rune)
-	for key, runes := range e.lines {
-		runes2 := make([]rune, len(runes))
-		copy(runes2, runes)
-		lines2[key] = runes2
-	}
-	return lines2
+// CopyLines returns a copy of all the lines in the editor.
+// Since the lines are stored in a persistent rope, this does not copy the contents.
+func (e *Editor) CopyLines() Rope {
+	return e.lines
 }
 
 // Set will store a rune in the editor data, at the given data coordinates
 func (e *Editor) Set(x int, index LineIndex, r rune) {
 	y := int(index)
-	if e.lines == nil {
-		e.lines = make(map[int][]rune)
-	}
-	_, ok := e.lines[y]
-	if !ok {
-		e.lines[y] = make([]rune, 0, x+1)
-	}
-	l := len(e.lines[y])
-	if x < l {
-		e.lines[y][x] = r
-		e.changed = true
+	if y < 0 || x < 0 {
 		return
 	}
+	line := e.lines.Line(y)
+	l := len(line)
 	// If the line is too short, fill it up with spaces
-	if l <= x {
-		n := (x + 1) - l
-		e.lines[y] = append(e.lines[y], []rune(strings.Repeat(" ", n))...)
+	newLine := make([]rune, l, max(l, x+1))
+	copy(newLine, line)
+	for len(newLine) <= x {
+		newLine = append(newLine, ' ')
 	}
-
 	// Set the rune
-	e.lines[y][x] = r
+	newLine[x] = r
+	e.lines.Set(y, newLine)
 	e.changed = true
 }
 
 // Get will retrieve a rune from the editor data, at the given coordinates
 func (e *Editor) Get(x int, y LineIndex) rune {
-	if e.lines == nil {
-		return ' '
-	}
-	runes, ok := e.lines[int(y)]
-	if !ok {
-		return ' '
-	}
-	if x >= len(runes) {
+	runes := e.lines.Line(int(y))
+	if x < 0 || x >= len(runes) {
 		return ' '
 	}
 	return runes[x]
@@ -183,18 +171,14 @@ func (e *Editor) Changed() bool {
 
 // Line returns the contents of line number N, counting from 0
 func (e *Editor) Line(n LineIndex) string {
-	line, ok := e.lines[int(n)]
-	if !ok {
-		return ""
-	}
-	return string(line)
+	return string(e.lines.Line(int(n)))
 }
 
 // ScreenLine returns the screen contents of line number N, counting from 0.
 // The tabs are expanded.
 func (e *Editor) ScreenLine(n int) string {
-	line, ok := e.lines[n]
-	if ok {
+	if e.lines.Has(n) {
+		line := e.lines.Line(n)
 		var sb strings.Builder
 		skipX := e.pos.offsetX
 		for _, r := range line {
@@ -264,36 +248,26 @@ func (e *Editor) FirstDataPosition(n LineIndex) int {
 // CountRune will count the number of instances of the rune r in the line n
 func (e *Editor) CountRune(r rune, n LineIndex) int {
 	var counter int
-	line, ok := e.lines[int(n)]
-	if ok {
-		for _, l := range line {
-			if l == r {
-				counter++
-			}
+	for _, l := range e.lines.Line(int(n)) {
+		if l == r {
+			counter++
 		}
 	}
 	return counter
 }
 
-// Len returns the number of lines
+// Len returns the number of lines.
+// An empty document is considered to have one empty line.
 func (e *Editor) Len() int {
-	maxy := 0
-	for y := range e.lines {
-		if y > maxy {
-			maxy = y
-		}
-	}
-	return maxy + 1
+	return max(e.lines.Len(), 1)
 }
 
 // String returns the contents of the editor
 func (e *Editor) String() string {
-	var sb strings.Builder
-	l := e.Len()
-	for i := 0; i < l; i++ {
-		sb.WriteString(e.Line(LineIndex(i)) + "\n")
+	if e.lines.Len() == 0 {
+		return "\n" // an empty document has one empty line, like for Len
 	}
-	return sb.String()
+	return e.lines.String()
 }
 
 // ContentsAndReverseSearchPrefix returns the contents of the editor,
@@ -320,7 +294,7 @@ func (e *Editor) ContentsAndReverseSearchPrefix(prefix string) (string, LineInde
 
 // Clear removes all data from the editor
 func (e *Editor) Clear() {
-	e.lines = make(map[int][]rune)
+	e.lines = Rope{}
 	e.changed = true
 }
 
@@ -558,13 +532,13 @@ func (e *Editor) Save(c *vt100.Canvas, tty *vt100.TTY) error {
 // Returns true if the line was trimmed
 func (e *Editor) TrimRight(index LineIndex) bool {
 	n := int(index)
-	line, ok := e.lines[n]
-	if !ok {
+	if !e.lines.Has(n) {
 		return false
 	}
+	line := e.lines.Line(n)
 	trimmedLine := []rune(strings.TrimRightFunc(string(line), unicode.IsSpace))
 	if len(trimmedLine) != len(line) {
-		e.lines[n] = trimmedLine
+		e.lines.Set(n, trimmedLine)
 		return true
 	}
 	return false
@@ -575,11 +549,12 @@ func (e *Editor) TrimRight(index LineIndex) bool {
 func (e *Editor) TrimLeft(index LineIndex) bool {
 	changed := false
 	n := int(index)
-	if line, ok := e.lines[n]; ok {
+	if e.lines.Has(n) {
+		line := e.lines.Line(n)
 		newRunes := []rune(strings.TrimLeftFunc(string(line), unicode.IsSpace))
 		// TODO: Just compare lengths instead of contents?
 		if string(newRunes) != string(line) {
-			e.lines[n] = newRunes
+			e.lines.Set(n, newRunes)
 			changed = true
 		}
 	}
@@ -605,24 +580,15 @@ func (e *Editor) DeleteRestOfLine() {
 		return
 	}
 	y := int(e.DataY())
-	if e.lines == nil {
-		e.lines = make(map[int][]rune)
-	}
-	v, ok := e.lines[y]
-	if !ok {
+	if !e.lines.Has(y) {
 		return
 	}
-	if v == nil {
-		e.lines[y] = make([]rune, 0)
-	}
-	if x > len(e.lines[y]) {
+	v := e.lines.Line(y)
+	if x > len(v) {
 		return
 	}
-	e.lines[y] = e.lines[y][:x]
+	e.lines.Set(y, v[:x:x])
 	e.changed = true
-
-	// Make sure no lines are nil
-	e.MakeConsistent()
 }
 
 // DeleteLine will delete the given line index
@@ -635,41 +601,14 @@ func (e *Editor) DeleteLine(n LineIndex) {
 	endOfDocument := n >= lastLineIndex
 	if endOfDocument {
 		// Just delete this line
-		delete(e.lines, int(n))
+		e.lines.Delete(int(n))
 		return
 	}
-	// TODO: Rely on the length of the hash map for finding the index instead of
-	//       searching through each line number key.
-	var maxIndex LineIndex
-	found := false
-	for k := range e.lines {
-		if LineIndex(k) > maxIndex {
-			maxIndex = LineIndex(k)
-			found = true
-		}
-	}
-	if !found {
-		// This should never happen
-		return
-	}
-	if _, ok := e.lines[int(maxIndex)]; !ok {
-		// The line numbers and the length of e.lines does not match
-		return
-	}
-	// Shift all lines after y:
-	// shift all lines after n one step closer to n, overwriting e.lines[n]
-	for index := n; index <= (maxIndex - 1); index++ {
-		i := int(index)
-		e.lines[i] = e.lines[i+1]
-	}
-	// Then delete the final item
-	delete(e.lines, int(maxIndex))
+	// All lines after n are shifted one step closer to n
+	e.lines.Delete(int(n))
 
 	// This changes the document
 	e.changed = true
-
-	// Make sure no lines are nil
-	e.MakeConsistent()
 }
 
 // DeleteLineMoveBookmark will delete the given line index and also move the bookmark if it's after n
@@ -689,79 +628,64 @@ func (e *Editor) DeleteCurrentLineMoveBookmark(bookmark *Position) {
 // Delete will delete a character at the given position
 func (e *Editor) Delete() {
 	y := int(e.DataY())
-	lineLen := len(e.lines[y])
-	if _, ok := e.lines[y]; !ok || lineLen == 0 || (lineLen == 1 && unicode.IsSpace(e.lines[y][0])) {
-		// All keys in the map that are > y should be shifted -1.
-		// This also overwrites e.lines[y].
+	line := e.lines.Line(y)
+	lineLen := len(line)
+	if !e.lines.Has(y) || lineLen == 0 || (lineLen == 1 && unicode.IsSpace(line[0])) {
+		// All lines that are after y are shifted one step up.
 		e.DeleteLine(LineIndex(y))
 		e.changed = true
 		return
 	}
 	x, err := e.DataX()
-	if err != nil || x > len(e.lines[y])-1 {
+	if err != nil || x > lineLen-1 {
 		// on the last index, just use every element but x
-		e.lines[y] = e.lines[y][:x]
-		// check if the next line exists
-		if _, ok := e.lines[y+1]; ok {
-			// then add the contents of the next line, if available
-			nextLine, ok := e.lines[y+1]
-			if ok && len(nextLine) > 0 {
-				e.lines[y] = append(e.lines[y], nextLine...)
-				// then delete the next line
-				e.DeleteLine(LineIndex(y + 1))
-			}
+		newLine := line[:x:x]
+		// check if the next line exists, then add the contents of the next line, if available
+		if nextLine := e.lines.Line(y + 1); len(nextLine) > 0 {
+			newLine = append(newLine, nextLine...)
+			e.lines.Set(y, newLine)
+			// then delete the next line
+			e.DeleteLine(LineIndex(y + 1))
+		} else {
+			e.lines.Set(y, newLine)
 		}
 		e.changed = true
 		return
 	}
 	// Delete just this character
-	e.lines[y] = append(e.lines[y][:x], e.lines[y][x+1:]...)
+	newLine := make([]rune, 0, lineLen-1)
+	newLine = append(newLine, line[:x]...)
+	newLine = append(newLine, line[x+1:]...)
+	e.lines.Set(y, newLine)
 	e.changed = true
-
-	// Make sure no lines are nil
-	e.MakeConsistent()
 }
 
 // Empty will check if the current editor contents are empty or not.
 // If there's only one line left and it is only whitespace, that will be considered empty as well.
 func (e *Editor) Empty() bool {
-	l := len(e.lines)
+	l := e.lines.Len()
 	if l == 0 {
 		return true
 	}
 	if l == 1 {
-		// Regardless of line number key, check the contents of the one remaining trimmed line
-		for _, line := range e.lines {
-			return len(strings.TrimSpace(string(line))) == 0
-		}
+		// Check the contents of the one remaining trimmed line
+		return len(strings.TrimSpace(string(e.lines.Line(0)))) == 0
 	}
 	// > 1 lines
 	return false
 }
 
-// MakeConsistent creates an empty slice of runes for any empty lines,
-// to make sure that no line number below e.Len() points to a nil map.
-func (e *Editor) MakeConsistent() {
-	// Check if the keys in the map are consistent
-	for i := 0; i < len(e.lines); i++ {
-		if _, found := e.lines[i]; !found {
-			e.lines[i] = make([]rune, 0)
-			e.changed = true
-		}
-	}
-}
-
 // WithinLimit will check if a line is within the word wrap limit,
 // given a Y position.
 func (e *Editor) WithinLimit(y LineIndex) bool {
-	return len(e.lines[int(y)]) < e.wrapWidth
+	return len(e.lines.Line(int(y))) < e.wrapWidth
 }
 
 // LastWord will return the last word of a line,
 // given a Y position. Returns an empty string if there is no last word.
 func (e *Editor) LastWord(y int) string {
 	// TODO: Use a faster method
-	words := strings.Fields(strings.TrimSpace(string(e.lines[y])))
+	words := strings.Fields(strings.TrimSpace(string(e.lines.Line(y))))
 	if len(words) > 0 {
 		return words[len(words)-1]
 	}
@@ -776,12 +700,12 @@ func (e *Editor) LastWord(y int) string {
 func (e *Editor) SplitOvershoot(index LineIndex, isSpace bool) ([]rune, []rune, bool) {
 	hasSpace := false
 
-	y := int(index)
+	line := e.lines.Line(int(index))
 
 	// Maximum word length to not keep as one word
 	maxDistance := e.wrapWidth / 2
 	if e.WithinLimit(index) {
-		return e.lines[y], make([]rune, 0), false
+		return line, make([]rune, 0), false
 	}
 	splitPosition := e.wrapWidth
 	if isSpace {
@@ -791,7 +715,7 @@ func (e *Editor) SplitOvershoot(index LineIndex, isSpace bool) ([]rune, []rune,
 		// If a space is reached, check if it is too far away from n to be used as a split position, or not.
 		spacePosition := -1
 		for i := splitPosition; i >= 0; i-- {
-			if i < len(e.lines[y]) && unicode.IsSpace(e.lines[y][i]) {
+			if i < len(line) && unicode.IsSpace(line[i]) {
 				// Found a space at position i
 				spacePosition = i
 				break
@@ -811,11 +735,11 @@ func (e *Editor) SplitOvershoot(index LineIndex, isSpace bool) ([]rune, []rune,
 
 	n := splitPosition
 	// Make space for the two parts
-	first := make([]rune, len(e.lines[y][:n]))
-	second := make([]rune, len(e.lines[y][n:]))
+	first := make([]rune, len(line[:n]))
+	second := make([]rune, len(line[n:]))
 	// Copy the line into first and second
-	copy(first, e.lines[y][:n])
-	copy(second, e.lines[y][n:])
+	copy(first, line[:n])
+	copy(second, line[n:])
 
 	// If the second part starts with a space, remove it
 	if len(second) > 0 && unicode.IsSpace(second[0]) {
@@ -843,11 +767,11 @@ func (e *Editor) WrapAllLines() bool {
 
 		if len(first) > 0 && len(second) > 0 {
 
-			e.lines[i] = first
+			e.lines.Set(i, first)
 			if spaceBetween {
 				second = append(second, ' ')
 			}
-			e.lines[i+1] = append(second, e.lines[i+1]...)
+			e.lines.Set(i+1, append(second, e.lines.Line(i+1)...))
 			e.InsertLineBelowAt(LineIndex(i + 1))
 
 			// This isn't perfect, but it helps move the cursor somewhere in
@@ -866,16 +790,13 @@ func (e *Editor) WrapAllLines() bool {
 		e.pos.sy += insertedLines
 		if e.pos.sy < 0 {
 			e.pos.sy = 0
-		} else if e.pos.sy >= len(e.lines) {
-			e.pos.sy = len(e.lines) - 1
+		} else if e.pos.sy >= e.lines.Len() {
+			e.pos.sy = e.lines.Len() - 1
 		}
 		e.redraw = true
 		e.redrawCursor = true
 	}
 
-	// This appears to be needed as well
-	e.MakeConsistent()
-
 	return wrapped
 }
 
@@ -899,50 +820,30 @@ func (e *Editor) InsertLineAbove() {
 
 	y := int(lineIndex)
 
-	// Create new set of lines
-	lines2 := make(map[int][]rune)
-
 	// If at the first line, just add a line at the top
 	if y == 0 {
-
-		// Insert a blank line
-		lines2[0] = make([]rune, 0)
-		// Then insert all the other lines, shifted by 1
-		for k, v := range e.lines {
-			lines2[k+1] = v
-		}
+		// Insert a blank line, the other lines are shifted by 1
+		e.lines.Insert(0, []rune{})
 		y++
-
-	} else {
-		// For each line in the old map, if at (y-1), insert a blank line
-		// (insert a blank line above)
-		for k, v := range e.lines {
-			if k < (y - 1) {
-				lines2[k] = v
-			} else if k == (y - 1) {
-				lines2[k] = v
-				lines2[k+1] = make([]rune, 0)
-			} else if k > (y - 1) {
-				lines2[k+1] = v
-			}
-		}
+	} else if y <= e.lines.Len() {
+		// Insert a blank line above
+		e.lines.Insert(y, []rune{})
 	}
 
-	// Use the new set of lines
-	e.lines = lines2
+	// Skip trailing newlines after this line
+	e.trimEmptyLinesAfter(y)
 
-	// Make sure no lines are nil
-	e.MakeConsistent()
+	e.changed = true
+}
 
-	// Skip trailing newlines after this line
-	for i := len(e.lines); i > y; i-- {
-		if len(e.lines[i]) == 0 {
-			delete(e.lines, i)
-		} else {
+// trimEmptyLinesAfter removes trailing empty lines that come after the given line index
+func (e *Editor) trimEmptyLinesAfter(y int) {
+	for i := e.lines.Len() - 1; i > y; i-- {
+		if len(e.lines.Line(i)) != 0 {
 			break
 		}
+		e.lines.Delete(i)
 	}
-	e.changed = true
 }
 
 // InsertLineBelow will attempt to insert a new line below the current position
@@ -958,42 +859,20 @@ func (e *Editor) InsertLineBelow() {
 func (e *Editor) InsertLineBelowAt(index LineIndex) {
 	y := int(index)
 
-	// Make sure no lines are nil
-	e.MakeConsistent()
-
 	// If we are the the last line, add an empty line at the end and return
-	if y == (len(e.lines) - 1) {
-		e.lines[int(y)+1] = make([]rune, 0)
+	if y == (e.lines.Len() - 1) {
+		e.lines.Append([]rune{})
 		e.changed = true
 		return
 	}
 
-	// Create new set of lines, with room for one more
-	lines2 := make(map[int][]rune, len(e.lines)+1)
-
-	// For each line in the old map, if at y, insert a blank line
-	// (insert a blank line below)
-	for k, v := range e.lines {
-		if k < y {
-			lines2[k] = v
-		} else if k == y {
-			lines2[k] = v
-			lines2[k+1] = make([]rune, 0)
-		} else if k > y {
-			lines2[k+1] = v
-		}
+	// Insert a blank line below, if y is within the document
+	if y >= 0 && y < e.lines.Len() {
+		e.lines.Insert(y+1, []rune{})
 	}
-	// Use the new set of lines
-	e.lines = lines2
 
 	// Skip trailing newlines after this line
-	for i := len(e.lines); i > y; i-- {
-		if len(e.lines[i]) == 0 {
-			delete(e.lines, i)
-		} else {
-			break
-		}
-	}
+	e.trimEmptyLinesAfter(y)
 
 	e.changed = true
 }
@@ -1006,48 +885,34 @@ func (e *Editor) Insert(r rune) {
 
 	y := int(e.DataY())
 
-	// If there are no lines, initialize and set the 0th rune to the given one
-	if e.lines == nil {
-		e.lines = make(map[int][]rune)
-		e.lines[0] = []rune{r}
+	// If the current line does not exist, initialize it with a line that is just the given rune
+	if !e.lines.Has(y) {
+		e.lines.Set(y, []rune{r})
 		return
 	}
-
-	// If the current line is empty, initialize it with a line that is just the given rune
-	_, ok := e.lines[y]
-	if !ok {
-		e.lines[y] = []rune{r}
-		return
-	}
-	if len(e.lines[y]) < x {
+	line := e.lines.Line(y)
+	if len(line) < x {
 		// Can only insert in the existing block of text
 		return
 	}
-	newlineLength := len(e.lines[y]) + 1
+	newlineLength := len(line) + 1
 	newline := make([]rune, newlineLength)
 	for i := 0; i < x; i++ {
-		newline[i] = e.lines[y][i]
+		newline[i] = line[i]
 	}
 	newline[x] = r
 	for i := x + 1; i < newlineLength; i++ {
-		newline[i] = e.lines[y][i-1]
+		newline[i] = line[i-1]
 	}
-	e.lines[y] = newline
+	e.lines.Set(y, newline)
 
 	e.changed = true
-
-	// Make sure no lines are nil
-	e.MakeConsistent()
 }
 
 // CreateLineIfMissing will create a line at the given Y index, if it's missing
 func (e *Editor) CreateLineIfMissing(n LineIndex) {
-	if e.lines == nil {
-		e.lines = make(map[int][]rune)
-	}
-	_, ok := e.lines[int(n)]
-	if !ok {
-		e.lines[int(n)] = make([]rune, 0)
+	if !e.lines.Has(int(n)) {
+		e.lines.Set(int(n), []rune{})
 		e.changed = true
 	}
 }
@@ -1076,7 +941,7 @@ func (e *Editor) SetRainbow(rainbowParenthesis bool) {
 // Any previous contents of that line is removed.
 func (e *Editor) SetLine(n LineIndex, s string) {
 	e.CreateLineIfMissing(n)
-	e.lines[int(n)] = make([]rune, 0)
+	e.lines.Set(int(n), []rune{})
 	counter := 0
 	// It's important not to use the index value when looping over a string,
 	// unless the byte index is what one's after, as opposed to the rune index.
@@ -1103,7 +968,7 @@ func (e *Editor) SplitLine() bool {
 	y := e.DataY()
 
 	// Get the contents of this line
-	runeLine := e.lines[int(y)]
+	runeLine := e.lines.Line(int(y))
 	if len(runeLine) < 2 {
 		// Did not split
 		return false
@@ -1130,7 +995,7 @@ func (e *Editor) DataX() (int, error) {
 	found := false
 	dataX := 0
 	runeCounter := 0
-	for _, r := range e.lines[dataY] {
+	for _, r := range e.lines.Line(dataY) {
 		// When we reached the correct screen position, use i as the data position
 		if screenCounter == (e.pos.sx + e.pos.offsetX) {
 			dataX = runeCounter
@@ -1175,30 +1040,24 @@ func (e *Editor) NextLine(y LineIndex, c *vt100.Canvas, status *StatusBar) {
 // InsertBelow will insert the given rune at the start of the line below,
 // starting a new line if required.
 func (e *Editor) InsertBelow(y int, r rune) {
-	if _, ok := e.lines[y+1]; !ok {
-		// If the next line does not exist, create one containing just "r"
-		e.lines[y+1] = []rune{r}
-	} else if len(e.lines[y+1]) > 0 {
+	if nextLine := e.lines.Line(y + 1); len(nextLine) > 0 {
 		// If the next line is non-empty, insert "r" at the start
-		e.lines[y+1] = append([]rune{r}, e.lines[y+1][:]...)
+		e.lines.Set(y+1, append([]rune{r}, nextLine...))
 	} else {
-		// The next line exists, but is of length 0, should not happen, just replace it
-		e.lines[y+1] = []rune{r}
+		// If the next line does not exist or is empty, create one containing just "r"
+		e.lines.Set(y+1, []rune{r})
 	}
 }
 
 // InsertStringBelow will insert the given string at the start of the line below,
 // starting a new line if required.
 func (e *Editor) InsertStringBelow(y int, s string) {
-	if _, ok := e.lines[y+1]; !ok {
-		// If the next line does not exist, create one containing the string
-		e.lines[y+1] = []rune(s)
-	} else if len(e.lines[y+1]) > 0 {
+	if nextLine := e.lines.Line(y + 1); len(nextLine) > 0 {
 		// If the next line is non-empty, insert the string at the start
-		e.lines[y+1] = append([]rune(s), e.lines[y+1][:]...)
+		e.lines.Set(y+1, append([]rune(s), nextLine...))
 	} else {
-		// The next line exists, but is of length 0, should not happen, just replace it
-		e.lines[y+1] = []rune(s)
+		// If the next line does not exist or is empty, create one containing the string
+		e.lines.Set(y+1, []rune(s))
 	}
 }
 
@@ -1243,8 +1102,8 @@ func (e *Editor) LeftRune() rune {
 	x, err := e.DataX()
 	if err != nil {
 		// This is after the line contents, return the last rune
-		runes, ok := e.lines[int(y)]
-		if !ok || len(runes) == 0 {
+		runes := e.lines.Line(int(y))
+		if len(runes) == 0 {
 			return rune(0)
 		}
 		// Return the last rune
@@ -1905,13 +1764,12 @@ func (e *Editor) Block(n LineIndex) string {
 	var (
 		bb, lb strings.Builder // block string builder and line string builder
 		line   []rune
-		ok     bool
 		s      string
 	)
 	for {
-		line, ok = e.lines[int(n)]
+		line = e.lines.Line(int(n))
 		n++
-		if !ok || len(line) == 0 {
+		if len(line) == 0 {
 			// End of document, empty line or invalid line: end of block
 			return bb.String()
 		}
@@ -2059,7 +1917,8 @@ func (e *Editor) AbsFilename() (string, error) {
 
 // Switch replaces the current editor with a new Editor that opens the given file.
 // The undo stack is also swapped.
-// Only works for switching to one file, and then back again.
+// The previous file is kept, so that switching back to it is fast and keeps its undo stack,
+// but only the most recent previous file is kept.
 func (e *Editor) Switch(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, filenameToOpen string) error {
 	absFilename, err := e.AbsFilename()
 	if err != nil {
@@ -2079,27 +1938,38 @@ func (e *Editor) Switch(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *
 	// Save the current location in the location history and write it to file
 	e.SaveLocation(absFilename, locationHistory)
 
+	// Save the undo history for the current file
+	undo.SaveHistory(e, absFilename)
+
 	var (
 		e2             *Editor
 		statusMessage  string
 		displayedImage bool
 	)
 
-	if switchBuffer.Len() == 1 {
-		// Load the Editor from the switchBuffer if switchBuffer has length 1, then use that editor.
-		switchBuffer.Restore(e)
+	// Check if the file to switch to is the one that was switched from
+	switchBack := false
+	if switchBuffer != nil {
+		absSwitchBufferFilename, err1 := switchBuffer.AbsFilename()
+		absFilenameToOpen, err2 := filepath.Abs(filenameToOpen)
+		switchBack = err1 == nil && err2 == nil && absSwitchBufferFilename == filepath.Clean(absFilenameToOpen)
+	}
+
+	if switchBack {
+		// Load the Editor from the switchBuffer if it has been saved, then use that editor.
+		*e = *switchBuffer
+		switchBuffer = nil
 		undo, switchUndoBackup = switchUndoBackup, undo
 	} else {
 		fnord := FilenameOrData{filenameToOpen, []byte{}, 0, false}
 		e2, statusMessage, displayedImage, err = NewEditor(tty, c, fnord, LineNumber(0), ColNumber(0), e.Theme, e.syntaxHighlight, false, e.monitorAndReadOnly)
 		if err == nil { // no issue
-			// Save the current Editor to the switchBuffer if switchBuffer if empty, then use the new editor.
-			switchBuffer.Snapshot(e)
+			// Save the current Editor to the switchBuffer, then use the new editor.
+			savedEditor := *e
+			switchBuffer = &savedEditor
 
 			// Now use e2 as the current editor
 			*e = *e2
-			(*e).lines = (*e2).lines
-			(*e).pos = (*e2).pos
 		} else if displayedImage {
 			panic("displayed an image while switching from one Editor struct to another")
 		} else {
@@ -2107,7 +1977,13 @@ func (e *Editor) Switch(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *
 			panic(err)
 		}
 		fnord.SetTitle()
-		undo, switchUndoBackup = switchUndoBackup, undo
+		// Keep the undo stack of the current file, and start with an empty one for the new file
+		switchUndoBackup = undo
+		undo = NewUndo(defaultUndoCount, defaultUndoMemory)
+		// Load the undo history for the file that was switched to, if available
+		if absFilenameToOpen, err := e.AbsFilename(); err == nil { // no error
+			undo.LoadHistory(e, absFilenameToOpen)
+		}
 	}
 
 	if statusMessage != "" {
@@ -2149,11 +2025,11 @@ func (e *Editor) LineContentsFromCursorPosition() string {
 // The word may contain numbers or dashes, but not spaces or special characters.
 func (e *Editor) WordAtCursor() string {
 	y := int(e.DataY())
-	runes, ok := e.lines[y]
-	if !ok {
+	if !e.lines.Has(y) {
 		// This should never happen
 		return ""
 	}
+	runes := e.lines.Line(y)
 
 	// Check if there are letters on the current line
 	if len(runes) == 0 {
@@ -2208,11 +2084,11 @@ func (e *Editor) WordAtCursor() string {
 // LettersBeforeCursor returns the current word up until the cursor (for autocompletion)
 func (e *Editor) LettersBeforeCursor() string {
 	y := int(e.DataY())
-	runes, ok := e.lines[y]
-	if !ok {
+	if !e.lines.Has(y) {
 		// This should never happen
 		return ""
 	}
+	runes := e.lines.Line(y)
 	// Either find x or use the last index of the line
 	x, err := e.DataX()
 	if err != nil {
@@ -2243,11 +2119,11 @@ func (e *Editor) LettersBeforeCursor() string {
 // Will also include ".".
 func (e *Editor) LettersOrDotBeforeCursor() string {
 	y := int(e.DataY())
-	runes, ok := e.lines[y]
-	if !ok {
+	if !e.lines.Has(y) {
 		// This should never happen
 		return ""
 	}
+	runes := e.lines.Line(y)
 	// Either find x or use the last index of the line
 	x, err := e.DataX()
 	if err != nil {
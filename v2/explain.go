@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xyproto/env/v2"
+	"github.com/xyproto/vt100"
+)
+
+const (
+	explainContextLines = 10               // the number of lines above and below the error that are sent along with it
+	explainTimeout      = 90 * time.Second // the maximum time to wait for the AI backend to explain a problem
+	explainPrompt       = "This %s code fails to build, with this error on line %d:\n\n%s\n\nFirst explain the error in one or two short sentences, without using Markdown. Then output all of the lines below, with as few changes as possible to fix the error, in a single fenced code block. Keep the indentation, and do not add line numbers or any text after the code block. These are lines %d to %d:\n\n```\n%s\n```\n"
+)
+
+var (
+	errNoFixSuggested = errors.New("no fix was suggested")
+	errExplainTimeout = errors.New("the AI backend did not respond in time")
+)
+
+// CanExplainProblem checks if there are build errors or warnings that can be sent to the AI backend
+func (e *Editor) CanExplainProblem() bool {
+	return aiProvider != nil && HasProblems() && len(e.problemLines()) > 0
+}
+
+// problemToExplain returns the problem at the current line, or else the first error in the current file,
+// or else the first warning in the current file
+func (e *Editor) problemToExplain() (Problem, error) {
+	lines := e.problemLines()
+	if len(lines) == 0 {
+		return Problem{}, errNoProblems
+	}
+	if p, ok := lines[e.DataY()]; ok {
+		return p, nil
+	}
+	ps := make([]Problem, 0, len(lines))
+	for _, p := range lines {
+		ps = append(ps, p)
+	}
+	sort.Slice(ps, func(i, j int) bool {
+		if ps[i].Warning != ps[j].Warning {
+			return !ps[i].Warning
+		}
+		return ps[i].Line < ps[j].Line
+	})
+	return ps[0], nil
+}
+
+// parseSuggestedFix splits a response from the AI backend into the explanation that comes before the
+// first fenced code block, and the lines within the code block. ok is false if there is no complete code block.
+func parseSuggestedFix(response string) (explanation string, fix []string, ok bool) {
+	lines := strings.Split(strings.ReplaceAll(response, "\r\n", "\n"), "\n")
+	var explanationLines []string
+	inBlock := false
+	for _, line := range lines {
+		isFence := strings.HasPrefix(strings.TrimSpace(line), "```")
+		switch {
+		case !inBlock && isFence:
+			inBlock = true
+			fix = []string{}
+		case inBlock && isFence:
+			return strings.TrimSpace(strings.Join(explanationLines, "\n")), fix, true
+		case inBlock:
+			fix = append(fix, strings.TrimRight(line, " \t"))
+		default:
+			explanationLines = append(explanationLines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(explanationLines, "\n")), nil, false
+}
+
+// lineDiff returns the difference between the old and the new lines as a unified diff hunk, with one line
+// of context around the changed lines. firstLineNumber is the line number of the first of the old lines.
+// Returns an empty string if the lines are the same.
+func lineDiff(oldLines, newLines []string, firstLineNumber LineNumber) string {
+	// Skip the lines that are the same at the start and at the end
+	start := 0
+	for start < len(oldLines) && start < len(newLines) && oldLines[start] == newLines[start] {
+		start++
+	}
+	if start == len(oldLines) && start == len(newLines) {
+		return ""
+	}
+	oldEnd, newEnd := len(oldLines), len(newLines)
+	for oldEnd > start && newEnd > start && oldLines[oldEnd-1] == newLines[newEnd-1] {
+		oldEnd--
+		newEnd--
+	}
+
+	// One line of context before and after
+	before, after := start, oldEnd
+	if before > 0 {
+		before--
+	}
+	if after < len(oldLines) {
+		after++
+	}
+	contextAfter := after - oldEnd
+
+	var sb strings.Builder
+	oldCount := after - before
+	newCount := (start - before) + (newEnd - start) + contextAfter
+	sb.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", int(firstLineNumber)+before, oldCount, int(firstLineNumber)+before, newCount))
+	for _, line := range oldLines[before:start] {
+		sb.WriteString(" " + line + "\n")
+	}
+	for _, line := range oldLines[start:oldEnd] {
+		sb.WriteString("-" + line + "\n")
+	}
+	for _, line := range newLines[start:newEnd] {
+		sb.WriteString("+" + line + "\n")
+	}
+	for _, line := range oldLines[oldEnd:after] {
+		sb.WriteString(" " + line + "\n")
+	}
+	return sb.String()
+}
+
+// ExplainProblem sends the build error at the current line, or the first build error in the current file,
+// together with the surrounding lines and the declarations in the file, to the AI backend.
+// The explanation and the suggested fix are shown as a diff, and the fix is applied as one undo step
+// if the user confirms it. Esc or ctrl-q stops the request, and it is also stopped after explainTimeout.
+func (e *Editor) ExplainProblem(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, undo *Undo) error {
+	if aiProvider == nil {
+		return errNoAIBackend
+	}
+	p, err := e.problemToExplain()
+	if err != nil {
+		return err
+	}
+
+	// The lines around the problem
+	problemIndex := p.Line.LineIndex()
+	if int(problemIndex) >= e.Len() {
+		problemIndex = LineIndex(e.Len() - 1)
+	}
+	from := int(problemIndex) - explainContextLines
+	if from < 0 {
+		from = 0
+	}
+	to := int(problemIndex) + explainContextLines + 1
+	if to > e.Len() {
+		to = e.Len()
+	}
+	oldLines := make([]string, 0, to-from)
+	for i := from; i < to; i++ {
+		oldLines = append(oldLines, e.Line(LineIndex(i)))
+	}
+
+	prompt := fmt.Sprintf(explainPrompt, e.mode, p.Line, p.Message, from+1, to, strings.Join(oldLines, "\n"))
+	if declarationContext := e.PromptContext(aiProvider.ContextTokens() / 4); declarationContext != "" {
+		prompt = declarationContext + "\n\n" + prompt
+	}
+	maxTokens := aiProvider.ContextTokens() - countTokens(prompt)
+	if maxTokens < 1 {
+		return errors.New("AI API request is too long")
+	}
+
+	title := fmt.Sprintf("Line %d: %s", p.Line, p.Message)
+	status.ClearAll(c)
+	status.SetMessage("Asking AI about line " + p.Line.String() + "...")
+	status.ShowNoTimeout(c, e)
+
+	// Show the response as it arrives, while waiting for esc or ctrl-q, which stops it.
+	// Only one key is read at a time, and only when needed, so that no key press is lost when returning.
+	keys := make(chan string)
+	readKey := func() {
+		go func() {
+			keys <- tty.String()
+		}()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), explainTimeout)
+	defer cancel()
+	done := make(chan error, 1)
+	var response string
+	temperature := env.Float32("CHATGPT_TEMPERATURE", 0)
+	go func() {
+		done <- aiProvider.Stream(ctx, []AIMessage{{Role: "user", Content: prompt}}, maxTokens, temperature, func(token string) {
+			response += token
+			e.DrawOutput(c, 20, title, strings.ReplaceAll(strings.TrimSpace(response), "\t", "    "), e.DebugRegistersBackground, true)
+		})
+	}()
+	readKey()
+	stopped := false
+WAIT:
+	for {
+		select {
+		case err = <-done:
+			break WAIT
+		case key := <-keys:
+			if key == "c:27" || key == "c:17" { // esc or ctrl-q
+				cancel()
+				stopped = true
+				err = <-done
+				break WAIT
+			}
+			readKey()
+		}
+	}
+	e.redraw = true
+	e.redrawCursor = true
+	if stopped {
+		status.ClearAll(c)
+		status.SetMessageAfterRedraw("Stopped")
+		return nil
+	}
+
+	// A key is still being read. showAndWait shows the given message or error and waits for that key press.
+	showAndWait := func(msg string, err error) error {
+		status.ClearAll(c)
+		if err != nil {
+			status.SetError(err)
+		} else {
+			status.SetMessage(msg)
+		}
+		status.ShowNoTimeout(c, e)
+		<-keys
+		status.ClearAll(c)
+		return nil
+	}
+	if err != nil && ctx.Err() == nil {
+		return showAndWait("", err)
+	}
+	explanation, newLines, ok := parseSuggestedFix(response)
+	explanationLines := wrapWords(strings.Fields(explanation), 72, "")
+	if !ok {
+		if ctx.Err() != nil {
+			return showAndWait("", errExplainTimeout)
+		}
+		if len(explanationLines) == 0 {
+			return showAndWait("", errNoFixSuggested)
+		}
+		e.DrawOutput(c, 20, title, strings.Join(explanationLines, "\n"), e.DebugRunningBackground, true)
+		return showAndWait("No fix was suggested, press any key to continue", nil)
+	}
+	diff := lineDiff(oldLines, newLines, LineNumber(from+1))
+	if diff == "" {
+		return showAndWait("", errNoFixSuggested)
+	}
+
+	// Show the explanation and the diff, and ask the user
+	output := strings.Join(append(explanationLines, "", strings.TrimRight(diff, "\n")), "\n")
+	e.DrawOutput(c, 20, title, strings.ReplaceAll(output, "\t", "    "), e.DebugRunningBackground, true)
+	status.ClearAll(c)
+	status.SetMessage("Apply the fix? (y/n)")
+	status.ShowNoTimeout(c, e)
+	for {
+		switch <-keys {
+		case "y", "Y", "c:13":
+			undo.Snapshot(e)
+			replacement := make([][]rune, len(newLines))
+			for i, line := range newLines {
+				replacement[i] = []rune(line)
+			}
+			e.lines.Splice(from, len(oldLines), replacement)
+			e.changed = true
+			e.GoToLineNumber(p.Line, c, status, true)
+			status.ClearAll(c)
+			status.SetMessageAfterRedraw("Applied the fix, press ctrl-z to undo")
+			return nil
+		case "n", "N", "q", "Q", "c:27", "c:17":
+			status.ClearAll(c)
+			status.SetMessageAfterRedraw("The fix was not applied")
+			return nil
+		}
+		readKey()
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSuggestedFix(t *testing.T) {
+	response := "The variable `x` is declared but never used.\nRemove it.\n\n```go\nfunc main() {\n\tfmt.Println(\"hi\")  \n}\n```\n"
+	explanation, fix, ok := parseSuggestedFix(response)
+	if !ok {
+		t.Fatal("expected a fix")
+	}
+	if explanation != "The variable `x` is declared but never used.\nRemove it." {
+		t.Fatalf("unexpected explanation: %q", explanation)
+	}
+	if strings.Join(fix, "\n") != "func main() {\n\tfmt.Println(\"hi\")\n}" {
+		t.Fatalf("unexpected fix: %q", fix)
+	}
+
+	// The code block has not been completed, for instance if the response was stopped
+	if _, _, ok := parseSuggestedFix("Explanation.\n```c\nint main() {\n"); ok {
+		t.Fatal("expected no fix for an incomplete code block")
+	}
+	if explanation, _, ok := parseSuggestedFix("There is nothing to fix."); ok || explanation != "There is nothing to fix." {
+		t.Fatalf("expected only an explanation, got %q", explanation)
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	oldLines := []string{"a", "b", "c", "d", "e"}
+	if diff := lineDiff(oldLines, oldLines, 10); diff != "" {
+		t.Fatalf("expected no diff, got %q", diff)
+	}
+	diff := lineDiff(oldLines, []string{"a", "b", "C", "C2", "d", "e"}, 10)
+	expected := "@@ -11,3 +11,4 @@\n b\n-c\n+C\n+C2\n d\n"
+	if diff != expected {
+		t.Fatalf("expected %q, got %q", expected, diff)
+	}
+	// A change on the first line has no context line before it
+	diff = lineDiff(oldLines, []string{"b", "c", "d", "e"}, 1)
+	expected = "@@ -1,2 +1,1 @@\n-a\n b\n"
+	if diff != expected {
+		t.Fatalf("expected %q, got %q", expected, diff)
+	}
+}
+
+func TestProblemToExplain(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "main.go")
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	if _, err := e.problemToExplain(); err != errNoProblems {
+		t.Fatalf("expected errNoProblems, got %v", err)
+	}
+
+	SetProblems([]Problem{
+		{filename, "a warning", 1, 1, true},
+		{filename, "the second error", 5, 1, false},
+		{filename, "the first error", 3, 1, false},
+		{filepath.Join(dir, "other.go"), "elsewhere", 2, 1, false},
+	}, false)
+	defer SetProblems(nil, false)
+
+	// The cursor is at the first line, which has a warning
+	if p, err := e.problemToExplain(); err != nil || p.Message != "a warning" {
+		t.Fatalf("expected the warning at the current line, got %+v, %v", p, err)
+	}
+	SetProblems([]Problem{
+		{filename, "a warning", 2, 1, true},
+		{filename, "the second error", 5, 1, false},
+		{filename, "the first error", 3, 1, false},
+	}, false)
+	if p, err := e.problemToExplain(); err != nil || p.Message != "the first error" {
+		t.Fatalf("expected the first error in the file, got %+v, %v", p, err)
+	}
+}
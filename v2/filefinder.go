@@ -0,0 +1,330 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"unicode"
+
+	"github.com/xyproto/vt100"
+)
+
+// the maximum number of files to list in the file finder
+const fileFinderMaxFiles = 20000
+
+// ProjectFiles returns the regular files under the given directory, relative to the directory.
+// In a git repository, the tracked files and the untracked files that are not ignored are listed.
+// Otherwise, the .git and vendor directories are skipped.
+func ProjectFiles(root string, maxFiles int) []string {
+	if filenames, err := gitFiles(root, maxFiles); err == nil {
+		return filenames
+	}
+	var filenames []string
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // skip files and directories that can not be read
+		}
+		if d.IsDir() {
+			if path != root && hasS(grepSkipDirs, d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if rel, err := filepath.Rel(root, path); err == nil {
+			filenames = append(filenames, rel)
+		}
+		if len(filenames) >= maxFiles {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return filenames
+}
+
+// gitFiles returns the files in the git repository at the given directory, relative to the directory,
+// by using "git ls-files". Files that are ignored, and tracked files that have been removed, are left out.
+func gitFiles(root string, maxFiles int) ([]string, error) {
+	if _, err := os.Stat(filepath.Join(root, ".git")); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("git", "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+	cmd.Dir = root
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var filenames []string
+	for _, filename := range strings.Split(string(output), "\x00") {
+		if filename == "" {
+			continue
+		}
+		filename = filepath.FromSlash(filename)
+		if fi, err := os.Lstat(filepath.Join(root, filename)); err != nil || !fi.Mode().IsRegular() {
+			continue // removed, a submodule or a symlink
+		}
+		filenames = append(filenames, filename)
+		if len(filenames) >= maxFiles {
+			break
+		}
+	}
+	return filenames, nil
+}
+
+// fuzzyScore checks if the letters of the query appear in the given filename, in order, ignoring case.
+// Returns a score where higher is better, and false if the filename does not match.
+// Consecutive letters, letters at the start of a word and letters in the base name give a higher score.
+func fuzzyScore(filename, query string) (int, bool) {
+	var (
+		runes     = []rune(strings.ToLower(filename))
+		baseStart = len([]rune(filename)) - len([]rune(filepath.Base(filename)))
+		score     int
+		prev      = -2
+		i         int
+	)
+	for _, q := range strings.ToLower(query) {
+		if unicode.IsSpace(q) {
+			continue
+		}
+		for i < len(runes) && runes[i] != q {
+			i++
+		}
+		if i >= len(runes) {
+			return 0, false
+		}
+		score++
+		if i == prev+1 {
+			score += 5 // consecutive letters
+		}
+		if i == 0 || strings.ContainsRune("/\\._- ", runes[i-1]) {
+			score += 3 // the start of a word
+		}
+		if i >= baseStart {
+			score += 2 // in the base name
+		}
+		prev = i
+		i++
+	}
+	// Prefer shorter filenames
+	return score*100 - len(runes), true
+}
+
+// RankFiles returns the filenames (relative to root) that match the query, best match first.
+// Files that have been opened recently, according to the location history, are ranked higher.
+func RankFiles(filenames []string, query, root string, history LocationHistory) []string {
+	// Give the most recently opened files a bonus, the most recent first
+	type recent struct {
+		filename string
+		unix     int64
+	}
+	var recents []recent
+	for _, filename := range filenames {
+		if lnat, ok := history[filepath.Join(root, filename)]; ok {
+			recents = append(recents, recent{filename, lnat.Timestamp.Unix()})
+		}
+	}
+	sort.Slice(recents, func(i, j int) bool { return recents[i].unix > recents[j].unix })
+	bonus := make(map[string]int, len(recents))
+	for i, r := range recents {
+		bonus[r.filename] = max(1, 1000-i*50)
+	}
+
+	type ranked struct {
+		filename string
+		score    int
+	}
+	var matches []ranked
+	for _, filename := range filenames {
+		if score, ok := fuzzyScore(filename, query); ok {
+			matches = append(matches, ranked{filename, score + bonus[filename]})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].filename < matches[j].filename
+	})
+	result := make([]string, len(matches))
+	for i, m := range matches {
+		result[i] = m.filename
+	}
+	return result
+}
+
+// FileFinderWidget is a TUI widget for fuzzy searching for a file, where the list of files is updated while typing
+type FileFinderWidget struct {
+	title          string               // title, shown before the query
+	query          string               // what has been typed in so far
+	matches        []string             // the matching filenames, best match first
+	titleColor     vt100.AttributeColor // title color
+	arrowColor     vt100.AttributeColor // arrow color (before the highlighted filename)
+	textColor      vt100.AttributeColor // text color (the filenames that are not highlighted)
+	highlightColor vt100.AttributeColor // highlight color (the filename that will be opened if return is pressed)
+	selected       int                  // the index of the highlighted filename
+	offset         int                  // the index of the first filename that is shown, when scrolled down
+	marginLeft     uint                 // margin
+	marginTop      uint                 // margin
+}
+
+// scroll changes the offset so that the highlighted filename is within the given number of visible rows
+func (f *FileFinderWidget) scroll(rows int) {
+	if f.selected < f.offset {
+		f.offset = f.selected
+	} else if f.selected >= f.offset+rows {
+		f.offset = f.selected - rows + 1
+	}
+}
+
+// Draw will draw this file finder widget on the given canvas. The list is scrolled so that the highlighted
+// filename is always visible.
+func (f *FileFinderWidget) Draw(c *vt100.Canvas) {
+	w, h := c.W(), c.H()
+	line := func(y uint, color vt100.AttributeColor, s string) {
+		runes := []rune(s)
+		for x := f.marginLeft; x < w; x++ {
+			r := ' '
+			if i := int(x - f.marginLeft); i < len(runes) {
+				r = runes[i]
+			}
+			c.PlotColor(x, y, color, r)
+		}
+	}
+	line(f.marginTop, f.titleColor, f.title+" "+f.query)
+	line(f.marginTop+1, f.titleColor, "")
+	if f.marginTop+2 >= h {
+		return
+	}
+	rows := int(h - f.marginTop - 2)
+	f.scroll(rows)
+	for i := 0; i < rows; i++ {
+		y := f.marginTop + 2 + uint(i)
+		index := f.offset + i
+		switch {
+		case index >= len(f.matches):
+			line(y, f.textColor, "")
+		case index == f.selected:
+			line(y, f.arrowColor, "->")
+			for x, r := range []rune(f.matches[index]) {
+				if f.marginLeft+3+uint(x) >= w {
+					break
+				}
+				c.PlotColor(f.marginLeft+3+uint(x), y, f.highlightColor, r)
+			}
+		default:
+			line(y, f.textColor, "   "+f.matches[index])
+		}
+	}
+}
+
+// FileFinder lets the user fuzzy search for a file under the given directory, while the list of files
+// is updated while typing. Returns the selected filename, relative to root, or "" if nothing was selected.
+func (e *Editor) FileFinder(status *StatusBar, tty *vt100.TTY, root string) string {
+	// Clear the existing handler
+	signal.Reset(syscall.SIGWINCH)
+
+	var (
+		filenames = ProjectFiles(root, fileFinderMaxFiles)
+		c         = vt100.NewCanvas()
+		finder    = &FileFinderWidget{
+			title:          "Open file:",
+			titleColor:     e.MenuTitleColor,
+			arrowColor:     e.MenuArrowColor,
+			textColor:      e.MenuTextColor,
+			highlightColor: e.MenuHighlightColor,
+			marginLeft:     2,
+			marginTop:      1,
+		}
+		sigChan  = make(chan os.Signal, 1)
+		selected string
+	)
+	finder.matches = RankFiles(filenames, "", root, locationHistory)
+
+	// Set up a new resize handler
+	signal.Notify(sigChan, syscall.SIGWINCH)
+	go func() {
+		for range sigChan {
+			resizeMut.Lock()
+			if nc := c.Resized(); nc != nil {
+				vt100.Clear()
+				c = nc
+				c.FillBackground(e.Background)
+				finder.Draw(c)
+				c.Redraw()
+			}
+			resizeMut.Unlock()
+		}
+	}()
+
+	vt100.Clear()
+	vt100.Reset()
+	c.FillBackground(e.Background)
+	c.Redraw()
+
+	for running := true; running; {
+		resizeMut.RLock()
+		finder.Draw(c)
+		resizeMut.RUnlock()
+		c.Draw()
+
+		key := tty.String()
+		resizeMut.Lock()
+		switch key {
+		case "↑", "c:16": // up or ctrl-p
+			if finder.selected > 0 {
+				finder.selected--
+			}
+		case "↓", "c:14": // down or ctrl-n
+			if finder.selected < len(finder.matches)-1 {
+				finder.selected++
+			}
+		case "c:27", "c:17", "c:3", "c:15": // esc, ctrl-q, ctrl-c or ctrl-o
+			running = false
+		case "c:13": // return
+			if finder.selected < len(finder.matches) {
+				selected = finder.matches[finder.selected]
+			}
+			running = false
+		case "c:8", "c:127": // ctrl-h or backspace
+			if runes := []rune(finder.query); len(runes) > 0 {
+				finder.query = string(runes[:len(runes)-1])
+				finder.matches = RankFiles(filenames, finder.query, root, locationHistory)
+				finder.selected, finder.offset = 0, 0
+			}
+		default:
+			if runes := []rune(key); len(runes) == 1 && unicode.IsPrint(runes[0]) {
+				finder.query += key
+				finder.matches = RankFiles(filenames, finder.query, root, locationHistory)
+				finder.selected, finder.offset = 0, 0
+			}
+		}
+		resizeMut.Unlock()
+	}
+
+	// Restore the resize handler
+	e.SetUpSignalHandlers(c, tty, status)
+
+	return selected
+}
+
+// OpenFileWithFinder lets the user select a file in the current project with the file finder, and then opens it.
+// The undo stack of the current file is kept, so that switching back to it is possible.
+func (e *Editor) OpenFileWithFinder(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper) error {
+	root := ProjectRoot(e.filename)
+	filename := e.FileFinder(status, tty, root)
+	if filename == "" {
+		return nil
+	}
+	absFilename := filepath.Join(root, filename)
+	if current, err := e.AbsFilename(); err == nil && current == absFilename {
+		return nil
+	}
+	return e.Switch(c, tty, status, lk, absFilename)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	if _, ok := fuzzyScore("v2/keyloop.go", "kl"); !ok {
+		t.Error("expected kl to match keyloop.go")
+	}
+	if _, ok := fuzzyScore("v2/keyloop.go", "lk"); ok {
+		t.Error("expected lk to not match keyloop.go, the letters are in the wrong order")
+	}
+	exact, _ := fuzzyScore("v2/undo.go", "undo")
+	scattered, _ := fuzzyScore("v2/underscore_do.go", "undo")
+	if exact <= scattered {
+		t.Errorf("expected consecutive letters to score higher, got %d and %d", exact, scattered)
+	}
+}
+
+func TestRankFiles(t *testing.T) {
+	root := "/project"
+	filenames := []string{"a/main.go", "b/main.go", "c/other.go"}
+	history := LocationHistory{}
+	history[filepath.Join(root, "b/main.go")] = LineNumberAndTimestamp{1, time.Now()}
+	history[filepath.Join(root, "c/other.go")] = LineNumberAndTimestamp{1, time.Now().Add(-time.Hour)}
+
+	ranked := RankFiles(filenames, "main", root, history)
+	if len(ranked) != 2 || ranked[0] != "b/main.go" {
+		t.Errorf("expected the recently opened b/main.go to be first, got %v", ranked)
+	}
+
+	ranked = RankFiles(filenames, "", root, history)
+	if len(ranked) != 3 || ranked[0] != "b/main.go" || ranked[1] != "c/other.go" || ranked[2] != "a/main.go" {
+		t.Errorf("expected the files to be ordered by recency when nothing has been typed, got %v", ranked)
+	}
+}
+
+func TestProjectFilesGitIgnore(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	if err := exec.Command("git", "init", "-q", dir).Run(); err != nil {
+		t.Skip("could not create a git repository")
+	}
+	for filename, contents := range map[string]string{
+		".gitignore":    "build/\n",
+		"main.go":       "package main\n",
+		"build/main.o":  "",
+		"sub/README.md": "",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(filename))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filenames := ProjectFiles(dir, fileFinderMaxFiles)
+	sort.Strings(filenames)
+	expected := []string{".gitignore", "main.go", filepath.Join("sub", "README.md")}
+	if strings.Join(filenames, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected the ignored files to be left out, got %v", filenames)
+	}
+}
+
+func TestFileFinderScroll(t *testing.T) {
+	f := &FileFinderWidget{matches: []string{"a", "b", "c", "d", "e", "f", "g", "h"}}
+	f.selected = 6
+	f.scroll(5)
+	if f.offset != 2 {
+		t.Errorf("expected the list to scroll down to offset 2, got %d", f.offset)
+	}
+	f.selected = 1
+	f.scroll(5)
+	if f.offset != 1 {
+		t.Errorf("expected the list to scroll up to offset 1, got %d", f.offset)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xyproto/binary"
+	"github.com/xyproto/vt100"
+)
+
+const (
+	// the maximum number of matches to collect when searching in all files
+	grepMaxMatches = 1000
+
+	// files larger than this are not searched
+	grepMaxFileSize = 4 * 1024 * 1024
+
+	// the search in all files stops after this long, so that the editor does not hang in a huge directory
+	grepMaxDuration = 3 * time.Second
+)
+
+var (
+	// the results of the most recent search in all files, for stepping through them with ctrl-n and ctrl-p.
+	// These are guarded by problemsMut, since a build in the background may replace them with problems.
+	grepMatches    []GrepMatch
+	grepIndex      int
+	grepSearchTerm string
+
+	// directories that are skipped when searching in all files outside of a git repository
+	grepSkipDirs = []string{".git", "vendor"}
+)
+
+// GrepMatch is a line in a file that matches a search term
+type GrepMatch struct {
+	Filename string     // the absolute filename
+	Text     string     // the matching line
+	Line     LineNumber // the line number of the match
+	X        int        // the rune index of the match
+}
+
+// FindInFiles searches the files under the given directory for the given search term, which is a regular
+// expression if searching for regular expressions is enabled. The files are listed with ProjectFiles, so
+// that files ignored by git are skipped, and binary files are skipped too. At most maxMatches matches are
+// returned, and the search stops with the matches so far when it has taken longer than grepMaxDuration.
+func FindInFiles(root, searchFor string, maxMatches int) ([]GrepMatch, error) {
+	if searchFor == "" {
+		return nil, errors.New("nothing to search for")
+	}
+	var (
+		matches []GrepMatch
+		start   = time.Now()
+	)
+OUT:
+	for _, filename := range ProjectFiles(root, fileFinderMaxFiles) {
+		if time.Since(start) > grepMaxDuration {
+			break
+		}
+		path := filepath.Join(root, filename)
+		if info, err := os.Stat(path); err != nil || info.Size() > grepMaxFileSize {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || binary.Data(data) {
+			continue
+		}
+		for i, line := range strings.Split(string(data), "\n") {
+			if index := searchIndex(line, searchFor); index != -1 {
+				line = strings.TrimRight(line, "\r")
+				matches = append(matches, GrepMatch{path, line, LineNumber(i + 1), utf8.RuneCountInString(line[:min(index, len(line))])})
+				if len(matches) >= maxMatches {
+					break OUT
+				}
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return nil, errNoSearchMatch
+	}
+	return matches, nil
+}
+
+// GrepStepping checks if ctrl-n and ctrl-p should step through the results of the most recent search in all files
+func GrepStepping() bool {
+	problemsMut.RLock()
+	defer problemsMut.RUnlock()
+	return len(grepMatches) > 0
+}
+
+// GoToGrepMatch opens the file of the given match, if it is not already open, and moves the cursor to the match
+func (e *Editor) GoToGrepMatch(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, m GrepMatch) error {
+	problemsMut.RLock()
+	searchTerm := grepSearchTerm
+	problemsMut.RUnlock()
+	if absFilename, err := e.AbsFilename(); err != nil || absFilename != m.Filename {
+		if err := e.Switch(c, tty, status, lk, m.Filename); err != nil {
+			return err
+		}
+	}
+	// Highlight the search term, also in a file that was just opened
+	e.searchTerm = searchTerm
+	e.stickySearchTerm = searchTerm
+	e.GoToLineNumber(m.Line, c, status, true)
+	e.setDataCursor(c, Cursor{m.X, m.Line.LineIndex()})
+	e.HorizontalScrollIfNeeded(c)
+	e.redraw = true
+	e.redrawCursor = true
+	return nil
+}
+
+// NextGrepMatch goes to the next (or previous) result of the most recent search in all files, with wraparound
+func (e *Editor) NextGrepMatch(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, forward bool) error {
+	problemsMut.Lock()
+	count := len(grepMatches)
+	if count == 0 {
+		problemsMut.Unlock()
+		return errNoSearchMatch
+	}
+	if forward {
+		grepIndex = (grepIndex + 1) % count
+	} else {
+		grepIndex = (grepIndex - 1 + count) % count
+	}
+	index, m := grepIndex, grepMatches[grepIndex]
+	problemsMut.Unlock()
+	if err := e.GoToGrepMatch(c, tty, status, lk, m); err != nil {
+		return err
+	}
+	status.SetMessageAfterRedraw(fmt.Sprintf("Match %d of %d", index+1, count))
+	return nil
+}
+
+// StopStepping makes ctrl-n and ctrl-p scroll and go to the next search match in the current file again,
+// instead of stepping through the results of the last search in all files or the problems from the last build
+func StopStepping() {
+	problemsMut.Lock()
+	grepMatches = nil
+	problemStepping = false
+	problemsMut.Unlock()
+}
+
+// FindInFilesMenu searches all files in the project for the given search term, and presents the matches
+// in a menu, grouped by file. The selected match is then opened, and ctrl-n and ctrl-p can be used for
+// stepping through the rest of the matches.
+func (e *Editor) FindInFilesMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, searchFor string) error {
+	root := ProjectRoot(e.filename)
+	matches, err := FindInFiles(root, searchFor, grepMaxMatches)
+	if err != nil {
+		return err
+	}
+
+	// Group the matches by file
+	var filenames []string
+	byFile := make(map[string][]int)
+	for i, m := range matches {
+		if _, ok := byFile[m.Filename]; !ok {
+			filenames = append(filenames, m.Filename)
+		}
+		byFile[m.Filename] = append(byFile[m.Filename], i)
+	}
+	sort.Strings(filenames)
+
+	// Make room for the menu title and margins
+	maxEntries := 20
+	if c != nil && int(c.H())-6 > 3 {
+		maxEntries = int(c.H()) - 6
+	}
+
+	relative := func(filename string) string {
+		if rel, err := filepath.Rel(root, filename); err == nil {
+			return rel
+		}
+		return filename
+	}
+
+	// Select a file, if there is more than one
+	filename := filenames[0]
+	if len(filenames) > 1 {
+		shown := filenames
+		if len(shown) > maxEntries {
+			shown = shown[:maxEntries]
+		}
+		menuChoices := make([]string, len(shown))
+		for i, fn := range shown {
+			n := len(byFile[fn])
+			if n == 1 {
+				menuChoices[i] = fmt.Sprintf("%s (1 match)", relative(fn))
+			} else {
+				menuChoices[i] = fmt.Sprintf("%s (%d matches)", relative(fn), n)
+			}
+		}
+		selected := e.Menu(status, tty, fmt.Sprintf("%d matches in %d files", len(matches), len(filenames)), menuChoices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, 0, false)
+		if selected < 0 {
+			return nil
+		}
+		filename = shown[selected]
+	}
+
+	// Select a match in the file
+	indices := byFile[filename]
+	if len(indices) > maxEntries {
+		indices = indices[:maxEntries]
+	}
+	menuChoices := make([]string, len(indices))
+	for i, index := range indices {
+		m := matches[index]
+		menuChoices[i] = fmt.Sprintf("%d: %s", m.Line, strings.TrimSpace(m.Text))
+	}
+	selected := e.Menu(status, tty, relative(filename), menuChoices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, 0, false)
+	if selected < 0 {
+		return nil
+	}
+
+	chosen := matches[indices[selected]]
+
+	// Order the matches by file, in the same way as in the menu, so that ctrl-n and ctrl-p step through them in order
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Filename < matches[j].Filename })
+	index := 0
+	for i, m := range matches {
+		if m == chosen {
+			index = i
+			break
+		}
+	}
+	problemsMut.Lock()
+	grepMatches, grepIndex, grepSearchTerm = matches, index, searchFor
+	problemStepping = false
+	problemsMut.Unlock()
+
+	if err := e.GoToGrepMatch(c, tty, status, lk, chosen); err != nil {
+		return err
+	}
+	status.SetMessageAfterRedraw(fmt.Sprintf("Match %d of %d, press ctrl-n or ctrl-p for the next or previous match", index+1, len(matches)))
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindInFiles(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"main.go":           "package main\n\nfunc main() {\n\tneedle()\n}\n",
+		"sub/other.go":      "package sub\n\n// needle and needle\n",
+		"vendor/lib/lib.go": "package lib // needle\n",
+		".git/config":       "needle\n",
+		"image.bin":         "needle\x00\x01\x02\x03\x00\x00\xff",
+	}
+	for name, contents := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	matches, err := FindInFiles(root, "needle", grepMaxMatches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %v", matches)
+	}
+	for _, m := range matches {
+		switch filepath.Base(m.Filename) {
+		case "main.go":
+			if m.Line != 4 || m.X != 1 {
+				t.Errorf("unexpected position of the match in main.go: line %d, x %d", m.Line, m.X)
+			}
+		case "other.go":
+			if m.Line != 3 || m.X != 3 {
+				t.Errorf("unexpected position of the match in other.go: line %d, x %d", m.Line, m.X)
+			}
+		default:
+			t.Errorf("unexpected match in %s", m.Filename)
+		}
+	}
+
+	regexpSearch = true
+	if _, err := FindInFiles(root, "haystack|hay", grepMaxMatches); err != errNoSearchMatch {
+		t.Errorf("expected no matches, got %v", err)
+	}
+	regexpSearch = false
+
+	os.Mkdir(filepath.Join(root, ".git"), 0o755)
+	if dir := ProjectRoot(filepath.Join(root, "sub", "other.go")); dir != root {
+		t.Errorf("expected the project root to be %s, got %s", root, dir)
+	}
+}
+
+func TestFindInFilesGitIgnore(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root := t.TempDir()
+	if err := exec.Command("git", "init", "-q", root).Run(); err != nil {
+		t.Skip("could not create a git repository")
+	}
+	for filename, contents := range map[string]string{
+		".gitignore":   "build/\n",
+		"main.go":      "package main // needle\n",
+		"build/gen.go": "package build // needle\n",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(filename))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	matches, err := FindInFiles(root, "needle", grepMaxMatches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || filepath.Base(matches[0].Filename) != "main.go" {
+		t.Errorf("expected the ignored files to be skipped, got %v", matches)
+	}
+}
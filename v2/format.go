@@ -196,6 +196,19 @@ func organizeImports(data []byte, onlyJava, removeExistingImports bool) []byte {
 
 func (e *Editor) formatCode(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, jsonFormatToggle *bool) {
 
+	// A format command in the project configuration file takes precedence
+	if cfg, err := LoadProjectConfig(e.filename, e.mode); err != nil || (cfg != nil && cfg.Format != "") {
+		if err == nil {
+			err = e.formatWithUtility(c, tty, status, *cfg.FormatCommand(), filepath.Ext(e.filename))
+		}
+		if err != nil {
+			status.ClearAll(c)
+			status.SetMessage(err.Error())
+			status.Show(c, e)
+		}
+		return
+	}
+
 	// Format JSON
 	if e.mode == mode.JSON {
 		data, err := formatJSON([]byte(e.String()), jsonFormatToggle, e.indentation.PerTab)
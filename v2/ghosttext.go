@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xyproto/vt100"
+)
+
+const (
+	ghostTextDelay       = 600 * time.Millisecond // the typing pause before a completion is requested
+	ghostTextLinesBefore = 40                     // the number of lines above the cursor that are sent to the AI backend
+	ghostTextLinesAfter  = 10                     // the number of lines below the cursor that are sent to the AI backend
+	ghostTextAITokens    = 48                     // the maximum length of a completion from the AI backend
+	ghostTextNgramTokens = 6                      // the maximum number of tokens that the n-gram model predicts after a word
+	ngramMaxFiles        = 200                    // the maximum number of files that an n-gram model is built from
+	ngramMaxFileSize     = 512 * 1024             // larger files are skipped when building an n-gram model
+	ngramModelMaxAge     = time.Minute            // n-gram models are rebuilt when they are older than this
+	ghostTextPrompt      = "Complete the line of %s code that ends with <cursor>. Only output the code that should be inserted at the cursor, on a single line, without any explanation or Markdown formatting, and without repeating the code before the cursor.\n\n%s<cursor>%s"
+)
+
+var (
+	// ghostText is the suggested completion that is drawn dimmed after the cursor, if there is one
+	ghostText       GhostText
+	ghostCancel     context.CancelFunc // cancels the pending completion request, if any
+	ghostGeneration int                // incremented every time the ghost text is dismissed, to ignore late completions
+	ghostMut        sync.Mutex
+
+	// ngramModels are the n-gram models that have been built, by file glob
+	ngramModels    = make(map[string]*NgramModel)
+	ngramModelsMut sync.Mutex
+
+	// an identifier or number, or a single other rune, with any leading whitespace
+	ngramTokenRegexp = regexp.MustCompile(`\s*(?:[\p{L}\p{N}_]+|[^\s\p{L}\p{N}_])`)
+)
+
+// GhostText is a suggested completion for the current line, at the end of the line
+type GhostText struct {
+	Text string    // the text that is inserted if tab is pressed
+	Y    LineIndex // the line that the completion is for
+	Line string    // the contents of the line when the completion was requested
+}
+
+// NgramModel predicts the next token in source code from the one or two tokens before it,
+// by counting which tokens follow which in the given source code
+type NgramModel struct {
+	counts  map[string]map[string]int // how many times each token follows a context of zero, one or two tokens
+	created time.Time
+}
+
+// ngramTokens splits a line of code into identifiers, numbers and other runes.
+// Leading whitespace is kept as a single space, so that the tokens can be joined together again.
+func ngramTokens(line string) []string {
+	var tokens []string
+	for _, token := range ngramTokenRegexp.FindAllString(line, -1) {
+		if trimmed := strings.TrimLeftFunc(token, unicode.IsSpace); trimmed != token {
+			token = " " + trimmed
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// ngramContexts returns the contexts that can be used for predicting the token after the given tokens,
+// the longest context first
+func ngramContexts(tokens []string) []string {
+	var contexts []string
+	if n := len(tokens); n >= 2 {
+		contexts = append(contexts, tokens[n-2]+"\x00"+tokens[n-1])
+	}
+	if n := len(tokens); n >= 1 {
+		contexts = append(contexts, tokens[n-1])
+	}
+	return contexts
+}
+
+// isWordRune checks if the given rune can be part of an identifier
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// NewNgramModel creates an n-gram model from the given source code
+func NewNgramModel(sources ...string) *NgramModel {
+	m := &NgramModel{counts: make(map[string]map[string]int), created: time.Now()}
+	for _, source := range sources {
+		m.Add(source)
+	}
+	return m
+}
+
+// count counts one occurrence of the given token after the given context
+func (m *NgramModel) count(context, token string) {
+	if m.counts[context] == nil {
+		m.counts[context] = make(map[string]int)
+	}
+	m.counts[context][token]++
+}
+
+// Add counts the tokens in the given source code. Each line starts with a "\n" token,
+// so that the tokens at the start of a line can be predicted as well.
+func (m *NgramModel) Add(source string) {
+	for _, line := range strings.Split(source, "\n") {
+		tokens := append([]string{"\n"}, ngramTokens(strings.TrimRight(line, " \t\r"))...)
+		for i := 1; i < len(tokens); i++ {
+			m.count("", tokens[i])
+			m.count(tokens[i-1], tokens[i])
+			if i > 1 {
+				m.count(tokens[i-2]+"\x00"+tokens[i-1], tokens[i])
+			}
+		}
+	}
+}
+
+// best returns the most frequent token that is accepted by the given function, after the first of the given
+// contexts where such a token has been seen. Shorter contexts are only used if the longer ones have not been seen,
+// since they are less certain. Returns an empty string if the token has been seen less than minCount times.
+func (m *NgramModel) best(contexts []string, accept func(string) bool, minCount int) string {
+	for _, context := range contexts {
+		bestToken, bestCount := "", 0
+		for token, count := range m.counts[context] {
+			if accept(token) && (count > bestCount || (count == bestCount && token < bestToken)) {
+				bestToken, bestCount = token, count
+			}
+		}
+		if bestCount >= minCount {
+			return bestToken
+		} else if bestCount > 0 {
+			break
+		}
+	}
+	return ""
+}
+
+// Complete predicts how the given line of code continues. A partially typed word is completed first,
+// then up to maxTokens tokens that have been seen at least twice in the same context are added.
+func (m *NgramModel) Complete(line string, maxTokens int) string {
+	tokens := append([]string{"\n"}, ngramTokens(line)...)
+	var completion string
+	if r, _ := utf8.DecodeLastRuneInString(line); isWordRune(r) {
+		partial := tokens[len(tokens)-1]
+		tokens = tokens[:len(tokens)-1]
+		token := m.best(append(ngramContexts(tokens), ""), func(token string) bool {
+			return len(token) > len(partial) && strings.HasPrefix(token, partial)
+		}, 1)
+		if token == "" {
+			return ""
+		}
+		completion = strings.TrimPrefix(token, partial)
+		tokens = append(tokens, token)
+	}
+	for i := 0; i < maxTokens; i++ {
+		token := m.best(ngramContexts(tokens), func(string) bool { return true }, 2)
+		if token == "" {
+			break
+		}
+		completion += token
+		tokens = append(tokens, token)
+	}
+	if strings.HasSuffix(line, " ") || strings.HasSuffix(line, "\t") {
+		completion = strings.TrimLeft(completion, " ")
+	}
+	return completion
+}
+
+// ngramModelForFile returns an n-gram model built from the files with the same extension in the same
+// directory as the given file. Models are cached, and rebuilt when they are older than ngramModelMaxAge.
+func ngramModelForFile(filename string) *NgramModel {
+	glob := filepath.Join(filepath.Dir(filename), "*"+filepath.Ext(filename))
+	ngramModelsMut.Lock()
+	defer ngramModelsMut.Unlock()
+	if m, ok := ngramModels[glob]; ok && time.Since(m.created) < ngramModelMaxAge {
+		return m
+	}
+	m := NewNgramModel()
+	filenames, _ := filepath.Glob(glob)
+	if len(filenames) > ngramMaxFiles {
+		filenames = filenames[:ngramMaxFiles]
+	}
+	for _, filename := range filenames {
+		if fi, err := os.Stat(filename); err != nil || fi.Size() > ngramMaxFileSize {
+			continue
+		}
+		if data, err := os.ReadFile(filename); err == nil {
+			m.Add(string(data))
+		}
+	}
+	ngramModels[glob] = m
+	return m
+}
+
+// firstCompletionLine returns the first line of code in a completion from the AI backend,
+// without any Markdown code fences and without the given line, if it was repeated
+func firstCompletionLine(response, line string) string {
+	for _, completionLine := range strings.Split(response, "\n") {
+		completionLine = strings.TrimRight(completionLine, " \t\r")
+		trimmed := strings.TrimSpace(completionLine)
+		if trimmed == "" || strings.HasPrefix(trimmed, "```") {
+			continue
+		}
+		if trimmedLine := strings.TrimSpace(line); trimmedLine != "" && strings.HasPrefix(trimmed, trimmedLine) {
+			completionLine = strings.TrimPrefix(trimmed, trimmedLine)
+		}
+		if strings.HasSuffix(line, " ") || strings.HasSuffix(line, "\t") {
+			completionLine = strings.TrimLeft(completionLine, " \t")
+		}
+		return completionLine
+	}
+	return ""
+}
+
+// aiCompletion asks the AI backend how the current line continues. The request is stopped as soon
+// as the first line of the completion has arrived, or when the given context is canceled.
+func aiCompletion(ctx context.Context, provider AIProvider, prompt, line string) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var response string
+	err := provider.Stream(ctx, []AIMessage{{Role: "user", Content: prompt}}, ghostTextAITokens, 0, func(token string) {
+		response += token
+		// Only the first line of code is needed, so stop when it has ended
+		lines := strings.Split(response, "\n")
+		for _, completedLine := range lines[:len(lines)-1] {
+			if trimmed := strings.TrimSpace(completedLine); trimmed != "" && !strings.HasPrefix(trimmed, "```") {
+				cancel()
+				break
+			}
+		}
+	})
+	if err != nil && ctx.Err() == nil {
+		return "", err
+	}
+	return firstCompletionLine(response, line), nil
+}
+
+// DismissGhostText cancels any pending completion request and removes the ghost text.
+// Returns true if ghost text was shown.
+func DismissGhostText() bool {
+	ghostMut.Lock()
+	defer ghostMut.Unlock()
+	if ghostCancel != nil {
+		ghostCancel()
+		ghostCancel = nil
+	}
+	ghostGeneration++
+	shown := ghostText.Text != ""
+	ghostText = GhostText{}
+	return shown
+}
+
+// TakeGhostText dismisses the ghost text, and returns it if it is still valid for the current line.
+// shown is true if ghost text was shown, and the editor needs to be redrawn.
+func (e *Editor) TakeGhostText() (text string, shown bool) {
+	ghostMut.Lock()
+	g := ghostText
+	ghostMut.Unlock()
+	if !DismissGhostText() {
+		return "", false
+	}
+	if g.Y != e.DataY() || g.Line != e.CurrentLine() || !e.AtOrAfterEndOfLine() {
+		return "", true
+	}
+	return g.Text, true
+}
+
+// ScheduleGhostText requests a completion for the current line after a typing pause, from the AI backend
+// or else from an n-gram model built from the files in the same directory. Any pending request is
+// canceled first, and the request is canceled if a key is pressed before the completion arrives.
+func (e *Editor) ScheduleGhostText(c *vt100.Canvas) {
+	DismissGhostText()
+	line := e.CurrentLine()
+	if !e.ghostTextEnabled || !e.ProgrammingLanguage() || strings.TrimSpace(line) == "" || !e.AtOrAfterEndOfLine() || e.HasSelection() || e.HasCursors() {
+		return
+	}
+	y := e.DataY()
+
+	// Collect the surrounding lines now, while the key loop is waiting for the next key
+	var prompt string
+	if aiProvider != nil {
+		var before, after []string
+		for i := int(y) - ghostTextLinesBefore; i < int(y); i++ {
+			if i >= 0 {
+				before = append(before, e.Line(LineIndex(i)))
+			}
+		}
+		for i := int(y) + 1; i <= int(y)+ghostTextLinesAfter && i < e.Len(); i++ {
+			after = append(after, e.Line(LineIndex(i)))
+		}
+		prompt = fmt.Sprintf(ghostTextPrompt, e.mode, strings.Join(append(before, line), "\n"), "\n"+strings.Join(after, "\n"))
+	}
+	filename := e.filename
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ghostMut.Lock()
+	ghostCancel = cancel
+	generation := ghostGeneration
+	ghostMut.Unlock()
+
+	go func() {
+		defer cancel()
+		select {
+		case <-time.After(ghostTextDelay):
+		case <-ctx.Done():
+			return
+		}
+		var completion string
+		if aiProvider != nil {
+			var err error
+			completion, err = aiCompletion(ctx, aiProvider, prompt, line)
+			if err != nil { // offline, or the AI backend is not available
+				completion = ""
+			}
+		}
+		if completion == "" && ctx.Err() == nil {
+			completion = ngramModelForFile(filename).Complete(line, ghostTextNgramTokens)
+		}
+		if strings.TrimSpace(completion) == "" || ctx.Err() != nil {
+			return
+		}
+		ghostMut.Lock()
+		if generation != ghostGeneration {
+			ghostMut.Unlock()
+			return
+		}
+		ghostText = GhostText{Text: completion, Y: y, Line: line}
+		ghostMut.Unlock()
+		e.DrawLines(c, true, false)
+		e.redrawCursor = true
+		e.RepositionCursorIfNeeded()
+	}()
+}
+
+// drawGhostText draws the suggested completion dimmed after the cursor, if it is for the given line.
+// x is the screen position of the cursor and w is the width of the canvas.
+func (e *Editor) drawGhostText(c *vt100.Canvas, lineIndex LineIndex, x, y, w uint, tabString string) {
+	ghostMut.Lock()
+	g := ghostText
+	ghostMut.Unlock()
+	if g.Text == "" || g.Y != lineIndex || x >= w {
+		return
+	}
+	text := []rune(strings.ReplaceAll(g.Text, "\t", tabString))
+	if uint(len(text)) > w-x {
+		text = text[:w-x]
+	}
+	c.Write(x, y, vt100.DarkGray, e.Background, string(text))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// fakeAIProvider streams the given tokens, and counts how many of them were sent before the context was canceled
+type fakeAIProvider struct {
+	tokens []string
+	sent   int
+}
+
+func (p *fakeAIProvider) ContextTokens() int {
+	return defaultAIContextTokens
+}
+
+func (p *fakeAIProvider) Stream(ctx context.Context, messages []AIMessage, maxTokens int, temperature float32, newToken func(string)) error {
+	for _, token := range p.tokens {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		newToken(token)
+		p.sent++
+	}
+	return nil
+}
+
+func TestNgramTokens(t *testing.T) {
+	tokens := ngramTokens("\tfmt.Println(x, 42)")
+	expected := []string{" fmt", ".", "Println", "(", "x", ",", " 42", ")"}
+	if strings.Join(tokens, "|") != strings.Join(expected, "|") {
+		t.Fatalf("expected %q, got %q", expected, tokens)
+	}
+}
+
+func TestNgramModelComplete(t *testing.T) {
+	m := NewNgramModel("package main\n\nfunc main() {\n\tfmt.Println(\"a\")\n\tfmt.Println(\"b\")\n\treturn\n}\n")
+
+	// A partially typed word is completed, followed by the tokens that have been seen twice after it
+	if completion := m.Complete("\tfmt.Pr", ghostTextNgramTokens); completion != "intln(\"" {
+		t.Fatalf("expected %q, got %q", "intln(\"", completion)
+	}
+	if completion := m.Complete("\tret", ghostTextNgramTokens); completion != "urn" {
+		t.Fatalf("expected \"urn\", got %q", completion)
+	}
+	if completion := m.Complete("pack", ghostTextNgramTokens); completion != "age" {
+		t.Fatalf("expected \"age\", got %q", completion)
+	}
+	// Nothing is known about this word
+	if completion := m.Complete("\txyz", ghostTextNgramTokens); completion != "" {
+		t.Fatalf("expected no completion, got %q", completion)
+	}
+}
+
+func TestFirstCompletionLine(t *testing.T) {
+	if line := firstCompletionLine("```go\n\tfmt.Println(x)\n```\n", "\tfmt."); line != "Println(x)" {
+		t.Fatalf("expected the repeated start of the line to be removed, got %q", line)
+	}
+	if line := firstCompletionLine("\n y := 2\nz := 3", "x := 1;"); line != " y := 2" {
+		t.Fatalf("expected the first line, got %q", line)
+	}
+	if line := firstCompletionLine("  b)", "add(a, "); line != "b)" {
+		t.Fatalf("expected no double space after the cursor, got %q", line)
+	}
+}
+
+func TestAICompletion(t *testing.T) {
+	provider := &fakeAIProvider{tokens: []string{"```go\n", "Pri", "ntln(x)", "\n", "more code", "\n```"}}
+	completion, err := aiCompletion(context.Background(), provider, "prompt", "fmt.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completion != "Println(x)" {
+		t.Fatalf("expected \"Println(x)\", got %q", completion)
+	}
+	if provider.sent != 4 {
+		t.Fatalf("expected the request to stop after the first line, but %d tokens were sent", provider.sent)
+	}
+
+	// A canceled request gives no completion
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if completion, _ := aiCompletion(ctx, &fakeAIProvider{tokens: []string{"x"}}, "prompt", "fmt."); completion != "" {
+		t.Fatalf("expected no completion, got %q", completion)
+	}
+}
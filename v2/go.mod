@@ -3,7 +3,7 @@ module github.com/xyproto/orbiton/v2
 go 1.21.0
 
 require (
-	github.com/PullRequestInc/go-gpt3 v1.1.16
+	github.com/DataDog/gostackparse v0.6.0
 	github.com/cyrus-and/gdb v0.0.0-20230321224603-9424cb2f2a86
 	github.com/felixge/fgtrace v0.2.0
 	github.com/fsnotify/fsnotify v1.6.0
@@ -30,7 +30,6 @@ require (
 )
 
 require (
-	github.com/DataDog/gostackparse v0.6.0 // indirect
 	github.com/biessek/golang-ico v0.0.0-20180326222316-d348d9ea4670 // indirect
 	github.com/creack/pty v1.1.18 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
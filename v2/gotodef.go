@@ -11,6 +11,42 @@ import (
 
 var backFunctions []func()
 
+// JumpTo saves the current location, opens the given file if it is not the current one, and jumps to the given line.
+// A function for going back to the saved location is pushed to backFunctions, so that ctrl-b can jump back, also across files.
+// Returns false if the file could not be opened.
+func (e *Editor) JumpTo(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, filename string, y LineIndex) bool {
+	oldFilename, err := e.AbsFilename()
+	if err != nil {
+		return false
+	}
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return false
+	}
+	oldCursor := e.dataCursor()
+
+	if absFilename != oldFilename {
+		if err := e.Switch(c, tty, status, fileLock, absFilename); err != nil {
+			return false
+		}
+	}
+	e.redraw, _ = e.GoTo(y, c, status)
+	e.redrawCursor = true
+
+	// Push a function for how to go back
+	backFunctions = append(backFunctions, func() {
+		if current, err := e.AbsFilename(); err != nil || current != oldFilename {
+			e.Switch(c, tty, status, fileLock, oldFilename)
+		}
+		e.redraw, _ = e.GoTo(oldCursor.y, c, status)
+		e.setDataCursor(c, oldCursor)
+		e.HorizontalScrollIfNeeded(c)
+		e.redrawCursor = true
+	})
+
+	return true
+}
+
 // GoToDefinition tries to find the definition of the given string, saves the current location and jumps to the location of the definition.
 // Returns true if it was possible to go to the definition.
 // This function is currently very experimental and may only work for a few languages, and for a few definitions!
@@ -19,11 +55,6 @@ func (e *Editor) GoToDefinition(tty *vt100.TTY, c *vt100.Canvas, status *StatusB
 	// FuncPrefix may return strings with a leading or trailing blank
 	funcPrefix := e.FuncPrefix()
 
-	// Can this language / editor mode support this?
-	if funcPrefix == "" {
-		return false
-	}
-
 	// Do we have a word under the cursor? No need to trim it at this point.
 	word := e.WordAtCursor()
 	if word == "" {
@@ -38,6 +69,11 @@ func (e *Editor) GoToDefinition(tty *vt100.TTY, c *vt100.Canvas, status *StatusB
 		}
 	}
 
+	// Without a function prefix for this language / editor mode, only a tags file can be used
+	if funcPrefix == "" {
+		return e.TagGoToDefinition(c, tty, status)
+	}
+
 	// The search string we will use for searching for functions within this file
 	s := funcPrefix + word
 
@@ -79,6 +115,11 @@ func (e *Editor) GoToDefinition(tty *vt100.TTY, c *vt100.Canvas, status *StatusB
 		return true
 	}
 
+	// Look up the definition in a tags file, or in the other files in the same directory
+	if e.TagGoToDefinition(c, tty, status) {
+		return true
+	}
+
 	currentLine := e.CurrentLine()
 	functionCall := strings.Contains(currentLine, word+"(")
 
@@ -117,6 +117,14 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 		inListItem      bool
 	)
 
+	// Diagnostics from the language server, if one is running, and problems from the last build
+	diagnostics := e.lineDiagnostics()
+	buildProblems := e.problemLines()
+	var lineBreakpoints map[LineIndex]Breakpoint
+	if e.debugMode {
+		lineBreakpoints = e.breakpointLines()
+	}
+
 	escapeFunction := Escape
 	unEscapeFunction := UnEscape
 	if e.mode == mode.Make || e.mode == mode.Just || e.mode == mode.Shell {
@@ -452,6 +460,17 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 				searchTermRunes := []rune(e.searchTerm)
 				matchForAnotherN := 0
 
+				// Find the matches in advance if the search term is a regular expression
+				var regexpMatches map[int]int
+				searchRe, searchIsRegexp := searchRegexp(e.searchTerm)
+				if searchIsRegexp {
+					lineRunes := make([]rune, len(runesAndAttributes))
+					for i, ra := range runesAndAttributes {
+						lineRunes[i] = ra.R
+					}
+					regexpMatches = searchMatchRunes(searchRe, lineRunes)
+				}
+
 				// Output a line with the chars (Rune + AttributeColor)
 				skipX := e.pos.offsetX
 				untilNextJumpLetter := 0
@@ -469,7 +488,11 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 						// Coloring an already found match
 						fg = e.SearchHighlight
 						matchForAnotherN--
-					} else if len(e.searchTerm) > 0 && letter == searchTermRunes[0] {
+					} else if length, ok := regexpMatches[runeIndex]; ok {
+						// A match for the regular expression
+						fg = e.SearchHighlight
+						matchForAnotherN = length - 1
+					} else if len(e.searchTerm) > 0 && !searchIsRegexp && letter == searchTermRunes[0] {
 						// Potential search highlight match
 						length := utf8.RuneCountInString(e.searchTerm)
 						counter := 0
@@ -538,6 +561,32 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 		xp := cx + lineRuneCount
 		c.WriteRunesB(xp, yp, e.Foreground, bg, ' ', cw-lineRuneCount)
 
+		// Highlight the line if the last build had a problem with it, or else draw the diagnostic, if any
+		if p, ok := buildProblems[y+offsetY]; ok {
+			e.drawProblem(c, p, cx, xp, yp, cw)
+		} else if d, ok := diagnostics[y+offsetY]; ok {
+			e.drawDiagnostic(c, d, xp+2, yp, cw)
+		}
+
+		// Draw the suggested completion after the cursor, if any
+		if y+offsetY == e.DataY() {
+			e.drawGhostText(c, y+offsetY, cx+uint(e.pos.sx), yp, cw, tabString)
+		}
+
+		// Mark the line in the rightmost column if it has a breakpoint
+		if bp, ok := lineBreakpoints[y+offsetY]; ok {
+			e.drawBreakpoint(c, bp, yp, cw)
+		}
+
+		// Draw the selection, if any
+		if e.HasSelection() {
+			e.drawSelection(c, y+offsetY, cx, yp)
+		}
+
+		// Draw the extra cursors, if any
+		if e.HasCursors() {
+			e.drawCursors(c, y+offsetY, cx, yp)
+		}
 	}
 }
 
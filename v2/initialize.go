@@ -421,6 +421,11 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 	// If SSH_TTY or TMUX is set, redraw everything and then display the status message
 	e.sshMode = !inVTEGUI && ((env.Str("SSH_TTY") != "" || env.Str("TMUX") != "" || strings.Contains(env.Str("TERMCAP"), "|screen.")) && !env.Bool("NO_SSH_MODE"))
 
+	// Start the language server for this file in the background, so that it is ready when it is needed
+	if !fnord.stdin && !e.binaryFile {
+		e.LSPStartInBackground()
+	}
+
 	// Craft an appropriate status message
 	if createdNewFile {
 		statusMessage = "New " + e.filename
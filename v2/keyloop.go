@@ -46,6 +46,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 
 		copyLines         []string  // for the cut/copy/paste functionality
 		previousCopyLines []string  // for checking if a paste is the same as last time
+		copiedRectangle   []string  // the most recently cut or copied rectangular selection, for pasting it as a rectangle
 		bookmark          *Position // for the bookmark/jump functionality
 
 		firstPasteAction = true
@@ -62,6 +63,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 
 		markdownTableEditorCounter int // the number of times the Markdown table editor has been displayed
 		jumpMode                   bool
+		drawnProblemsVersion       int // for redrawing when the problems from a build in the background have changed
 	)
 
 	// New editor struct. Scroll 10 lines at a time, no word wrap.
@@ -81,6 +83,11 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 		}
 	}
 
+	// Load the undo history from the previous editor session, if the file has not changed since then
+	if !fnord.stdin {
+		undo.LoadHistory(e, absFilename)
+	}
+
 	// Minor adjustments to some modes
 	switch e.mode {
 	case mode.Email, mode.Git:
@@ -198,6 +205,12 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			}
 		}
 
+		// Any key dismisses the suggested completion, if there is one, but tab also inserts it
+		ghost, ghostShown := e.TakeGhostText()
+		if ghostShown {
+			e.redraw = true
+		}
+
 		switch key {
 		case "c:17": // ctrl-q, quit
 			e.quit = true
@@ -219,7 +232,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			}
 
 			// Add a watch
-			if e.debugMode { // AddWatch will start a new gdb session if needed
+			if e.debugMode { // the watch is passed on to the debugger when the debug session starts, if needed
 				// Ask the user to type in a watch expression
 				if expression, ok := e.UserInput(c, tty, status, "Variable name to watch", []string{}, false); ok {
 					if _, err := e.AddWatch(expression); err != nil {
@@ -275,12 +288,12 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 
 			// If in Debug mode, let ctrl-f mean "finish"
 			if e.debugMode {
-				if e.gdb == nil { // success
+				if e.debugger == nil {
 					status.SetMessageAfterRedraw("Not running")
 					break
 				}
 				status.ClearAll(c)
-				if err := e.DebugFinish(); err != nil {
+				if err := e.debugger.Finish(); err != nil {
 					e.DebugEnd()
 					status.SetMessage(err.Error())
 					e.GoToEnd(c, nil)
@@ -291,6 +304,9 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				break
 			}
 
+			// Searching in the current file stops stepping through the results of a search in all files,
+			// and through the problems from the last build
+			StopStepping()
 			e.SearchMode(c, status, tty, true, undo)
 
 		case "c:0": // ctrl-space, build source code to executable, or export, depending on the mode
@@ -439,15 +455,21 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			}
 		case "c:28": // ctrl-\, toggle comment for this block
 			undo.Snapshot(e)
-			e.ToggleCommentBlock(c)
+			if e.HasSelection() {
+				e.ToggleCommentSelection()
+			} else {
+				e.ToggleCommentBlock(c)
+			}
 			e.redraw = true
 			e.redrawCursor = true
 		case "c:15": // ctrl-o, launch the command menu
 			status.ClearAll(c)
 			undo.Snapshot(e)
-			undoBackup := undo
+			undoBackup, filenameBackup := undo, e.filename
 			lastCommandMenuIndex = e.CommandMenu(c, tty, status, bookmark, undo, lastCommandMenuIndex, forceFlag, fileLock)
-			undo = undoBackup
+			if e.filename == filenameBackup { // keep the swapped undo stack if another file was opened from the menu
+				undo = undoBackup
+			}
 		case "c:31": // ctrl-_, enter a digraph
 			// Ask the user to type in a digraph
 			if digraphString, ok := e.UserInput(c, tty, status, "Type in a 2-letter digraph", digraph.All(), false); ok {
@@ -650,7 +672,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 
 			// If in Debug mode, let ctrl-n mean "next instruction"
 			if e.debugMode {
-				if e.gdb != nil {
+				if e.debugger != nil {
 					if !programRunning {
 						e.DebugEnd()
 						status.SetMessage("Program stopped")
@@ -659,10 +681,10 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 						e.redrawCursor = true
 						break
 					}
-					if err := e.DebugNextInstruction(); err != nil {
+					if err := e.debugger.NextInstruction(); err != nil {
 						if errorMessage := err.Error(); strings.Contains(errorMessage, "is not being run") {
 							e.DebugEnd()
-							status.SetMessage("Could not start GDB")
+							status.SetMessage("Could not start the debugger")
 						} else if err == errProgramStopped {
 							e.DebugEnd()
 							status.SetMessage("Program stopped, could not step")
@@ -682,7 +704,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 					e.redrawCursor = true
 					status.SetMessageAfterRedraw(status.Message())
 					break
-				} // e.gdb == nil
+				} // e.debugger == nil
 				// Build or export the current file
 				// The last argument is if the command should run in the background or not
 				outputExecutable, err := e.BuildOrExport(c, tty, status, e.filename, e.mode == mode.Markdown)
@@ -729,6 +751,26 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				break
 			}
 
+			// Step through the results of the most recent search in all files, if any
+			if GrepStepping() {
+				if err := e.NextGrepMatch(c, tty, status, fileLock, true); err != nil {
+					status.ClearAll(c)
+					status.SetError(err)
+					status.Show(c, e)
+				}
+				break
+			}
+
+			// Step through the problems from the most recent build, if any
+			if ProblemStepping() {
+				if err := e.NextProblem(c, tty, status, fileLock, true); err != nil {
+					status.ClearAll(c)
+					status.SetError(err)
+					status.Show(c, e)
+				}
+				break
+			}
+
 			e.UseStickySearchTerm()
 			if e.SearchTerm() != "" {
 				// Go to next match
@@ -785,6 +827,26 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				break
 			}
 
+			// Step through the results of the most recent search in all files, if any
+			if GrepStepping() {
+				if err := e.NextGrepMatch(c, tty, status, fileLock, false); err != nil {
+					status.ClearAll(c)
+					status.SetError(err)
+					status.Show(c, e)
+				}
+				break
+			}
+
+			// Step through the problems from the most recent build, if any
+			if ProblemStepping() {
+				if err := e.NextProblem(c, tty, status, fileLock, false); err != nil {
+					status.ClearAll(c)
+					status.SetError(err)
+					status.Show(c, e)
+				}
+				break
+			}
+
 			e.UseStickySearchTerm()
 			if e.SearchTerm() != "" {
 				// Go to previous match
@@ -816,6 +878,17 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				e.quit = true
 				break
 			}
+			// Halt the program that is being debugged, if it is still running after continuing
+			if haltBackend, ok := e.debugger.(HaltBackend); ok && e.debugMode && haltBackend.Running() {
+				if err := haltBackend.Halt(); err != nil {
+					status.ShowErrorAfterRedraw(err)
+				} else {
+					status.SetMessageAfterRedraw("Halted")
+				}
+				e.redraw = true
+				e.redrawCursor = true
+				break
+			}
 			// Exit debug mode, if active
 			if e.debugMode {
 				e.DebugEnd()
@@ -827,6 +900,12 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			}
 			// Stop the call to ChatGPT, if it is running
 			e.generatingTokens = false
+			// Let ctrl-n and ctrl-p scroll and search again, instead of stepping through matches in all files or problems
+			StopStepping()
+			// Remove all extra cursors
+			e.ClearCursors()
+			// Stop selecting text
+			e.ClearSelection()
 			// Reset the cut/copy/paste double-keypress detection
 			lastCopyY = -1
 			lastPasteY = -1
@@ -864,6 +943,15 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 
 			// Regular behavior, take an undo snapshot and insert a space
 			undo.Snapshot(e)
+			// Replace the rectangular selection with a space on every line
+			if e.HasRectangularSelection() {
+				e.RectangleToCursors(c, true)
+			}
+			// Insert a space at every cursor, if there are several
+			if e.HasCursors() {
+				e.InsertRuneAtCursors(c, ' ')
+				break
+			}
 			// Place a space
 			wrapped := e.InsertRune(c, ' ')
 			if !wrapped {
@@ -938,14 +1026,14 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				// De-indent the current line before moving on to the next
 				e.SetCurrentLine(trimmedLine)
 				leadingWhitespace = currentLeadingWhitespace
-			} else if e.fixAsYouType && openAIKeyHolder != nil && !alreadyUsedAI {
+			} else if e.fixAsYouType && aiProvider != nil && !alreadyUsedAI {
 				// Fix the code and grammar of the written line, using AI
 				const disableFixAsYouTypeOnError = true
 				e.FixCodeOrText(c, status, disableFixAsYouTypeOnError)
 				alreadyUsedAI = true
 				e.redrawCursor = true
 				goto RETURN_PRESSED_AI_DONE
-			} else if shouldUseAI && openAIKeyHolder != nil {
+			} else if shouldUseAI && aiProvider != nil {
 				// Generate code or text, using AI
 				e.GenerateCodeOrText(c, status, bookmark)
 				break
@@ -1076,7 +1164,6 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 					indent = false
 				}
 			}
-			e.MakeConsistent()
 
 			h := int(c.Height())
 			if e.pos.sy > (h - 1) {
@@ -1139,6 +1226,18 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 
 			undo.Snapshot(e)
 
+			// Delete the selected text, if there is a selection
+			if e.HasSelection() {
+				e.DeleteSelection(c)
+				break
+			}
+
+			// Delete the character to the left of every cursor, if there are several
+			if e.HasCursors() {
+				e.BackspaceAtCursors(c)
+				break
+			}
+
 			// Delete the character to the left
 			if e.EmptyLine() {
 				e.DeleteCurrentLineMoveBookmark(bookmark)
@@ -1185,11 +1284,26 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			e.redraw = true
 		case "c:9": // tab or ctrl-i
 
+			if ghost != "" {
+				undo.Snapshot(e)
+				e.InsertStringAndMove(c, ghost)
+				e.redrawCursor = true
+				break
+			}
+
 			if e.debugMode {
 				e.debugStepInto = !e.debugStepInto
 				break
 			}
 
+			// Indent the selected lines, if there is a selection
+			if e.HasSelection() {
+				undo.Snapshot(e)
+				e.IndentSelection()
+				e.redrawCursor = true
+				break
+			}
+
 			y := int(e.DataY())
 			r := e.Rune()
 			leftRune := e.LeftRune()
@@ -1381,7 +1495,11 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			e.SaveX(true)
 		case "c:4": // ctrl-d, delete
 			undo.Snapshot(e)
-			if e.Empty() {
+			if e.HasSelection() {
+				e.DeleteSelection(c)
+			} else if e.HasCursors() {
+				e.DeleteAtCursors(c)
+			} else if e.Empty() {
 				status.SetMessage("Empty")
 				status.Show(c, e)
 			} else {
@@ -1390,7 +1508,11 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			}
 			e.redrawCursor = true
 
-		case "c:29", "c:30": // ctrl-~, jump to matching parenthesis or curly bracket
+		case "c:29": // ctrl-], start selecting text, then whole lines, then stop selecting
+			status.SetMessageAfterRedraw(e.CycleSelection())
+			e.redraw = true
+			e.redrawCursor = true
+		case "c:30": // ctrl-~, jump to matching parenthesis or curly bracket
 			if e.JumpToMatching(c) {
 				break
 			}
@@ -1409,8 +1531,9 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				break
 			}
 
-			// func prefix must exist for this language/mode for GoToDefinition to be supported
-			jumpedToDefinition := e.FuncPrefix() != "" && e.GoToDefinition(tty, c, status)
+			// Ask the language server, if there is one, and then fall back to searching for the definition,
+			// in the current file, in a tags file or in the other files in the same directory.
+			jumpedToDefinition := e.LSPGoToDefinition(c, tty, status) || e.GoToDefinition(tty, c, status)
 
 			// If the definition could not be found, toggle the status line at the bottom.
 			if !jumpedToDefinition {
@@ -1542,6 +1665,23 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			e.redraw = true
 			e.redrawCursor = true
 		case "c:24": // ctrl-x, cut line
+			// Cut the selected text, if there is a selection
+			if e.HasSelection() {
+				undo.Snapshot(e)
+				copiedRectangle = nil
+				var err error
+				copyLines, err = e.CopySelection()
+				if e.HasRectangularSelection() {
+					copiedRectangle = copyLines
+				}
+				e.DeleteSelection(c)
+				if err != nil {
+					status.SetMessageAfterRedraw(fmt.Sprintf("Cut %d lines", len(copyLines)))
+				} else {
+					status.SetMessageAfterRedraw(fmt.Sprintf("Cut %d lines to the clipboard", len(copyLines)))
+				}
+				break
+			}
 			y := e.DataY()
 			line := e.Line(y)
 			// Prepare to cut
@@ -1631,6 +1771,12 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 
 			undo.Snapshot(e)
 
+			// Delete the rest of the line at every cursor, if there are several
+			if e.HasCursors() {
+				e.DeleteRestOfLineAtCursors(c)
+				break
+			}
+
 			e.DeleteRestOfLine()
 			if e.EmptyRightTrimmedLine() {
 				// Deleting the rest of the line cleared this line,
@@ -1652,6 +1798,24 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			// ctrl-c might interrupt the program, but saving at the wrong time might be just as destructive.
 			// e.Save(c, tty)
 
+			// Copy the selected text, if there is a selection
+			if e.HasSelection() {
+				copiedRectangle = nil
+				var err error
+				copyLines, err = e.CopySelection()
+				if e.HasRectangularSelection() {
+					copiedRectangle = copyLines
+				}
+				e.ClearSelection()
+				e.redraw = true
+				if err != nil {
+					status.SetMessageAfterRedraw(fmt.Sprintf("Copied %d lines", len(copyLines)))
+				} else {
+					status.SetMessageAfterRedraw(fmt.Sprintf("Copied %d lines to the clipboard", len(copyLines)))
+				}
+				break
+			}
+
 			go func() {
 
 				y := e.DataY()
@@ -1815,6 +1979,26 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				break
 			}
 
+			// Paste a copied rectangular selection as a rectangle
+			if len(copiedRectangle) > 0 && equalStringSlices(copyLines, copiedRectangle) {
+				undo.Snapshot(e)
+				if e.HasSelection() {
+					e.ReplaceSelection(c, strings.Join(copyLines, "\n"))
+				} else {
+					e.PasteRectangle(c, copyLines)
+				}
+				lastPasteY = -1
+				break
+			}
+
+			// Replace the selected text, if there is a selection
+			if e.HasSelection() {
+				undo.Snapshot(e)
+				e.ReplaceSelection(c, strings.Join(copyLines, "\n"))
+				lastPasteY = -1
+				break
+			}
+
 			// Now save the contents to "previousCopyLines" and check if they are the same first
 			if !equalStringSlices(copyLines, previousCopyLines) {
 				// Start with single-line paste if the contents are new
@@ -1887,7 +2071,9 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 		case "c:18": // ctrl-r, to open or close a portal. In debug mode, continue running the program.
 
 			if e.debugMode {
-				e.DebugContinue()
+				if e.debugger != nil {
+					e.debugger.Continue()
+				}
 				break
 			}
 
@@ -1945,30 +2131,19 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			}
 
 			if e.debugMode {
-				if e.breakpoint == nil {
-					e.breakpoint = e.pos.Copy()
-					_, err := e.DebugActivateBreakpoint(filepath.Base(e.filename))
-					if err != nil {
-						status.SetError(err)
-						break
-					}
+				added, err := e.ToggleBreakpoint()
+				if err != nil {
+					status.SetError(err)
+					break
+				}
+				// Draw the breakpoint marker before showing the status message
+				e.DrawLines(c, true, false)
+				e.redraw = false
+				if added {
 					s := "Placed breakpoint at line " + e.LineNumber().String()
 					status.SetMessage("  " + s + "  ")
-				} else if e.breakpoint.LineNumber() == e.LineNumber() {
-					// setting a breakpoint at the same line twice: remove the breakpoint
-					s := "Removed breakpoint at line " + e.breakpoint.LineNumber().String()
-					status.SetMessage(s)
-					e.breakpoint = nil
 				} else {
-					undo.Snapshot(e)
-					// Go to the breakpoint position
-					e.GoToPosition(c, status, *e.breakpoint)
-					// TODO: Just use status.SetMessageAfterRedraw instead?
-					// Do the redraw manually before showing the status message
-					e.DrawLines(c, true, false)
-					e.redraw = false
-					// Show the status message
-					s := "Jumped to breakpoint at line " + e.LineNumber().String()
+					s := "Removed breakpoint at line " + e.LineNumber().String()
 					status.SetMessage(s)
 				}
 			} else {
@@ -2025,7 +2200,18 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 		default: // any other key
 			keyRunes := []rune(key)
 			// panic(fmt.Sprintf("PRESSED KEY: %v", []rune(key)))
-			if len(keyRunes) > 0 && unicode.IsLetter(keyRunes[0]) { // letter
+			if len(keyRunes) > 0 && unicode.IsGraphic(keyRunes[0]) && e.HasRectangularSelection() { // type on every selected line
+				undo.Snapshot(e)
+				e.RectangleToCursors(c, true)
+				for _, r := range keyRunes {
+					e.InsertRuneAtCursors(c, r)
+				}
+			} else if len(keyRunes) > 0 && unicode.IsGraphic(keyRunes[0]) && e.HasCursors() { // type at every cursor
+				undo.Snapshot(e)
+				for _, r := range keyRunes {
+					e.InsertRuneAtCursors(c, r)
+				}
+			} else if len(keyRunes) > 0 && unicode.IsLetter(keyRunes[0]) { // letter
 
 				undo.Snapshot(e)
 
@@ -2052,6 +2238,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 					}
 					e.redraw = true
 				}
+				e.ScheduleGhostText(c)
 			} else if len(keyRunes) > 0 && unicode.IsGraphic(keyRunes[0]) { // any other key that can be drawn
 				undo.Snapshot(e)
 				e.redraw = true
@@ -2103,6 +2290,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 					e.Next(c)
 				}
 				e.redrawCursor = true
+				e.ScheduleGhostText(c)
 			}
 		}
 
@@ -2123,9 +2311,11 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 		if kh.Repeated("c:27", 4-1) { // 4 times, minus the one that was added just now
 			status.ClearAll(c)
 			undo.Snapshot(e)
-			undoBackup := undo
+			undoBackup, filenameBackup := undo, e.filename
 			lastCommandMenuIndex = e.CommandMenu(c, tty, status, bookmark, undo, lastCommandMenuIndex, forceFlag, fileLock)
-			undo = undoBackup
+			if e.filename == filenameBackup { // keep the swapped undo stack if another file was opened from the menu
+				undo = undoBackup
+			}
 			// Reset the key history next iteration
 			clearKeyHistory = true
 		}
@@ -2135,6 +2325,21 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			status.ClearAll(c)
 		}
 
+		// Highlight the problems from a build or test run that was done in the background
+		if v := ProblemsVersion(); v != drawnProblemsVersion {
+			drawnProblemsVersion = v
+			e.redraw = true
+		}
+		if result := TakeBackgroundBuildResult(); result != nil {
+			if absFilename, err := e.AbsFilename(); err == nil && absFilename == result.Filename {
+				if result.Failed {
+					status.SetErrorMessage(result.Message)
+				} else {
+					status.SetMessageAfterRedraw(result.Message)
+				}
+			}
+		}
+
 		// Draw and/or redraw everything, with slightly different behavior over ssh
 		e.RedrawAtEndOfKeyLoop(c, status)
 
@@ -2174,6 +2379,15 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 	// Save the current location in the location history and write it to file
 	e.SaveLocation(absFilename, locationHistory)
 
+	// Save the undo history, so that it can be used the next time this file is opened
+	if !fnord.stdin {
+		undo.SaveHistory(e, absFilename)
+	}
+
+	// Stop the language servers and the background build, if any
+	StopLSPClients()
+	StopBackgroundBuild()
+
 	// Clear all status bar messages
 	status.ClearAll(c)
 
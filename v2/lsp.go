@@ -0,0 +1,604 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/xyproto/files"
+	"github.com/xyproto/mode"
+)
+
+const (
+	// how long to wait for the language server to start
+	lspInitializeTimeout = 10 * time.Second
+
+	// how long to wait for a response to a request
+	lspRequestTimeout = 5 * time.Second
+)
+
+// LSPServer is a language server command, together with the language ID that is used when opening documents
+type LSPServer struct {
+	Command    []string
+	LanguageID string
+}
+
+var (
+	// lspServers are the language servers that are used for each mode, if they are installed
+	lspServers = map[mode.Mode]LSPServer{
+		mode.C:      {[]string{"clangd"}, "c"},
+		mode.Cpp:    {[]string{"clangd"}, "cpp"},
+		mode.Go:     {[]string{"gopls"}, "go"},
+		mode.Python: {[]string{"pyright-langserver", "--stdio"}, "python"},
+		mode.Rust:   {[]string{"rust-analyzer"}, "rust"},
+	}
+
+	// lspClients are the running or starting language servers, one per mode and project root
+	lspClients   = make(map[string]*lspClientEntry)
+	lspClientsMu sync.Mutex
+
+	errLSPNotAvailable = errors.New("no language server available")
+	errLSPTimeout      = errors.New("the language server did not respond in time")
+	errLSPStopped      = errors.New("the language server has stopped")
+	errLSPNotReady     = errors.New("the language server is still starting")
+)
+
+// LSPPosition is a position in a document, where Character counts UTF-16 code units
+type LSPPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// LSPRange is a range in a document
+type LSPRange struct {
+	Start LSPPosition `json:"start"`
+	End   LSPPosition `json:"end"`
+}
+
+// LSPLocation is a range in a document, given by URI
+type LSPLocation struct {
+	URI   string   `json:"uri"`
+	Range LSPRange `json:"range"`
+}
+
+// LSPDiagnostic is an error, warning or hint from the language server
+type LSPDiagnostic struct {
+	Range    LSPRange `json:"range"`
+	Severity int      `json:"severity"` // 1 is error, 2 is warning, 3 is information and 4 is hint
+	Message  string   `json:"message"`
+	Source   string   `json:"source"`
+}
+
+// lspMessage is a JSON-RPC request, response or notification
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *lspError        `json:"error,omitempty"`
+}
+
+// lspError is a JSON-RPC error
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (err *lspError) Error() string {
+	return fmt.Sprintf("language server error %d: %s", err.Code, err.Message)
+}
+
+// LSPClient is a connection to a language server that runs as a child process and talks JSON-RPC over stdio
+type LSPClient struct {
+	cmd         *exec.Cmd
+	stdin       io.WriteCloser
+	writeMut    sync.Mutex
+	mut         sync.Mutex
+	pending     map[int]chan lspMessage
+	diagnostics map[string][]LSPDiagnostic // per URI
+	versions    map[string]int             // the version of each opened document, per URI
+	nextID      int
+	languageID  string
+	stopped     bool
+}
+
+// NewLSPClient starts the given language server in the given project root directory, and initializes it
+func NewLSPClient(server LSPServer, rootDir string) (*LSPClient, error) {
+	cmd := exec.Command(server.Command[0], server.Command[1:]...)
+	cmd.Dir = rootDir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	client := &LSPClient{
+		cmd:         cmd,
+		stdin:       stdin,
+		pending:     make(map[int]chan lspMessage),
+		diagnostics: make(map[string][]LSPDiagnostic),
+		versions:    make(map[string]int),
+		nextID:      1,
+		languageID:  server.LanguageID,
+	}
+	go client.readLoop(bufio.NewReader(stdout))
+
+	rootURI := pathToURI(rootDir)
+	params := map[string]any{
+		"processId": os.Getpid(),
+		"rootUri":   rootURI,
+		"capabilities": map[string]any{
+			"textDocument": map[string]any{
+				"hover":              map[string]any{"contentFormat": []string{"plaintext", "markdown"}},
+				"definition":         map[string]any{"linkSupport": true},
+				"publishDiagnostics": map[string]any{},
+			},
+		},
+		"workspaceFolders": []map[string]string{{"uri": rootURI, "name": filepath.Base(rootDir)}},
+	}
+	if _, err := client.request("initialize", params, lspInitializeTimeout); err != nil {
+		client.Stop()
+		return nil, err
+	}
+	if err := client.notify("initialized", map[string]any{}); err != nil {
+		client.Stop()
+		return nil, err
+	}
+	return client, nil
+}
+
+// pathToURI converts an absolute path to a file:// URI
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// uriToPath converts a file:// URI to a path
+func uriToPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("not a file URI: %s", uri)
+	}
+	return filepath.FromSlash(u.Path), nil
+}
+
+// utf16Column converts a rune index on the given line to the number of UTF-16 code units before it
+func utf16Column(line []rune, x int) int {
+	return len(utf16.Encode(line[:min(max(x, 0), len(line))]))
+}
+
+// runeColumn converts a number of UTF-16 code units on the given line to a rune index
+func runeColumn(line []rune, character int) int {
+	units := 0
+	for i, r := range line {
+		if units >= character {
+			return i
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return len(line)
+}
+
+// write sends one JSON-RPC message to the language server
+func (client *LSPClient) write(msg any) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	client.writeMut.Lock()
+	defer client.writeMut.Unlock()
+	return writeContentLengthMessage(client.stdin, data)
+}
+
+// writeContentLengthMessage writes a message with a Content-Length header, as used by LSP and DAP
+func writeContentLengthMessage(w io.Writer, data []byte) error {
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readMessage reads one JSON-RPC message
+func readLSPMessage(r *bufio.Reader) (lspMessage, error) {
+	var msg lspMessage
+	data, err := readContentLengthMessage(r)
+	if err != nil {
+		return msg, err
+	}
+	err = json.Unmarshal(data, &msg)
+	return msg, err
+}
+
+// readContentLengthMessage reads the body of one message with a Content-Length header, as used by LSP and DAP
+func readContentLengthMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("missing Content-Length header")
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readLoop handles the messages from the language server, until it stops
+func (client *LSPClient) readLoop(r *bufio.Reader) {
+	for {
+		msg, err := readLSPMessage(r)
+		if err != nil {
+			break
+		}
+		switch {
+		case msg.ID != nil && msg.Method != "": // a request from the server
+			client.replyToServer(msg)
+		case msg.ID != nil: // a response
+			var id int
+			if json.Unmarshal(*msg.ID, &id) != nil {
+				continue
+			}
+			client.mut.Lock()
+			ch, ok := client.pending[id]
+			delete(client.pending, id)
+			client.mut.Unlock()
+			if ok {
+				ch <- msg
+			}
+		case msg.Method == "textDocument/publishDiagnostics":
+			var params struct {
+				URI         string          `json:"uri"`
+				Diagnostics []LSPDiagnostic `json:"diagnostics"`
+			}
+			if json.Unmarshal(msg.Params, &params) == nil {
+				client.mut.Lock()
+				client.diagnostics[params.URI] = params.Diagnostics
+				client.mut.Unlock()
+			}
+		}
+	}
+	// The server has stopped, let all waiting requests know
+	client.mut.Lock()
+	client.stopped = true
+	for id, ch := range client.pending {
+		close(ch)
+		delete(client.pending, id)
+	}
+	client.mut.Unlock()
+}
+
+// replyToServer answers requests from the server, like asking for configuration, with empty results
+func (client *LSPClient) replyToServer(msg lspMessage) {
+	var result any
+	if msg.Method == "workspace/configuration" {
+		var params struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		result = make([]any, len(params.Items))
+	}
+	client.write(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+}
+
+// request sends a request to the language server and waits for the response
+func (client *LSPClient) request(method string, params any, timeout time.Duration) (json.RawMessage, error) {
+	client.mut.Lock()
+	if client.stopped {
+		client.mut.Unlock()
+		return nil, errLSPStopped
+	}
+	id := client.nextID
+	client.nextID++
+	ch := make(chan lspMessage, 1)
+	client.pending[id] = ch
+	client.mut.Unlock()
+
+	if err := client.write(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		client.mut.Lock()
+		delete(client.pending, id)
+		client.mut.Unlock()
+		return nil, err
+	}
+
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return nil, errLSPStopped
+		}
+		if msg.Error != nil {
+			return nil, msg.Error
+		}
+		return msg.Result, nil
+	case <-time.After(timeout):
+		client.mut.Lock()
+		delete(client.pending, id)
+		client.mut.Unlock()
+		return nil, errLSPTimeout
+	}
+}
+
+// notify sends a notification to the language server
+func (client *LSPClient) notify(method string, params any) error {
+	return client.write(map[string]any{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// Sync sends the current contents of the given document to the language server
+func (client *LSPClient) Sync(path, text string) error {
+	uri := pathToURI(path)
+	client.mut.Lock()
+	version, opened := client.versions[uri]
+	version++
+	client.versions[uri] = version
+	client.mut.Unlock()
+	if !opened {
+		return client.notify("textDocument/didOpen", map[string]any{
+			"textDocument": map[string]any{"uri": uri, "languageId": client.languageID, "version": version, "text": text},
+		})
+	}
+	return client.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": version},
+		"contentChanges": []map[string]string{{"text": text}},
+	})
+}
+
+// DidSave lets the language server know that the given document has been saved
+func (client *LSPClient) DidSave(path string) error {
+	return client.notify("textDocument/didSave", map[string]any{"textDocument": map[string]string{"uri": pathToURI(path)}})
+}
+
+// textDocumentPosition returns the parameters for a request about a position in a document
+func textDocumentPosition(path string, pos LSPPosition) map[string]any {
+	return map[string]any{"textDocument": map[string]string{"uri": pathToURI(path)}, "position": pos}
+}
+
+// Definition asks the language server where the symbol at the given position is defined
+func (client *LSPClient) Definition(path string, pos LSPPosition) ([]LSPLocation, error) {
+	result, err := client.request("textDocument/definition", textDocumentPosition(path, pos), lspRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	// The result can be a Location, a list of Locations or a list of LocationLinks
+	var locations []LSPLocation
+	if json.Unmarshal(result, &locations) == nil && len(locations) > 0 && locations[0].URI != "" {
+		return locations, nil
+	}
+	var location LSPLocation
+	if json.Unmarshal(result, &location) == nil && location.URI != "" {
+		return []LSPLocation{location}, nil
+	}
+	var links []struct {
+		TargetURI            string   `json:"targetUri"`
+		TargetSelectionRange LSPRange `json:"targetSelectionRange"`
+	}
+	locations = nil
+	if json.Unmarshal(result, &links) == nil {
+		for _, link := range links {
+			locations = append(locations, LSPLocation{link.TargetURI, link.TargetSelectionRange})
+		}
+	}
+	return locations, nil
+}
+
+// Hover asks the language server for information about the symbol at the given position, as plain text
+func (client *LSPClient) Hover(path string, pos LSPPosition) (string, error) {
+	result, err := client.request("textDocument/hover", textDocumentPosition(path, pos), lspRequestTimeout)
+	if err != nil {
+		return "", err
+	}
+	var hover struct {
+		Contents json.RawMessage `json:"contents"`
+	}
+	if err := json.Unmarshal(result, &hover); err != nil || len(hover.Contents) == 0 {
+		return "", err
+	}
+	// The contents can be MarkupContent, a MarkedString or a list of MarkedStrings
+	var markup struct {
+		Value string `json:"value"`
+	}
+	var text string
+	var list []json.RawMessage
+	if json.Unmarshal(hover.Contents, &text) == nil {
+		// a plain string
+	} else if json.Unmarshal(hover.Contents, &list) == nil {
+		var texts []string
+		for _, item := range list {
+			var s string
+			if json.Unmarshal(item, &s) == nil {
+				texts = append(texts, s)
+			} else if json.Unmarshal(item, &markup) == nil {
+				texts = append(texts, markup.Value)
+			}
+		}
+		text = strings.Join(texts, "\n")
+	} else if json.Unmarshal(hover.Contents, &markup) == nil {
+		text = markup.Value
+	}
+	return hoverSummary(text), nil
+}
+
+// hoverSummary returns the first non-empty line of the given hover text, skipping Markdown code fences
+func hoverSummary(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "```") {
+			return trimmed
+		}
+	}
+	return ""
+}
+
+// Diagnostics returns the most recent diagnostics for the given document, sorted by line and then by severity
+func (client *LSPClient) Diagnostics(path string) []LSPDiagnostic {
+	client.mut.Lock()
+	diagnostics := append([]LSPDiagnostic{}, client.diagnostics[pathToURI(path)]...)
+	client.mut.Unlock()
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		if diagnostics[i].Range.Start.Line != diagnostics[j].Range.Start.Line {
+			return diagnostics[i].Range.Start.Line < diagnostics[j].Range.Start.Line
+		}
+		return diagnostics[i].Severity < diagnostics[j].Severity
+	})
+	return diagnostics
+}
+
+// Stopped checks if the language server has stopped
+func (client *LSPClient) Stopped() bool {
+	client.mut.Lock()
+	defer client.mut.Unlock()
+	return client.stopped
+}
+
+// Stop asks the language server to shut down, and stops it if it does not
+func (client *LSPClient) Stop() {
+	if !client.Stopped() {
+		client.request("shutdown", nil, time.Second)
+		client.notify("exit", nil)
+	}
+	client.stdin.Close()
+	done := make(chan error, 1)
+	go func() { done <- client.cmd.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		client.cmd.Process.Kill()
+	}
+}
+
+// lspClientEntry is a language server that is starting or running. ready is closed when
+// the initialize handshake is done, and then either client or err is set.
+type lspClientEntry struct {
+	ready  chan struct{}
+	client *LSPClient
+	err    error
+}
+
+// initialized returns the language server, or nil if it is still starting or failed to start
+func (entry *lspClientEntry) initialized() *LSPClient {
+	select {
+	case <-entry.ready:
+		return entry.client
+	default:
+		return nil
+	}
+}
+
+// LSPClientFor returns a running language server for the given mode and project root, starting it if needed.
+// Returns errLSPNotAvailable if there is no language server for the mode, or if it is not installed.
+// The lock for the list of language servers is not held while a language server is starting, so that
+// RunningLSPClientFor never has to wait for the initialize handshake.
+func LSPClientFor(m mode.Mode, rootDir string) (*LSPClient, error) {
+	server, ok := lspServers[m]
+	if !ok || files.Which(server.Command[0]) == "" {
+		return nil, errLSPNotAvailable
+	}
+	key := fmt.Sprintf("%d:%s", m, rootDir)
+	for {
+		lspClientsMu.Lock()
+		entry, ok := lspClients[key]
+		if !ok {
+			entry = &lspClientEntry{ready: make(chan struct{})}
+			lspClients[key] = entry
+			lspClientsMu.Unlock()
+			entry.client, entry.err = NewLSPClient(server, rootDir)
+			close(entry.ready)
+			if entry.err != nil {
+				lspClientsMu.Lock()
+				if lspClients[key] == entry {
+					delete(lspClients, key) // try again next time
+				}
+				lspClientsMu.Unlock()
+			}
+			return entry.client, entry.err
+		}
+		lspClientsMu.Unlock()
+
+		// Another goroutine has started this language server, wait for it
+		<-entry.ready
+		if entry.err != nil {
+			return nil, entry.err
+		}
+		if !entry.client.Stopped() {
+			return entry.client, nil
+		}
+		// The language server has stopped, remove it and start a new one
+		lspClientsMu.Lock()
+		if lspClients[key] == entry {
+			delete(lspClients, key)
+		}
+		lspClientsMu.Unlock()
+	}
+}
+
+// RunningLSPClientFor returns the language server for the given mode and project root, if it is already
+// running. Returns nil if it is not running, if it is still starting or if it has stopped.
+func RunningLSPClientFor(m mode.Mode, rootDir string) *LSPClient {
+	lspClientsMu.Lock()
+	entry, ok := lspClients[fmt.Sprintf("%d:%s", m, rootDir)]
+	lspClientsMu.Unlock()
+	if !ok {
+		return nil
+	}
+	if client := entry.initialized(); client != nil && !client.Stopped() {
+		return client
+	}
+	return nil
+}
+
+// StopLSPClients stops all running language servers. The lock for the list of language servers
+// is only held while the list is copied and cleared, and not while the language servers are stopped.
+func StopLSPClients() {
+	lspClientsMu.Lock()
+	entries := make([]*lspClientEntry, 0, len(lspClients))
+	for key, entry := range lspClients {
+		entries = append(entries, entry)
+		delete(lspClients, key)
+	}
+	lspClientsMu.Unlock()
+	for _, entry := range entries {
+		if client := entry.initialized(); client != nil {
+			client.Stop()
+		} else {
+			// Still starting, stop it when it is ready
+			go func(entry *lspClientEntry) {
+				<-entry.ready
+				if entry.client != nil {
+					entry.client.Stop()
+				}
+			}(entry)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xyproto/mode"
+)
+
+// TestLSPHelperProcess is not a real test, but a fake language server that is started by TestLSPClient
+func TestLSPHelperProcess(t *testing.T) {
+	if os.Getenv("ORBITON_FAKE_LSP") != "1" {
+		return
+	}
+	r := bufio.NewReader(os.Stdin)
+	send := func(msg any) {
+		data, _ := json.Marshal(msg)
+		fmt.Printf("Content-Length: %d\r\n\r\n%s", len(data), data)
+	}
+	var openedURI string
+	for {
+		msg, err := readLSPMessage(r)
+		if err != nil {
+			os.Exit(1)
+		}
+		var result any
+		switch msg.Method {
+		case "initialize":
+			if os.Getenv("ORBITON_FAKE_LSP_SLOW") == "1" {
+				time.Sleep(500 * time.Millisecond)
+			}
+			// Ask the client for configuration, before replying
+			send(map[string]any{"jsonrpc": "2.0", "id": "config", "method": "workspace/configuration", "params": map[string]any{"items": []any{map[string]any{}}}})
+			result = map[string]any{"capabilities": map[string]any{}}
+		case "textDocument/didOpen":
+			var params struct {
+				TextDocument struct {
+					URI string `json:"uri"`
+				} `json:"textDocument"`
+			}
+			json.Unmarshal(msg.Params, &params)
+			openedURI = params.TextDocument.URI
+			send(map[string]any{"jsonrpc": "2.0", "method": "textDocument/publishDiagnostics", "params": map[string]any{
+				"uri": openedURI,
+				"diagnostics": []any{
+					map[string]any{"range": map[string]any{"start": map[string]int{"line": 1, "character": 0}, "end": map[string]int{"line": 1, "character": 3}}, "severity": 2, "message": "unused"},
+					map[string]any{"range": map[string]any{"start": map[string]int{"line": 1, "character": 0}, "end": map[string]int{"line": 1, "character": 3}}, "severity": 1, "message": "undefined: x"},
+				},
+			}})
+		case "textDocument/definition":
+			result = []any{map[string]any{
+				"targetUri":            pathToURI("/tmp/other file.go"),
+				"targetRange":          map[string]any{"start": map[string]int{"line": 4, "character": 0}, "end": map[string]int{"line": 6, "character": 1}},
+				"targetSelectionRange": map[string]any{"start": map[string]int{"line": 4, "character": 5}, "end": map[string]int{"line": 4, "character": 10}},
+			}}
+		case "textDocument/hover":
+			result = map[string]any{"contents": map[string]string{"kind": "markdown", "value": "```go\nfunc Hello() string\n```\n\nHello says hello"}}
+		case "exit":
+			os.Exit(0)
+		}
+		if msg.ID != nil && msg.Method != "" {
+			send(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+		}
+	}
+}
+
+func TestLSPClient(t *testing.T) {
+	t.Setenv("ORBITON_FAKE_LSP", "1")
+	dir := t.TempDir()
+	client, err := NewLSPClient(LSPServer{[]string{os.Args[0], "-test.run=^TestLSPHelperProcess$"}, "go"}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+
+	filename := filepath.Join(dir, "main.go")
+	if err := client.Sync(filename, "package main\nx := 1\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	locations, err := client.Definition(filename, LSPPosition{1, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 1 {
+		t.Fatalf("expected one location, got %d", len(locations))
+	}
+	path, err := uriToPath(locations[0].URI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/tmp/other file.go" || locations[0].Range.Start != (LSPPosition{4, 5}) {
+		t.Fatalf("unexpected definition: %s %v", path, locations[0].Range.Start)
+	}
+
+	text, err := client.Hover(filename, LSPPosition{1, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "func Hello() string" {
+		t.Fatalf("unexpected hover text: %q", text)
+	}
+
+	// The diagnostics were sent before the responses, so they should have arrived by now
+	diagnostics := client.Diagnostics(filename)
+	if len(diagnostics) != 2 || diagnostics[0].Message != "undefined: x" {
+		t.Fatalf("expected the error to be sorted before the warning, got %v", diagnostics)
+	}
+}
+
+func TestUTF16Columns(t *testing.T) {
+	line := []rune("a😀b")
+	if n := utf16Column(line, 2); n != 3 {
+		t.Fatalf("expected 3 UTF-16 code units, got %d", n)
+	}
+	if x := runeColumn(line, 3); x != 2 {
+		t.Fatalf("expected rune index 2, got %d", x)
+	}
+	if x := runeColumn(line, 100); x != 3 {
+		t.Fatalf("expected the end of the line, got %d", x)
+	}
+}
+
+func TestLSPClientForDoesNotBlock(t *testing.T) {
+	t.Setenv("ORBITON_FAKE_LSP", "1")
+	t.Setenv("ORBITON_FAKE_LSP_SLOW", "1")
+	lspServers[mode.Zig] = LSPServer{[]string{os.Args[0], "-test.run=^TestLSPHelperProcess$"}, "zig"}
+	defer delete(lspServers, mode.Zig)
+	defer StopLSPClients()
+
+	dir := t.TempDir()
+	started := make(chan error, 1)
+	go func() {
+		_, err := LSPClientFor(mode.Zig, dir)
+		started <- err
+	}()
+
+	// While the language server is starting, it is not returned, and checking for it does not wait
+	time.Sleep(100 * time.Millisecond)
+	before := time.Now()
+	if client := RunningLSPClientFor(mode.Zig, dir); client != nil {
+		t.Fatal("expected no client while the language server is starting")
+	}
+	if elapsed := time.Since(before); elapsed > 50*time.Millisecond {
+		t.Fatalf("RunningLSPClientFor waited for %v", elapsed)
+	}
+
+	// A second caller waits for the same language server to start
+	client, err := LSPClientFor(mode.Zig, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-started; err != nil {
+		t.Fatal(err)
+	}
+	if RunningLSPClientFor(mode.Zig, dir) != client {
+		t.Fatal("expected the running language server to be returned")
+	}
+}
+
+func TestLSPGoToDefinitionDoesNotWait(t *testing.T) {
+	t.Setenv("ORBITON_FAKE_LSP", "1")
+	t.Setenv("ORBITON_FAKE_LSP_SLOW", "1")
+	lspServers[mode.Zig] = LSPServer{[]string{os.Args[0], "-test.run=^TestLSPHelperProcess$"}, "zig"}
+	defer delete(lspServers, mode.Zig)
+	defer StopLSPClients()
+
+	dir := t.TempDir()
+	e := NewSimpleEditor(80)
+	e.filename = filepath.Join(dir, "main.zig")
+	e.mode = mode.Zig
+
+	// The language server is started in the background, instead of waiting for it
+	before := time.Now()
+	if e.LSPGoToDefinition(nil, nil, nil) {
+		t.Fatal("expected no definition while the language server is starting")
+	}
+	if elapsed := time.Since(before); elapsed > 50*time.Millisecond {
+		t.Fatalf("LSPGoToDefinition waited for %v", elapsed)
+	}
+	if _, _, err := e.lspClient(); err != errLSPNotReady {
+		t.Fatalf("expected errLSPNotReady, got %v", err)
+	}
+	_, root, _ := e.projectPaths()
+	client, err := LSPClientFor(mode.Zig, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, _, err := e.lspClient(); err != nil || c != client {
+		t.Fatalf("expected the started language server to be used, got %v", err)
+	}
+}
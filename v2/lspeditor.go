@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/xyproto/files"
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+// LSPAvailable checks if there is a language server for the given mode, and if it is installed
+func LSPAvailable(m mode.Mode) bool {
+	server, ok := lspServers[m]
+	return ok && files.Which(server.Command[0]) != ""
+}
+
+// projectPaths returns the absolute filename and the project root of the current file. They are cached,
+// since finding the project root means looking for a .git directory, and the diagnostics are drawn at every redraw.
+func (e *Editor) projectPaths() (absFilename, root string, err error) {
+	if e.pathsFilename != e.filename || e.absFilename == "" {
+		absFilename, err := filepath.Abs(e.filename)
+		if err != nil {
+			return "", "", err
+		}
+		e.pathsFilename, e.absFilename, e.projectRoot = e.filename, absFilename, ProjectRoot(absFilename)
+	}
+	return e.absFilename, e.projectRoot, nil
+}
+
+// LSPStartInBackground starts the language server for the current file, if there is one and it is not
+// already running, so that it is ready by the time it is needed
+func (e *Editor) LSPStartInBackground() {
+	if !LSPAvailable(e.mode) {
+		return
+	}
+	_, root, err := e.projectPaths()
+	if err != nil {
+		return
+	}
+	go LSPClientFor(e.mode, root)
+}
+
+// lspClient returns the language server for the current file, and the absolute filename. If the language
+// server is not running yet, it is started in the background and errLSPNotReady is returned, instead of
+// waiting for it. The current contents of the editor are sent to the language server.
+func (e *Editor) lspClient() (*LSPClient, string, error) {
+	if !LSPAvailable(e.mode) {
+		return nil, "", errLSPNotAvailable
+	}
+	absFilename, root, err := e.projectPaths()
+	if err != nil {
+		return nil, "", err
+	}
+	client := RunningLSPClientFor(e.mode, root)
+	if client == nil {
+		e.LSPStartInBackground()
+		return nil, "", errLSPNotReady
+	}
+	if err := client.Sync(absFilename, e.String()); err != nil {
+		return nil, "", err
+	}
+	return client, absFilename, nil
+}
+
+// lspPosition returns the position of the cursor, as a language server position
+func (e *Editor) lspPosition() LSPPosition {
+	cur := e.dataCursor()
+	return LSPPosition{int(cur.y), utf16Column([]rune(e.Line(cur.y)), cur.x)}
+}
+
+// LSPGoToDefinition asks the language server for the current mode where the symbol under the cursor is defined,
+// and then jumps there, opening another file if needed. A function for going back is pushed to backFunctions.
+// Returns false if there is no language server, or if no definition was found.
+func (e *Editor) LSPGoToDefinition(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) bool {
+	client, absFilename, err := e.lspClient()
+	if err == errLSPNotReady && status != nil {
+		status.SetMessageAfterRedraw(lspServers[e.mode].Command[0] + " is not ready yet")
+	}
+	if err != nil {
+		return false
+	}
+	locations, err := client.Definition(absFilename, e.lspPosition())
+	if err != nil || len(locations) == 0 {
+		return false
+	}
+	targetFilename, err := uriToPath(locations[0].URI)
+	if err != nil {
+		return false
+	}
+	target := locations[0].Range.Start
+
+	y := LineIndex(target.Line)
+	if !e.JumpTo(c, tty, status, targetFilename, y) {
+		return false
+	}
+	e.setDataCursor(c, Cursor{runeColumn([]rune(e.Line(y)), target.Character), y})
+	e.HorizontalScrollIfNeeded(c)
+	return true
+}
+
+// LSPHover asks the language server for information about the symbol under the cursor, as a single line
+func (e *Editor) LSPHover(c *vt100.Canvas, status *StatusBar) (string, error) {
+	client, absFilename, err := e.lspClient()
+	if err != nil {
+		return "", err
+	}
+	text, err := client.Hover(absFilename, e.lspPosition())
+	if err != nil {
+		return "", err
+	}
+	if text == "" {
+		return "", errors.New("no information about " + strings.TrimSpace(e.WordAtCursor()))
+	}
+	return text, nil
+}
+
+// LSPDidSave sends the saved contents to the language server for the current mode, in the background.
+// The language server is started if it is not already running, so that diagnostics can be shown.
+func (e *Editor) LSPDidSave() {
+	if !LSPAvailable(e.mode) {
+		return
+	}
+	absFilename, root, err := e.projectPaths()
+	if err != nil {
+		return
+	}
+	m, text := e.mode, e.String()
+	go func() {
+		client, err := LSPClientFor(m, root)
+		if err != nil {
+			return
+		}
+		if client.Sync(absFilename, text) == nil {
+			client.DidSave(absFilename)
+		}
+	}()
+}
+
+// lineDiagnostics returns the most severe diagnostic per line for the current file, if a language server is running
+func (e *Editor) lineDiagnostics() map[LineIndex]LSPDiagnostic {
+	if _, ok := lspServers[e.mode]; !ok {
+		return nil
+	}
+	absFilename, root, err := e.projectPaths()
+	if err != nil {
+		return nil
+	}
+	client := RunningLSPClientFor(e.mode, root)
+	if client == nil {
+		return nil
+	}
+	diagnostics := make(map[LineIndex]LSPDiagnostic)
+	for _, d := range client.Diagnostics(absFilename) {
+		y := LineIndex(d.Range.Start.Line)
+		if _, ok := diagnostics[y]; !ok { // the diagnostics are sorted by severity
+			diagnostics[y] = d
+		}
+	}
+	return diagnostics
+}
+
+// drawDiagnostic draws the message of the given diagnostic at the given position, after the end of a line
+func (e *Editor) drawDiagnostic(c *vt100.Canvas, d LSPDiagnostic, x, y, w uint) {
+	color := e.CommentColor
+	if d.Severity == 1 || d.Severity == 0 { // an error, or no severity given
+		color = e.StatusErrorForeground
+	}
+	e.drawLineMessage(c, d.Message, color, x, y, w)
+}
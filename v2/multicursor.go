@@ -0,0 +1,300 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+var errNoLineBelow = errors.New("no line below")
+
+// Cursor is a position in the data (a rune index and a line index), as opposed to a position on the screen
+type Cursor struct {
+	x int
+	y LineIndex
+}
+
+// cursorEdit performs an edit operation at the given cursor. It returns the cursor position after the edit,
+// and a function that can adjust the position of a cursor that comes after the given cursor in the document.
+type cursorEdit func(cur Cursor) (Cursor, func(other Cursor) Cursor)
+
+// less checks if this cursor comes before the other cursor in the document
+func (cur Cursor) less(other Cursor) bool {
+	return cur.y < other.y || (cur.y == other.y && cur.x < other.x)
+}
+
+// HasCursors checks if there are extra cursors, in addition to the regular one
+func (e *Editor) HasCursors() bool {
+	return len(e.cursors) > 0
+}
+
+// ClearCursors removes all extra cursors
+func (e *Editor) ClearCursors() {
+	e.cursors = nil
+}
+
+// dataCursor returns the position of the regular cursor, as a position in the data
+func (e *Editor) dataCursor() Cursor {
+	x, _ := e.DataX() // if the cursor is after the data, x is the length of the line
+	return Cursor{x, e.DataY()}
+}
+
+// screenColumn returns the screen column (before scrolling) for the given position in the data, expanding tabs
+func (e *Editor) screenColumn(cur Cursor) int {
+	col := 0
+	for i, r := range e.lines.Line(int(cur.y)) {
+		if i >= cur.x {
+			break
+		}
+		if r == '\t' {
+			col += e.indentation.PerTab
+		} else {
+			col++
+		}
+	}
+	return col
+}
+
+// setDataCursor moves the regular cursor to the given position in the data
+func (e *Editor) setDataCursor(c *vt100.Canvas, cur Cursor) {
+	e.GoTo(cur.y, c, nil)
+	e.pos.SetX(c, e.screenColumn(cur))
+}
+
+// addCursor adds an extra cursor, unless there already is a cursor at that position
+func (e *Editor) addCursor(cur Cursor) bool {
+	if cur == e.dataCursor() {
+		return false
+	}
+	for _, other := range e.cursors {
+		if cur == other {
+			return false
+		}
+	}
+	e.cursors = append(e.cursors, cur)
+	return true
+}
+
+// AddCursorBelow adds an extra cursor on the line below the lowest cursor, at the same column
+func (e *Editor) AddCursorBelow() error {
+	lowest := e.dataCursor()
+	for _, cur := range e.cursors {
+		if lowest.less(cur) {
+			lowest = cur
+		}
+	}
+	below := Cursor{lowest.x, lowest.y + 1}
+	if int(below.y) >= e.Len() {
+		return errNoLineBelow
+	}
+	e.addCursor(below)
+	return nil
+}
+
+// AddCursorsAtMatches moves the regular cursor to the next match of the search term,
+// and adds an extra cursor at every other match. Returns the number of cursors.
+func (e *Editor) AddCursorsAtMatches(c *vt100.Canvas) (int, error) {
+	s := []rune(e.searchTerm)
+	if len(s) == 0 {
+		s = []rune(e.stickySearchTerm)
+	}
+	if len(s) == 0 {
+		return 0, errors.New("no search term")
+	}
+	var matches []Cursor
+	for y := 0; y < e.lines.Len(); y++ {
+		line := e.lines.Line(y)
+		for x := 0; x+len(s) <= len(line); x++ {
+			if equalRunes(line[x:x+len(s)], s) {
+				matches = append(matches, Cursor{x, LineIndex(y)})
+				x += len(s) - 1
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return 0, errNoSearchMatch
+	}
+	// Use the first match at or after the regular cursor for the regular cursor, with wrap-around
+	primary := 0
+	current := e.dataCursor()
+	for i, cur := range matches {
+		if !cur.less(current) {
+			primary = i
+			break
+		}
+	}
+	e.setDataCursor(c, matches[primary])
+	e.cursors = nil
+	for i, cur := range matches {
+		if i != primary {
+			e.cursors = append(e.cursors, cur)
+		}
+	}
+	return len(matches), nil
+}
+
+// EditAtCursors performs the given edit operation at the regular cursor and at all extra cursors.
+// The edits are done from the end of the document and backwards, so that each edit only needs to
+// adjust the positions of the cursors that have already been handled.
+func (e *Editor) EditAtCursors(c *vt100.Canvas, edit cursorEdit) {
+	all := append([]Cursor{e.dataCursor()}, e.cursors...)
+	order := make([]int, len(all))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return all[order[j]].less(all[order[i]]) })
+
+	for k, i := range order {
+		var adjust func(Cursor) Cursor
+		all[i], adjust = edit(all[i])
+		for _, j := range order[:k] {
+			all[j] = adjust(all[j])
+		}
+	}
+
+	e.setDataCursor(c, all[0])
+	// Cursors that have ended up at the same position are merged
+	e.cursors = nil
+	for _, cur := range all[1:] {
+		e.addCursor(cur)
+	}
+	e.changed = true
+	e.redraw = true
+	e.redrawCursor = true
+}
+
+// cursorLine returns the line at the given cursor, and the cursor x position limited to the length of the line
+func (e *Editor) cursorLine(cur Cursor) ([]rune, int) {
+	line := e.lines.Line(int(cur.y))
+	return line, min(max(cur.x, 0), len(line))
+}
+
+// joinLines joins the line at the given index with the line below
+func (e *Editor) joinLines(y LineIndex) {
+	upper, lower := e.lines.Line(int(y)), e.lines.Line(int(y)+1)
+	joined := make([]rune, 0, len(upper)+len(lower))
+	joined = append(append(joined, upper...), lower...)
+	e.lines.Splice(int(y), 2, [][]rune{joined})
+}
+
+// joinedCursor adjusts a cursor after the line at the given index has been joined with the line below,
+// where the line had the given length before the lines were joined
+func joinedCursor(other Cursor, y LineIndex, length int) Cursor {
+	if other.y == y+1 {
+		return Cursor{other.x + length, y}
+	} else if other.y > y+1 {
+		other.y--
+	}
+	return other
+}
+
+// InsertRuneAtCursors inserts the given rune at every cursor
+func (e *Editor) InsertRuneAtCursors(c *vt100.Canvas, r rune) {
+	e.EditAtCursors(c, func(cur Cursor) (Cursor, func(Cursor) Cursor) {
+		line, x := e.cursorLine(cur)
+		newLine := make([]rune, 0, len(line)+1)
+		newLine = append(append(append(newLine, line[:x]...), r), line[x:]...)
+		e.lines.Set(int(cur.y), newLine)
+		return Cursor{x + 1, cur.y}, func(other Cursor) Cursor {
+			if other.y == cur.y {
+				other.x++
+			}
+			return other
+		}
+	})
+}
+
+// BackspaceAtCursors deletes the rune to the left of every cursor, or joins the line with the line above
+func (e *Editor) BackspaceAtCursors(c *vt100.Canvas) {
+	e.EditAtCursors(c, func(cur Cursor) (Cursor, func(Cursor) Cursor) {
+		line, x := e.cursorLine(cur)
+		if x == 0 {
+			if cur.y == 0 {
+				return Cursor{0, 0}, func(other Cursor) Cursor { return other }
+			}
+			above := cur.y - 1
+			length := len(e.lines.Line(int(above)))
+			e.joinLines(above)
+			return Cursor{length, above}, func(other Cursor) Cursor { return joinedCursor(other, above, length) }
+		}
+		newLine := make([]rune, 0, len(line)-1)
+		newLine = append(append(newLine, line[:x-1]...), line[x:]...)
+		e.lines.Set(int(cur.y), newLine)
+		return Cursor{x - 1, cur.y}, func(other Cursor) Cursor {
+			if other.y == cur.y {
+				other.x--
+			}
+			return other
+		}
+	})
+}
+
+// DeleteAtCursors deletes the rune at every cursor, or joins the line with the line below
+func (e *Editor) DeleteAtCursors(c *vt100.Canvas) {
+	e.EditAtCursors(c, func(cur Cursor) (Cursor, func(Cursor) Cursor) {
+		line, x := e.cursorLine(cur)
+		if x == len(line) {
+			if int(cur.y)+1 >= e.lines.Len() {
+				return Cursor{x, cur.y}, func(other Cursor) Cursor { return other }
+			}
+			e.joinLines(cur.y)
+			return Cursor{x, cur.y}, func(other Cursor) Cursor { return joinedCursor(other, cur.y, x) }
+		}
+		newLine := make([]rune, 0, len(line)-1)
+		newLine = append(append(newLine, line[:x]...), line[x+1:]...)
+		e.lines.Set(int(cur.y), newLine)
+		return Cursor{x, cur.y}, func(other Cursor) Cursor {
+			if other.y == cur.y {
+				other.x--
+			}
+			return other
+		}
+	})
+}
+
+// DeleteRestOfLineAtCursors deletes the rest of the line at every cursor.
+// Lines that end up being empty are removed, like when pressing ctrl-k with only one cursor.
+func (e *Editor) DeleteRestOfLineAtCursors(c *vt100.Canvas) {
+	e.EditAtCursors(c, func(cur Cursor) (Cursor, func(Cursor) Cursor) {
+		line, x := e.cursorLine(cur)
+		if strings.TrimSpace(string(line[:x])) == "" && int(cur.y)+1 < e.lines.Len() {
+			e.lines.Delete(int(cur.y))
+			return Cursor{0, cur.y}, func(other Cursor) Cursor {
+				if other.y == cur.y {
+					other.x = 0
+				} else if other.y > cur.y {
+					other.y--
+				}
+				return other
+			}
+		}
+		e.lines.Set(int(cur.y), line[:x:x])
+		return Cursor{x, cur.y}, func(other Cursor) Cursor {
+			if other.y == cur.y {
+				other.x = x
+			}
+			return other
+		}
+	})
+}
+
+// drawCursors draws the extra cursors that are on the given line, as highlighted letters.
+// y is the line index in the data and sy is the line on the canvas.
+func (e *Editor) drawCursors(c *vt100.Canvas, y LineIndex, cx, sy uint) {
+	for _, cur := range e.cursors {
+		if cur.y != y {
+			continue
+		}
+		line, x := e.cursorLine(cur)
+		r := ' '
+		if x < len(line) && line[x] != '\t' {
+			r = line[x]
+		}
+		sx := e.screenColumn(cur) - e.pos.offsetX
+		if sx >= 0 && cx+uint(sx) < c.Width() {
+			c.WriteRuneBNoLock(cx+uint(sx), sy, vt100.Black, vt100.BackgroundGray, r)
+		}
+	}
+}
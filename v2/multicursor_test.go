@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMultipleCursors(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.InsertStringAndMove(nil, "foo = foo\nbar\nfoo")
+	e.searchTerm = "foo"
+	e.setDataCursor(nil, Cursor{0, 0})
+
+	n, err := e.AddCursorsAtMatches(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || !e.HasCursors() {
+		t.Fatalf("expected 3 cursors, got %d", n)
+	}
+
+	u := NewUndo(defaultUndoCount, defaultUndoMemory)
+	u.Snapshot(e)
+	e.DeleteAtCursors(nil)
+	e.InsertRuneAtCursors(nil, 'g')
+	if e.String() != "goo = goo\nbar\ngoo\n" {
+		t.Fatalf("unexpected contents after editing at every cursor: %q", e.String())
+	}
+	if cur := e.dataCursor(); cur != (Cursor{1, 0}) {
+		t.Fatalf("unexpected position of the regular cursor: %v", cur)
+	}
+
+	// Join the last two lines by deleting at the start of the lines
+	u.Snapshot(e)
+	e.ClearCursors()
+	e.setDataCursor(nil, Cursor{0, 1})
+	if err := e.AddCursorBelow(); err != nil {
+		t.Fatal(err)
+	}
+	e.BackspaceAtCursors(nil)
+	if e.String() != "goo = goobargoo\n" {
+		t.Fatalf("unexpected contents after joining lines at every cursor: %q", e.String())
+	}
+	if len(e.cursors) != 1 || e.cursors[0] != (Cursor{12, 0}) {
+		t.Fatalf("unexpected position of the extra cursor: %v", e.cursors)
+	}
+
+	// Undoing reverts the edits at all cursors at once
+	u.Restore(e)
+	if e.String() != "goo = goo\nbar\ngoo\n" {
+		t.Fatalf("expected the joined lines to be restored, got: %q", e.String())
+	}
+}
+
+func TestDeleteRestOfLineAtCursors(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.InsertStringAndMove(nil, "a: 1\nb: 2\nc: 3")
+	e.setDataCursor(nil, Cursor{1, 0})
+	e.AddCursorBelow()
+	e.AddCursorBelow()
+	e.DeleteRestOfLineAtCursors(nil)
+	if e.String() != "a\nb\nc\n" {
+		t.Fatalf("unexpected contents: %q", e.String())
+	}
+}
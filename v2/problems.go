@@ -0,0 +1,445 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/DataDog/gostackparse"
+	"github.com/xyproto/vt100"
+)
+
+var (
+	// the errors and warnings from the most recent build, for stepping through them with ctrl-n and ctrl-p
+	problems     []Problem
+	problemIndex int
+	problemsMut  sync.RWMutex // also guards grepMatches, grepIndex and grepSearchTerm
+
+	// should ctrl-n and ctrl-p step through the problems? Searching in the current file stops this.
+	problemStepping bool
+
+	// increased every time the problems are replaced, so that the key loop can redraw the highlighted lines
+	problemsVersion int
+
+	errNoProblems = errors.New("no problems")
+
+	// file:line:col: message, as used by gcc, clang, go, zig and many more
+	colonProblemRegexp = regexp.MustCompile(`^([^\s:][^:]*):(\d+):(?:(\d+):)?\s*(.*)$`)
+
+	// file(line,col): message, as used by C# and Free Pascal, or file(line:col) message, as used by Odin
+	parenProblemRegexp = regexp.MustCompile(`^([^\s(][^(]*)\((\d+)[,:](\d+)\)\s*:?\s*(.*)$`)
+
+	// error[E0425]: message, followed by --> file:line:col, as used by rustc and cargo
+	rustMessageRegexp  = regexp.MustCompile(`^(error|warning)(\[\w+\])?: (.*)$`)
+	rustLocationRegexp = regexp.MustCompile(`^\s*--> (.+):(\d+):(\d+)$`)
+
+	// thread 'main' panicked at src/main.rs:4:5: (followed by the message on the next line),
+	// or thread 'main' panicked at 'message', src/main.rs:4:5, as used by cargo test and Rust programs
+	rustPanicRegexp = regexp.MustCompile(`panicked at (?:'(.*)', )?([^\s:']+):(\d+):(\d+):?$`)
+
+	// an indented file_test.go:42: message, as used by go test
+	goTestRegexp = regexp.MustCompile(`^\s+(\S+_test\.go):(\d+): (.*)$`)
+)
+
+// Problem is an error or a warning from a build, at a location in a file
+type Problem struct {
+	Filename string     // the absolute filename
+	Message  string     // the error or warning message
+	Line     LineNumber // the line number
+	Column   ColNumber  // the column number, or 0 if it is not known
+	Warning  bool       // is this a warning and not an error?
+}
+
+// String returns the problem as file:line:col: message, with the filename relative to the given directory
+func (p Problem) String(dir string) string {
+	filename := p.Filename
+	if rel, err := filepath.Rel(dir, filename); err == nil && !strings.HasPrefix(rel, "..") {
+		filename = rel
+	}
+	location := fmt.Sprintf("%s:%d", filename, p.Line)
+	if p.Column > 0 {
+		location += fmt.Sprintf(":%d", p.Column)
+	}
+	if p.Warning {
+		return location + ": warning: " + p.Message
+	}
+	return location + ": " + p.Message
+}
+
+// newProblem creates a problem from the parts of a parsed line of build output.
+// Returns false if the file does not exist, or if the message is only a note.
+func newProblem(dir, filename, lineString, columnString, message string) (Problem, bool) {
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(dir, filename)
+	}
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return Problem{}, false
+	}
+	if fi, err := os.Stat(absFilename); err != nil || !fi.Mode().IsRegular() {
+		return Problem{}, false
+	}
+	lineNumber, err := strconv.Atoi(lineString)
+	if err != nil {
+		return Problem{}, false
+	}
+	columnNumber, _ := strconv.Atoi(columnString)
+	message = strings.TrimSpace(message)
+	lowerMessage := strings.ToLower(message)
+	if strings.HasPrefix(lowerMessage, "note") {
+		return Problem{}, false
+	}
+	warning := strings.HasPrefix(lowerMessage, "warning")
+	for _, prefix := range []string{"fatal error:", "error:", "warning:", "error", "warning"} {
+		if strings.HasPrefix(lowerMessage, prefix) {
+			message = strings.TrimSpace(message[len(prefix):])
+			break
+		}
+	}
+	return Problem{absFilename, message, LineNumber(lineNumber), ColNumber(columnNumber), warning}, true
+}
+
+// ParseProblems finds all errors and warnings with a location in the given build output.
+// Relative filenames are relative to the given directory. Only files that exist are included.
+func ParseProblems(output, dir string) []Problem {
+	var (
+		found       []Problem
+		rustMessage string
+		rustWarning bool
+	)
+	add := func(p Problem) {
+		for _, existing := range found {
+			if existing == p {
+				return
+			}
+		}
+		found = append(found, p)
+	}
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if m := goTestRegexp.FindStringSubmatch(line); m != nil {
+			if p, ok := newProblem(dir, m[1], m[2], "", m[3]); ok {
+				add(p)
+			}
+			continue
+		}
+		if m := rustPanicRegexp.FindStringSubmatch(line); m != nil {
+			message := m[1]
+			if message == "" && i+1 < len(lines) {
+				message = lines[i+1]
+			}
+			if p, ok := newProblem(dir, m[2], m[3], m[4], "panic: "+message); ok {
+				add(p)
+			}
+			continue
+		}
+		if m := rustMessageRegexp.FindStringSubmatch(line); m != nil {
+			rustMessage, rustWarning = m[3], m[1] == "warning"
+			continue
+		}
+		if m := rustLocationRegexp.FindStringSubmatch(line); m != nil {
+			if rustMessage != "" {
+				if p, ok := newProblem(dir, m[1], m[2], m[3], rustMessage); ok {
+					p.Warning = rustWarning
+					add(p)
+				}
+				rustMessage = ""
+			}
+			continue
+		}
+		if m := colonProblemRegexp.FindStringSubmatch(line); m != nil {
+			if p, ok := newProblem(dir, m[1], m[2], m[3], m[4]); ok {
+				add(p)
+			}
+			continue
+		}
+		if m := parenProblemRegexp.FindStringSubmatch(line); m != nil {
+			if p, ok := newProblem(dir, m[1], m[2], m[3], m[4]); ok {
+				add(p)
+			}
+		}
+	}
+	if p, ok := ParseGoPanic(output, dir); ok {
+		add(p)
+	}
+	return found
+}
+
+// ParseGoPanic finds the location of a Go panic in the given output, by parsing the goroutine trace with
+// gostackparse. The location is the innermost function call in a file under the given directory.
+// Returns false if there is no panic, or if it did not happen in a file under the given directory.
+func ParseGoPanic(output, dir string) (Problem, bool) {
+	var message string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "panic: ") {
+			message = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), "[recovered]"))
+			break
+		}
+	}
+	traceStart := strings.Index(output, "\ngoroutine ")
+	if message == "" || traceStart == -1 {
+		return Problem{}, false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return Problem{}, false
+	}
+	// The trace ends at the first line that is neither a goroutine header, a function call followed by
+	// a tab indented location, nor a blank line, like the "exit status 2" line that "go run" adds
+	traceLines := strings.Split(output[traceStart+1:], "\n")
+	for i, line := range traceLines {
+		if line == "" || strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "goroutine ") {
+			continue
+		}
+		if i+1 == len(traceLines) || !strings.HasPrefix(traceLines[i+1], "\t") {
+			traceLines = traceLines[:i]
+			break
+		}
+	}
+	goroutines, _ := gostackparse.Parse(strings.NewReader(strings.Join(traceLines, "\n")))
+	for _, g := range goroutines {
+		for _, frame := range g.Stack {
+			if !strings.HasPrefix(frame.File, absDir+string(filepath.Separator)) {
+				continue
+			}
+			if p, ok := newProblem(absDir, frame.File, strconv.Itoa(frame.Line), "", message); ok {
+				return p, true
+			}
+		}
+	}
+	return Problem{}, false
+}
+
+// SetProblems replaces the problems list. If step is true and there are problems, ctrl-n and ctrl-p will
+// step through them, instead of through the results of the last search in all files, until esc is pressed.
+// step should only be true if the build failed, so that warnings alone do not take over ctrl-n and ctrl-p.
+func SetProblems(ps []Problem, step bool) {
+	problemsMut.Lock()
+	problems = ps
+	problemIndex = -1
+	problemsVersion++
+	problemStepping = step && len(ps) > 0
+	if problemStepping {
+		grepMatches = nil
+	}
+	problemsMut.Unlock()
+}
+
+// setProblemStepping sets if ctrl-n and ctrl-p should step through the problems
+func setProblemStepping(stepping bool) {
+	problemsMut.Lock()
+	problemStepping = stepping
+	problemsMut.Unlock()
+}
+
+// ProblemStepping checks if ctrl-n and ctrl-p should step through the problems from the last build
+func ProblemStepping() bool {
+	problemsMut.RLock()
+	defer problemsMut.RUnlock()
+	return problemStepping && len(problems) > 0
+}
+
+// ProblemsVersion returns a number that changes every time the problems are replaced
+func ProblemsVersion() int {
+	problemsMut.RLock()
+	defer problemsMut.RUnlock()
+	return problemsVersion
+}
+
+// HasProblems checks if the most recent build had any errors or warnings
+func HasProblems() bool {
+	problemsMut.RLock()
+	defer problemsMut.RUnlock()
+	return len(problems) > 0
+}
+
+// problemLines returns the first problem for each line of the current file, if there are any
+func (e *Editor) problemLines() map[LineIndex]Problem {
+	problemsMut.RLock()
+	defer problemsMut.RUnlock()
+	if len(problems) == 0 {
+		return nil
+	}
+	absFilename, err := filepath.Abs(e.filename)
+	if err != nil {
+		return nil
+	}
+	lines := make(map[LineIndex]Problem)
+	for _, p := range problems {
+		if p.Filename != absFilename {
+			continue
+		}
+		if existing, ok := lines[p.Line.LineIndex()]; !ok || (existing.Warning && !p.Warning) {
+			lines[p.Line.LineIndex()] = p
+		}
+	}
+	return lines
+}
+
+// drawProblem highlights a line that has an error or warning, draws the message after the end of the line
+// and marks the line with E or W in the rightmost column.
+// cx is where the line starts on the screen and x is where it ends.
+func (e *Editor) drawProblem(c *vt100.Canvas, p Problem, cx, x, y, w uint) {
+	color := e.StatusErrorForeground
+	if p.Warning {
+		color = e.XColor
+	}
+	for i := cx; i < x && i < w; i++ {
+		if r, err := c.At(i, y); err == nil {
+			c.WriteRuneBNoLock(i, y, color, e.Background.Background(), r)
+		}
+	}
+	if w < 2 {
+		return
+	}
+	e.drawLineMessage(c, p.Message, color, x+2, y, w-2)
+	// Mark the line in the rightmost column as well, since the message may not fit
+	marker := 'E'
+	if p.Warning {
+		marker = 'W'
+	}
+	c.WriteRuneBNoLock(w-1, y, color, e.Background.Background(), marker)
+}
+
+// drawLineMessage draws a single line message at the given position, after the end of a line
+func (e *Editor) drawLineMessage(c *vt100.Canvas, message string, color vt100.AttributeColor, x, y, w uint) {
+	if x+2 >= w {
+		return
+	}
+	message = strings.Join(strings.Fields(message), " ")
+	if runes := []rune(message); uint(len(runes)) > w-x {
+		message = string(runes[:w-x])
+	}
+	c.Write(x, y, color, e.Background, message)
+}
+
+// moveToFirstProblem moves the cursor to the first error (or warning) in the given list, and switches to the file
+// of the problem first, if it is in another file. Returns the message of the problem as an error, or the last line
+// of the output if there are no problems.
+func (e *Editor) moveToFirstProblem(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, sourceFilename string, ps []Problem, output string) error {
+	if len(ps) == 0 {
+		lines := strings.Split(strings.TrimSpace(output), "\n")
+		if lastLine := strings.TrimSpace(lines[len(lines)-1]); lastLine != "" {
+			return errors.New(lastLine)
+		}
+		return errors.New("build error")
+	}
+	p := ps[0]
+	for _, candidate := range ps {
+		if !candidate.Warning {
+			p = candidate
+			break
+		}
+	}
+	if p.Filename != sourceFilename {
+		if tty == nil || e.Switch(c, tty, status, fileLock, p.Filename) != nil {
+			return errors.New("In " + filepath.Base(p.Filename) + ": " + p.Message)
+		}
+	}
+	e.redraw, _ = e.GoTo(p.Line.LineIndex(), c, status)
+	if p.Column > 0 {
+		e.setDataCursor(c, Cursor{int(p.Column) - 1, p.Line.LineIndex()})
+	}
+	e.redrawCursor = true
+	return errors.New(p.Message)
+}
+
+// GoToProblem opens the file of the given problem, if it is not already open, and moves the cursor to the problem
+func (e *Editor) GoToProblem(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, p Problem) error {
+	if absFilename, err := e.AbsFilename(); err != nil || absFilename != p.Filename {
+		if err := e.Switch(c, tty, status, lk, p.Filename); err != nil {
+			return err
+		}
+	}
+	e.GoToLineNumber(p.Line, c, status, true)
+	if p.Column > 0 {
+		e.setDataCursor(c, Cursor{int(p.Column) - 1, p.Line.LineIndex()})
+	}
+	e.HorizontalScrollIfNeeded(c)
+	e.redraw = true
+	e.redrawCursor = true
+	return nil
+}
+
+// NextProblem goes to the next (or previous) problem from the most recent build, with wraparound
+func (e *Editor) NextProblem(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, forward bool) error {
+	problemsMut.Lock()
+	n := len(problems)
+	if n == 0 {
+		problemsMut.Unlock()
+		return errNoProblems
+	}
+	if forward {
+		problemIndex = (problemIndex + 1) % n
+	} else if problemIndex <= 0 {
+		problemIndex = n - 1
+	} else {
+		problemIndex--
+	}
+	index, p := problemIndex, problems[problemIndex]
+	problemsMut.Unlock()
+	if err := e.GoToProblem(c, tty, status, lk, p); err != nil {
+		return err
+	}
+	status.SetMessageAfterRedraw(fmt.Sprintf("%d of %d: %s", index+1, n, p.Message))
+	return nil
+}
+
+// ProblemsMenu shows the errors and warnings from the most recent build in a menu, and goes to the selected one
+func (e *Editor) ProblemsMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper) error {
+	problemsMut.RLock()
+	ps := append([]Problem{}, problems...)
+	initialIndex := max(problemIndex, 0)
+	problemsMut.RUnlock()
+	if len(ps) == 0 {
+		return errNoProblems
+	}
+
+	// Make room for the menu title and margins
+	maxEntries := 20
+	if c != nil && int(c.H())-6 > 3 {
+		maxEntries = int(c.H()) - 6
+	}
+	shown := ps
+	if len(shown) > maxEntries {
+		shown = shown[:maxEntries]
+	}
+	if initialIndex >= len(shown) {
+		initialIndex = 0
+	}
+
+	root := ProjectRoot(e.filename)
+	menuChoices := make([]string, len(shown))
+	errorCount := 0
+	for i, p := range ps {
+		if i < len(shown) {
+			menuChoices[i] = p.String(root)
+		}
+		if !p.Warning {
+			errorCount++
+		}
+	}
+	title := fmt.Sprintf("%d errors and %d warnings", errorCount, len(ps)-errorCount)
+	selected := e.Menu(status, tty, title, menuChoices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, initialIndex, false)
+	if selected < 0 {
+		return nil
+	}
+
+	problemsMut.Lock()
+	problemIndex = selected
+	problemStepping = true
+	grepMatches = nil
+	problemsMut.Unlock()
+
+	if err := e.GoToProblem(c, tty, status, lk, ps[selected]); err != nil {
+		return err
+	}
+	status.SetMessageAfterRedraw(fmt.Sprintf("%d of %d: %s, press ctrl-n or ctrl-p for the next or previous problem", selected+1, len(ps), ps[selected].Message))
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseProblems(t *testing.T) {
+	dir := t.TempDir()
+	for _, filename := range []string{"main.c", "main.go", "Program.cs"} {
+		if err := os.WriteFile(filepath.Join(dir, filename), []byte("\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "src", "main.rs"), []byte("\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := `main.c: In function 'main':
+main.c:3:5: warning: unused variable 'x' [-Wunused-variable]
+main.c:4:1: note: declared here
+main.c:5:12: error: expected ';' before '}' token
+# example.com/hello
+./main.go:7:2: undefined: asdf
+missing.go:1:1: error: this file does not exist
+error[E0425]: cannot find value ` + "`y`" + ` in this scope
+  --> src/main.rs:12:5
+warning: unused variable: ` + "`z`" + `
+ --> src/main.rs:2:9
+Program.cs(5,9): error CS1002: ; expected
+`
+	found := ParseProblems(output, dir)
+	expected := []Problem{
+		{filepath.Join(dir, "main.c"), "unused variable 'x' [-Wunused-variable]", 3, 5, true},
+		{filepath.Join(dir, "main.c"), "expected ';' before '}' token", 5, 12, false},
+		{filepath.Join(dir, "main.go"), "undefined: asdf", 7, 2, false},
+		{filepath.Join(dir, "src", "main.rs"), "cannot find value `y` in this scope", 12, 5, false},
+		{filepath.Join(dir, "src", "main.rs"), "unused variable: `z`", 2, 9, true},
+		{filepath.Join(dir, "Program.cs"), "CS1002: ; expected", 5, 9, false},
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("expected %d problems, got %d: %+v", len(expected), len(found), found)
+	}
+	for i := range expected {
+		if found[i] != expected[i] {
+			t.Errorf("problem %d: expected %+v, got %+v", i, expected[i], found[i])
+		}
+	}
+
+	if s := found[0].String(dir); s != "main.c:3:5: warning: unused variable 'x' [-Wunused-variable]" {
+		t.Errorf("unexpected problem string: %q", s)
+	}
+}
+
+func TestProblemLines(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "main.c")
+	SetProblems([]Problem{
+		{filename, "a warning", 2, 1, true},
+		{filename, "an error", 2, 3, false},
+		{filepath.Join(dir, "other.c"), "elsewhere", 1, 1, false},
+	}, false)
+	defer SetProblems(nil, false)
+
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	lines := e.problemLines()
+	if len(lines) != 1 || lines[1].Message != "an error" {
+		t.Fatalf("expected the error to be preferred over the warning on line 2, got %+v", lines)
+	}
+}
+
+func TestParseTestFailuresAndPanics(t *testing.T) {
+	dir := t.TempDir()
+	for _, filename := range []string{"main.go", "main_test.go", "hello.erl"} {
+		if err := os.WriteFile(filepath.Join(dir, filename), []byte("\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "src", "lib.rs"), []byte("\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	goTestOutput := "--- FAIL: TestAdd (0.00s)\n    main_test.go:42: expected 4, got 5\nFAIL\nexit status 1\nFAIL\texample.com/hello\t0.002s\n"
+	if found := ParseProblems(goTestOutput, dir); len(found) != 1 || found[0].Line != 42 || found[0].Message != "expected 4, got 5" {
+		t.Fatalf("unexpected problems for go test: %+v", found)
+	}
+
+	goPanicOutput := "panic: runtime error: index out of range [3] with length 3\n\ngoroutine 1 [running]:\nmain.lookup(...)\n\t" + filepath.Join(dir, "main.go") + ":12\nmain.main()\n\t" + filepath.Join(dir, "main.go") + ":7 +0x1d\nexit status 2\n"
+	if found := ParseProblems(goPanicOutput, dir); len(found) != 1 || found[0].Line != 12 || found[0].Message != "panic: runtime error: index out of range [3] with length 3" {
+		t.Fatalf("unexpected problems for a Go panic: %+v", found)
+	}
+
+	cargoTestOutput := "running 1 test\ntest tests::it_works ... FAILED\n\n---- tests::it_works stdout ----\nthread 'tests::it_works' panicked at src/lib.rs:10:9:\nassertion `left == right` failed\n"
+	if found := ParseProblems(cargoTestOutput, dir); len(found) != 1 || found[0].Line != 10 || found[0].Column != 9 || found[0].Message != "panic: assertion `left == right` failed" {
+		t.Fatalf("unexpected problems for cargo test: %+v", found)
+	}
+
+	erlcOutput := "hello.erl:3:1: Warning: function f/0 is unused\nhello.erl:5:14: syntax error before: ')'\n"
+	found := ParseProblems(erlcOutput, dir)
+	if len(found) != 2 || !found[0].Warning || found[1].Warning || found[1].Line != 5 || found[1].Message != "syntax error before: ')'" {
+		t.Fatalf("unexpected problems for erlc: %+v", found)
+	}
+
+	// The cursor should be placed on the first error, and not on the warning
+	e := NewSimpleEditor(80)
+	e.InsertStringAndMove(nil, "-module(hello).\n\nf() -> ok.\n\nstart() -> foo(.\n")
+	err := e.moveToFirstProblem(nil, nil, nil, filepath.Join(dir, "hello.erl"), found, erlcOutput)
+	if err == nil || err.Error() != "syntax error before: ')'" {
+		t.Fatalf("expected the error message, got %v", err)
+	}
+	if e.DataY() != 4 {
+		t.Fatalf("expected the cursor to be on line index 4, got %d", e.DataY())
+	}
+}
+
+func TestProblemStepping(t *testing.T) {
+	defer SetProblems(nil, false)
+	ps := []Problem{{"/tmp/main.go", "unused variable", 2, 1, true}}
+
+	// A build that succeeds with warnings does not take over ctrl-n and ctrl-p
+	grepMatches = []GrepMatch{{}}
+	SetProblems(ps, false)
+	if ProblemStepping() || len(grepMatches) == 0 {
+		t.Fatal("expected the search results to still be stepped through")
+	}
+
+	// A build that fails does, until esc is pressed
+	SetProblems(ps, true)
+	if !ProblemStepping() || len(grepMatches) != 0 {
+		t.Fatal("expected the problems to be stepped through")
+	}
+	StopStepping()
+	if ProblemStepping() || !HasProblems() {
+		t.Fatal("expected the problems to be kept, but not stepped through")
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// ProjectRoot returns the root directory of the git repository that the given file or directory is in,
+// by looking for a .git directory or file. If none is found, the directory of the given file is returned.
+func ProjectRoot(path string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		absPath = path
+	}
+	dir := absPath
+	if fileInfo, err := os.Stat(absPath); err != nil || !fileInfo.IsDir() {
+		dir = filepath.Dir(absPath)
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	return dir
+}
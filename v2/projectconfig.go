@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/mode"
+)
+
+// projectConfigFilenames are the names of the per-project configuration files, that are looked for in the project root
+var projectConfigFilenames = []string{".orbiton.toml", "orbiton.conf"}
+
+// ProjectConfig contains the commands for building, running, testing and formatting the files in a project.
+// The commands are run with "sh -c" in the project root directory, and may contain {file}, {dir} and {root},
+// which are replaced with the absolute path of the current file, its directory and the project root.
+//
+// The configuration file is a simple subset of TOML, for example:
+//
+//	build = "make debug"
+//	run = "./build/app --verbose"
+//	env = ["CGO_ENABLED=0"]
+//	error_regex = '^(?P<file>[^:]+):(?P<line>\d+):(?P<col>\d+): (?P<message>.*)$'
+//
+//	[go]
+//	build = "go build -tags netgo"
+//
+// Sections are named after an editor mode, like "go" or "c++", or a filename extension without the dot, like "rs",
+// and the values in them override the top level values for files of that kind.
+type ProjectConfig struct {
+	Filename   string   // the configuration file that was read
+	Root       string   // the project root directory
+	Build      string   // build command
+	Run        string   // run command
+	Test       string   // test command, where {test} is the name of the test function to run
+	Format     string   // format command, where {file} is the file to format in place
+	ErrorRegex string   // regular expression for error lines, with the named groups file, line, col and message
+	Env        []string // environment variables on the form NAME=value
+}
+
+// parseProjectConfigValue parses a TOML string, a list of strings or an unquoted value
+func parseProjectConfigValue(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		var values []string
+		rest := strings.TrimSpace(value[1 : len(value)-1])
+		for rest != "" {
+			s, n, err := parseProjectConfigString(rest)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, s)
+			rest = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(rest[n:]), ","))
+		}
+		return values, nil
+	}
+	s, n, err := parseProjectConfigString(value)
+	if err != nil {
+		return nil, err
+	}
+	if rest := strings.TrimSpace(value[n:]); rest != "" && !strings.HasPrefix(rest, "#") {
+		return nil, fmt.Errorf("unexpected %q after the value", rest)
+	}
+	return []string{s}, nil
+}
+
+// parseProjectConfigString parses a "basic" or 'literal' string at the start of the given string,
+// or an unquoted value that ends at a comment. Returns the string and how many bytes that were read.
+func parseProjectConfigString(s string) (string, int, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				unquoted, err := strconv.Unquote(s[:i+1])
+				return unquoted, i + 1, err
+			}
+		}
+		return "", 0, fmt.Errorf("unterminated string: %s", s)
+	case strings.HasPrefix(s, "'"):
+		if i := strings.Index(s[1:], "'"); i != -1 {
+			return s[1 : i+1], i + 2, nil
+		}
+		return "", 0, fmt.Errorf("unterminated string: %s", s)
+	}
+	n := len(s)
+	if i := strings.Index(s, " #"); i != -1 {
+		n = i
+	}
+	return strings.TrimSpace(s[:n]), n, nil
+}
+
+// ParseProjectConfig parses the given configuration file contents, for files in the given mode and with the given extension
+func ParseProjectConfig(data []byte, m mode.Mode, ext string) (*ProjectConfig, error) {
+	var (
+		cfg      ProjectConfig
+		section  string
+		scanner  = bufio.NewScanner(strings.NewReader(string(data)))
+		lineNum  int
+		matching = func(section string) bool {
+			return section == "" || strings.EqualFold(section, m.String()) || (ext != "" && strings.EqualFold(section, strings.TrimPrefix(ext, ".")))
+		}
+	)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.Trim(strings.TrimSpace(line[1:len(line)-1]), `"`)
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNum)
+		}
+		if !matching(section) {
+			continue
+		}
+		values, err := parseProjectConfigValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "build":
+			cfg.Build = strings.Join(values, " ")
+		case "run":
+			cfg.Run = strings.Join(values, " ")
+		case "test":
+			cfg.Test = strings.Join(values, " ")
+		case "format":
+			cfg.Format = strings.Join(values, " ")
+		case "error_regex", "errorregex", "error_regexp":
+			cfg.ErrorRegex = strings.Join(values, "")
+		case "env":
+			cfg.Env = append(cfg.Env, values...)
+		default:
+			return nil, fmt.Errorf("line %d: unknown key %q", lineNum, strings.TrimSpace(key))
+		}
+	}
+	if cfg.ErrorRegex != "" {
+		if _, err := regexp.Compile(cfg.ErrorRegex); err != nil {
+			return nil, fmt.Errorf("error_regex: %w", err)
+		}
+	}
+	return &cfg, nil
+}
+
+// LoadProjectConfig reads the configuration file in the project root of the given source file, if there is one.
+// Returns nil and no error if there is no configuration file.
+func LoadProjectConfig(sourceFilename string, m mode.Mode) (*ProjectConfig, error) {
+	root := ProjectRoot(sourceFilename)
+	for _, configFilename := range projectConfigFilenames {
+		configPath := filepath.Join(root, configFilename)
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			continue
+		}
+		cfg, err := ParseProjectConfig(data, m, filepath.Ext(sourceFilename))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", configFilename, err)
+		}
+		cfg.Filename = configPath
+		cfg.Root = root
+		return cfg, nil
+	}
+	return nil, nil
+}
+
+// shellQuote quotes the given string for use in a shell command
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Command creates a command that runs the given shell command in the project root, with the configured
+// environment variables, and with {file}, {dir} and {root} replaced.
+func (cfg *ProjectConfig) Command(shellCommand, sourceFilename string) *exec.Cmd {
+	shellCommand = strings.NewReplacer(
+		"{file}", shellQuote(sourceFilename),
+		"{dir}", shellQuote(filepath.Dir(sourceFilename)),
+		"{root}", shellQuote(cfg.Root),
+	).Replace(shellCommand)
+	cmd := exec.Command("sh", "-c", shellCommand)
+	cmd.Dir = cfg.Root
+	cmd.Env = append(os.Environ(), cfg.Env...)
+	return cmd
+}
+
+// FormatCommand creates a command for formatting a file in place, where the filename is given as the last argument,
+// as expected by formatWithUtility. {file} in the format command is replaced by that filename.
+func (cfg *ProjectConfig) FormatCommand() *exec.Cmd {
+	shellCommand := cfg.Format
+	if strings.Contains(shellCommand, "{file}") {
+		shellCommand = strings.ReplaceAll(shellCommand, "{file}", `"$1"`)
+	} else {
+		shellCommand += ` "$1"`
+	}
+	shellCommand = strings.ReplaceAll(shellCommand, "{root}", shellQuote(cfg.Root))
+	// The last argument is $1, since the argument after the command is $0
+	cmd := exec.Command("sh", "-c", shellCommand, "sh")
+	cmd.Dir = cfg.Root
+	cmd.Env = append(os.Environ(), cfg.Env...)
+	return cmd
+}
+
+// ParseProblemsWithRegexp finds all errors and warnings in the given build output, by using the given
+// regular expression with the named groups file, line, col and message. Only file and line are required.
+func ParseProblemsWithRegexp(output, dir string, re *regexp.Regexp) []Problem {
+	var found []Problem
+	for _, line := range strings.Split(output, "\n") {
+		m := re.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+		var filename, lineString, columnString, message string
+		for i, name := range re.SubexpNames() {
+			switch name {
+			case "file":
+				filename = m[i]
+			case "line":
+				lineString = m[i]
+			case "col", "column":
+				columnString = m[i]
+			case "message", "msg":
+				message = m[i]
+			}
+		}
+		if p, ok := newProblem(dir, filename, lineString, columnString, message); ok {
+			found = append(found, p)
+		}
+	}
+	return found
+}
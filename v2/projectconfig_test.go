@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+const testProjectConfig = `# build configuration
+build = "make debug"
+run = './build/app --verbose' # a comment
+env = ["CGO_ENABLED=0", "FOO=bar baz"]
+error_regex = '^(?P<file>[^:]+):(?P<line>\d+): (?P<message>.*)$'
+
+[go]
+build = "go build -tags netgo"
+format = gofumpt -w
+
+[rs]
+test = "cargo nextest run"
+`
+
+func TestParseProjectConfig(t *testing.T) {
+	cfg, err := ParseProjectConfig([]byte(testProjectConfig), mode.Go, ".go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Build != "go build -tags netgo" || cfg.Run != "./build/app --verbose" || cfg.Format != "gofumpt -w" || cfg.Test != "" {
+		t.Fatalf("unexpected configuration for Go: %+v", cfg)
+	}
+	if len(cfg.Env) != 2 || cfg.Env[1] != "FOO=bar baz" {
+		t.Fatalf("unexpected environment: %q", cfg.Env)
+	}
+	if cfg.ErrorRegex != `^(?P<file>[^:]+):(?P<line>\d+): (?P<message>.*)$` {
+		t.Fatalf("unexpected error regex: %q", cfg.ErrorRegex)
+	}
+
+	cfg, err = ParseProjectConfig([]byte(testProjectConfig), mode.Rust, ".rs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Build != "make debug" || cfg.Test != "cargo nextest run" || cfg.Format != "" {
+		t.Fatalf("unexpected configuration for Rust: %+v", cfg)
+	}
+
+	if _, err := ParseProjectConfig([]byte("bulid = make\n"), mode.Go, ".go"); err == nil {
+		t.Fatal("expected an error for an unknown key")
+	}
+	if _, err := ParseProjectConfig([]byte("error_regex = '('\n"), mode.Go, ".go"); err == nil {
+		t.Fatal("expected an error for an invalid regular expression")
+	}
+}
+
+func TestProjectConfigCommands(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(root, "src")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sourceFilename := filepath.Join(sub, "main.c")
+	if err := os.WriteFile(sourceFilename, []byte("int main() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := "build = 'echo \"$GREETING\" {file}'\nformat = \"sed -i s/main/start/ {file}\"\nenv = \"GREETING=hello\"\n"
+	if err := os.WriteFile(filepath.Join(root, ".orbiton.toml"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewSimpleEditor(80)
+	e.mode = mode.C
+	cmd, _, err := e.GenerateBuildCommand(sourceFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Dir != root {
+		t.Fatalf("expected the build command to run in the project root, got %q", cmd.Dir)
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(output)) != "hello "+sourceFilename {
+		t.Fatalf("unexpected output from the build command: %q", output)
+	}
+
+	cfg, err := LoadProjectConfig(sourceFilename, mode.C)
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatCmd := cfg.FormatCommand()
+	formatCmd.Args = append(formatCmd.Args, sourceFilename)
+	if output, err := formatCmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+	if data, _ := os.ReadFile(sourceFilename); string(data) != "int start() {}\n" {
+		t.Fatalf("expected the file to be formatted, got %q", data)
+	}
+}
+
+func TestParseProblemsWithRegexp(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "build.ninja"), []byte("\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	re := regexp.MustCompile(`^ERROR at (?P<file>\S+) line (?P<line>\d+): (?P<message>.*)$`)
+	found := ParseProblemsWithRegexp("starting\nERROR at build.ninja line 3: bad rule\n", dir, re)
+	if len(found) != 1 || found[0].Line != 3 || found[0].Message != "bad rule" || found[0].Filename != filepath.Join(dir, "build.ninja") {
+		t.Fatalf("unexpected problems: %+v", found)
+	}
+}
@@ -27,8 +27,7 @@ func (e *Editor) ReadFileAndProcessLines(filename string) error {
 
 	var (
 		reader           = bufio.NewReader(bytes.NewReader(data))
-		lines            = make(map[int][]rune)
-		index            int
+		lines            [][]rune
 		tabIndentCounter int64
 		first            byte
 	)
@@ -43,7 +42,7 @@ func (e *Editor) ReadFileAndProcessLines(filename string) error {
 			line = line[:len(line)-1]
 		}
 		if e.binaryFile {
-			lines[index] = []rune(line)
+			lines = append(lines, []rune(line))
 		} else {
 			line = opinionatedStringReplacer.Replace(line)
 			if len(line) > 2 {
@@ -54,16 +53,15 @@ func (e *Editor) ReadFileAndProcessLines(filename string) error {
 					tabIndentCounter--
 				}
 			}
-			lines[index] = []rune(line)
+			lines = append(lines, []rune(line))
 		}
-		index++
 
 		if err == io.EOF {
 			break
 		}
 	}
 	e.Clear()
-	e.lines = lines
+	e.lines = NewRope(lines)
 	if detectedTabs := tabIndentCounter > 0; !e.binaryFile && e.indentation.Spaces {
 		e.detectedTabs = &detectedTabs
 		e.indentation.Spaces = !detectedTabs
@@ -72,8 +70,8 @@ func (e *Editor) ReadFileAndProcessLines(filename string) error {
 	return nil
 }
 
-// LoadByteLine loads a single byte line
-func (e *Editor) LoadByteLine(ib IndexByteLine, eMut, tcMut *sync.RWMutex, tabIndentCounter, numLines *int, wg *sync.WaitGroup) {
+// LoadByteLine loads a single byte line into the given slice of lines
+func (e *Editor) LoadByteLine(ib IndexByteLine, lines [][]rune, eMut, tcMut *sync.RWMutex, tabIndentCounter, numLines *int, wg *sync.WaitGroup) {
 	// Require at least two bytes. Ignore lines with a single tab indentation or a single space
 	if len(ib.byteLine) > 2 {
 		first := ib.byteLine[0]
@@ -87,8 +85,8 @@ func (e *Editor) LoadByteLine(ib IndexByteLine, eMut, tcMut *sync.RWMutex, tabIn
 			tcMut.Unlock()
 		}
 	}
+	lines[ib.index] = []rune(string(ib.byteLine))
 	eMut.Lock()
-	e.lines[ib.index] = []rune(string(ib.byteLine))
 	*numLines++
 	eMut.Unlock()
 	wg.Done()
@@ -96,9 +94,7 @@ func (e *Editor) LoadByteLine(ib IndexByteLine, eMut, tcMut *sync.RWMutex, tabIn
 
 // LoadBytes replaces the current editor contents with the given bytes
 func (e *Editor) LoadBytes(data []byte) {
-	// Prepare an empty map to load the lines into
 	e.Clear()
-	e.lines = make(map[int][]rune, 0)
 
 	e.binaryFile = binary.Data(data)
 
@@ -106,6 +102,9 @@ func (e *Editor) LoadBytes(data []byte) {
 		// Split the bytes into lines
 		byteLines = bytes.Split(data, []byte{'\n'})
 
+		// Prepare a slice to load the lines into
+		lines = make([][]rune, len(byteLines))
+
 		// Place the lines into the editor, while counting tab indentations vs space indentations
 		tabIndentCounter int
 
@@ -122,15 +121,17 @@ func (e *Editor) LoadBytes(data []byte) {
 	var wg sync.WaitGroup
 	for index, byteLine := range byteLines {
 		wg.Add(1)
-		go e.LoadByteLine(IndexByteLine{byteLine, index}, &eMut, &tcMut, &tabIndentCounter, &numLines, &wg)
+		go e.LoadByteLine(IndexByteLine{byteLine, index}, lines, &eMut, &tcMut, &tabIndentCounter, &numLines, &wg)
 	}
 	wg.Wait()
 
 	// If the last line is empty, delete it
-	if numLines > 0 && len(e.lines[numLines-1]) == 0 {
-		delete(e.lines, numLines-1)
+	if numLines > 0 && len(lines[numLines-1]) == 0 {
+		lines = lines[:numLines-1]
 	}
 
+	e.lines = NewRope(lines)
+
 	if detectedTabs := tabIndentCounter > 0; detectedTabs && e.indentation.Spaces {
 		// Check if there were more tab indentations than space indentations
 		e.detectedTabs = &detectedTabs
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+// StartRectangularSelection anchors a new rectangular selection at the current position.
+// A rectangular selection covers the same screen columns on every line, like a column in a table.
+func (e *Editor) StartRectangularSelection() {
+	e.selection = &Selection{anchor: e.dataCursor(), rectangular: true, column: e.pos.offsetX + e.pos.sx}
+}
+
+// HasRectangularSelection checks if a rectangular selection is active
+func (e *Editor) HasRectangularSelection() bool {
+	return e.selection != nil && e.selection.rectangular
+}
+
+// RectangleBounds returns the first and the last line of the rectangular selection,
+// and the first screen column and the screen column right after the rectangle
+func (e *Editor) RectangleBounds() (LineIndex, LineIndex, int, int) {
+	first, last := min(e.selection.anchor.y, LineIndex(e.Len()-1)), e.DataY()
+	if last < first {
+		first, last = last, first
+	}
+	left, right := e.selection.column, e.pos.offsetX+e.pos.sx
+	if right < left {
+		left, right = right, left
+	}
+	return first, last, left, right + 1
+}
+
+// runeWidth returns the number of screen columns the given rune uses
+func (e *Editor) runeWidth(r rune) int {
+	if r == '\t' {
+		return e.indentation.PerTab
+	}
+	return 1
+}
+
+// columnRange returns the rune indices of the runes on the given line that start within the given
+// screen columns. right is the screen column right after the range.
+func (e *Editor) columnRange(line []rune, left, right int) (int, int) {
+	start, end, col := len(line), len(line), 0
+	for i, r := range line {
+		if col >= left && start == len(line) {
+			start = i
+		}
+		if col >= right {
+			end = i
+			break
+		}
+		col += e.runeWidth(r)
+	}
+	return min(start, end), end
+}
+
+// padLine returns the given line with spaces added to the end, so that it is at least the given number of screen columns wide
+func (e *Editor) padLine(line []rune, width int) []rune {
+	col := 0
+	for _, r := range line {
+		col += e.runeWidth(r)
+	}
+	if col >= width {
+		return line
+	}
+	padded := make([]rune, 0, len(line)+width-col)
+	padded = append(padded, line...)
+	for ; col < width; col++ {
+		padded = append(padded, ' ')
+	}
+	return padded
+}
+
+// RectangleLines returns the text within the rectangular selection, one string per line
+func (e *Editor) RectangleLines() []string {
+	first, last, left, right := e.RectangleBounds()
+	lines := make([]string, 0, last-first+1)
+	for y := first; y <= last; y++ {
+		line := e.lines.Line(int(y))
+		start, end := e.columnRange(line, left, right)
+		lines = append(lines, string(line[start:end]))
+	}
+	return lines
+}
+
+// DeleteRectangle removes the text within the rectangular selection, moves the cursor to the
+// upper left corner of the rectangle and stops selecting text
+func (e *Editor) DeleteRectangle(c *vt100.Canvas) {
+	if !e.HasRectangularSelection() {
+		return
+	}
+	first, last, left, right := e.RectangleBounds()
+	for y := first; y <= last; y++ {
+		line := e.lines.Line(int(y))
+		start, end := e.columnRange(line, left, right)
+		if start == end {
+			continue
+		}
+		newLine := make([]rune, 0, len(line)-(end-start))
+		newLine = append(append(newLine, line[:start]...), line[end:]...)
+		e.lines.Set(int(y), newLine)
+	}
+	e.selection = nil
+	e.changed = true
+	e.redraw = true
+	e.redrawCursor = true
+	start, _ := e.columnRange(e.lines.Line(int(first)), left, left)
+	e.setDataCursor(c, Cursor{start, first})
+}
+
+// PasteRectangle inserts the given lines as a rectangle, with the upper left corner at the cursor.
+// Lines that are too short are padded with spaces, and lines are added at the end of the document if needed.
+func (e *Editor) PasteRectangle(c *vt100.Canvas, lines []string) {
+	cur, col := e.dataCursor(), e.pos.offsetX+e.pos.sx
+	for i, text := range lines {
+		y := int(cur.y) + i
+		if y >= e.lines.Len() {
+			e.lines.Append(nil)
+		}
+		line := e.padLine(e.lines.Line(y), col)
+		x, _ := e.columnRange(line, col, col)
+		newLine := make([]rune, 0, len(line)+len(text))
+		newLine = append(append(append(newLine, line[:x]...), []rune(text)...), line[x:]...)
+		e.lines.Set(y, newLine)
+	}
+	e.changed = true
+	e.redraw = true
+	e.redrawCursor = true
+	e.setDataCursor(c, cur)
+}
+
+// RectangleToCursors places a cursor at the left edge of the rectangular selection, on every selected line,
+// so that text can be typed on every line. If deleteContents is true, the selected text is removed first.
+// Lines that are too short are padded with spaces. The regular cursor stays on the current line.
+func (e *Editor) RectangleToCursors(c *vt100.Canvas, deleteContents bool) {
+	if !e.HasRectangularSelection() {
+		return
+	}
+	first, last, left, _ := e.RectangleBounds()
+	current := e.DataY()
+	if deleteContents {
+		e.DeleteRectangle(c)
+	}
+	e.selection = nil
+	e.cursors = nil
+	for y := first; y <= last; y++ {
+		line := e.padLine(e.lines.Line(int(y)), left)
+		e.lines.Set(int(y), line)
+		x, _ := e.columnRange(line, left, left)
+		if y == current {
+			e.setDataCursor(c, Cursor{x, y})
+		} else {
+			e.cursors = append(e.cursors, Cursor{x, y})
+		}
+	}
+	e.changed = true
+	e.redraw = true
+	e.redrawCursor = true
+}
+
+// drawRectangle draws the part of the rectangular selection that is on the given line, if any.
+// y is the line index in the data and sy is the line on the canvas.
+func (e *Editor) drawRectangle(c *vt100.Canvas, y LineIndex, cx, sy uint) {
+	first, last, left, right := e.RectangleBounds()
+	if y < first || y > last {
+		return
+	}
+	// Expand the tabs, so that there is one rune per screen column
+	cells := []rune(strings.ReplaceAll(string(e.lines.Line(int(y))), "\t", strings.Repeat(" ", e.indentation.PerTab)))
+	for col := left; col < right; col++ {
+		r := ' '
+		if col < len(cells) {
+			r = cells[col]
+		}
+		if sx := col - e.pos.offsetX; sx >= 0 && cx+uint(sx) < c.Width() {
+			c.WriteRuneBNoLock(cx+uint(sx), sy, e.SelectionForeground, e.SelectionBackground, r)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRectangularSelection(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.InsertStringAndMove(nil, "a   b   c\nxx  yy  zz\n1   2")
+
+	// Select the second column, from "b" on the first line to after "2" on the last line
+	e.setDataCursor(nil, Cursor{4, 0})
+	e.StartRectangularSelection()
+	e.setDataCursor(nil, Cursor{5, 2})
+	lines := e.RectangleLines()
+	if len(lines) != 3 || lines[0] != "b " || lines[1] != "yy" || lines[2] != "2" {
+		t.Fatalf("unexpected selected columns: %q", lines)
+	}
+
+	e.DeleteRectangle(nil)
+	if e.String() != "a     c\nxx    zz\n1   \n" {
+		t.Fatalf("unexpected contents after deleting the columns: %q", e.String())
+	}
+	if e.HasSelection() || e.dataCursor() != (Cursor{4, 0}) {
+		t.Fatalf("expected no selection and the cursor in the upper left corner, got %v", e.dataCursor())
+	}
+
+	e.setDataCursor(nil, Cursor{0, 1})
+	e.PasteRectangle(nil, lines)
+	if e.String() != "a     c\nb xx    zz\nyy1   \n2\n" {
+		t.Fatalf("unexpected contents after pasting the columns: %q", e.String())
+	}
+}
+
+func TestTypeInRectangle(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.InsertStringAndMove(nil, "abc\nd\nefg")
+
+	e.setDataCursor(nil, Cursor{2, 0})
+	e.StartRectangularSelection()
+	e.setDataCursor(nil, Cursor{2, 2})
+	e.RectangleToCursors(nil, true)
+	e.InsertRuneAtCursors(nil, 'X')
+	if e.String() != "abX\nd X\nefX\n" {
+		t.Fatalf("unexpected contents after typing on every line: %q", e.String())
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xyproto/vt100"
+)
+
+// ReplaceWithConfirmation goes through the matches of the search term, from the current line and wrapping around,
+// and asks the user for each match: y to replace it, n to skip it, a to replace it and all the remaining matches,
+// or q to stop. The search term is a regular expression if searching for regular expressions is enabled, and then
+// the replacement text can refer to the capture groups as $1, $2 and so on. All replacements are recorded as one undo step.
+// Returns the number of replacements.
+func (e *Editor) ReplaceWithConfirmation(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, undo *Undo, searchFor, replaceWith string) int {
+	undo.Snapshot(e)
+
+	e.searchTerm = searchFor
+	defer e.ClearSelection()
+
+	var (
+		counter int
+		all     bool
+		startY  = e.DataY()
+		n       = LineIndex(e.Len())
+	)
+
+OUT:
+	for i := LineIndex(0); i < n; i++ {
+		y := (startY + i) % n
+		// Matches are found in the original line, so that ^ and \b only match where they did before replacing
+		var (
+			line = e.Line(y)
+			sb   strings.Builder // the line up to the end of the last replaced match
+			last int             // the end of the last replaced match, in the original line
+			from int
+		)
+		for {
+			start, end, replacement := searchMatch(line, from, searchFor, replaceWith)
+			if start == -1 {
+				break
+			}
+			if !all {
+				// Select the match, so that it stands out, and then ask the user
+				currentLine := sb.String() + line[last:]
+				offset := sb.Len() - last
+				startX, endX := utf8.RuneCountInString(currentLine[:start+offset]), utf8.RuneCountInString(currentLine[:end+offset])
+				e.ClearSelection()
+				e.setDataCursor(c, Cursor{startX, y})
+				if endX > startX {
+					e.StartSelection(false)
+					e.setDataCursor(c, Cursor{endX - 1, y})
+				}
+				e.Center(c)
+				e.DrawLines(c, true, false)
+				status.ClearAll(c)
+				status.SetMessage(fmt.Sprintf("Replace with %q? (y/n/a/q)", replacement))
+				status.ShowNoTimeout(c, e)
+				switch tty.String() {
+				case "y", "Y", " ", "c:13":
+				case "a", "A", "!":
+					all = true
+				case "n", "N", "c:14":
+					from = nextSearchFrom(line, start, end)
+					continue
+				case "q", "Q", "c:27", "c:17":
+					break OUT
+				default: // ask again
+					continue
+				}
+			}
+			sb.WriteString(line[last:start])
+			sb.WriteString(replacement)
+			last = end
+			e.SetLine(y, sb.String()+line[last:])
+			e.changed = true
+			counter++
+			from = nextSearchFrom(line, start, end)
+		}
+	}
+
+	status.ClearAll(c)
+	e.redraw = true
+	e.redrawCursor = true
+	return counter
+}
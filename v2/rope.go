@@ -0,0 +1,370 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Rope is a balanced tree of lines, where every node holds one line of text.
+// Looking up, inserting and deleting lines by index are O(log n) operations.
+// Nodes are never modified after they have been created, so a Rope can be copied
+// by value in O(1) time, and the copy is not affected by later changes to the original.
+// The rune slices that are stored in a Rope must not be modified after they have been stored.
+type Rope struct {
+	root *ropeNode
+}
+
+// ropeNode is an immutable node in an implicit treap, ordered by line index
+type ropeNode struct {
+	left     *ropeNode
+	right    *ropeNode
+	line     []rune
+	size     int    // the number of lines in this subtree
+	priority uint32 // heap priority, for keeping the tree balanced
+}
+
+// NewRope creates a new Rope from the given lines
+func NewRope(lines [][]rune) Rope {
+	if len(lines) == 0 {
+		return Rope{}
+	}
+	var nodes []*ropeNode
+	root := buildRopeNodes(lines, &nodes)
+	// Assign random priorities in breadth-first order, from the largest to the smallest,
+	// so that every parent has a priority that is larger than or equal to its children.
+	priorities := make([]uint32, len(nodes))
+	for i := range priorities {
+		priorities[i] = rand.Uint32()
+	}
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i] > priorities[j] })
+	queue := []*ropeNode{root}
+	for i := 0; len(queue) > 0; i++ {
+		n := queue[0]
+		queue = queue[1:]
+		n.priority = priorities[i]
+		if n.left != nil {
+			queue = append(queue, n.left)
+		}
+		if n.right != nil {
+			queue = append(queue, n.right)
+		}
+	}
+	return Rope{root}
+}
+
+// buildRopeNodes creates a perfectly balanced tree from the given lines.
+// All created nodes are also appended to the given slice.
+func buildRopeNodes(lines [][]rune, nodes *[]*ropeNode) *ropeNode {
+	if len(lines) == 0 {
+		return nil
+	}
+	middle := len(lines) / 2
+	n := &ropeNode{line: lines[middle], size: len(lines)}
+	*nodes = append(*nodes, n)
+	n.left = buildRopeNodes(lines[:middle], nodes)
+	n.right = buildRopeNodes(lines[middle+1:], nodes)
+	return n
+}
+
+func (n *ropeNode) count() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+// newRopeNode creates a new node, and calculates the size of the subtree
+func newRopeNode(left, right *ropeNode, line []rune, priority uint32) *ropeNode {
+	return &ropeNode{left, right, line, left.count() + right.count() + 1, priority}
+}
+
+// splitRope splits the tree into the first k lines and the rest
+func splitRope(n *ropeNode, k int) (*ropeNode, *ropeNode) {
+	if n == nil {
+		return nil, nil
+	}
+	leftCount := n.left.count()
+	if k <= leftCount {
+		a, b := splitRope(n.left, k)
+		return a, newRopeNode(b, n.right, n.line, n.priority)
+	}
+	a, b := splitRope(n.right, k-leftCount-1)
+	return newRopeNode(n.left, a, n.line, n.priority), b
+}
+
+// mergeRope joins two trees, where all lines in a comes before all lines in b
+func mergeRope(a, b *ropeNode) *ropeNode {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.priority >= b.priority {
+		return newRopeNode(a.left, mergeRope(a.right, b), a.line, a.priority)
+	}
+	return newRopeNode(mergeRope(a, b.left), b.right, b.line, b.priority)
+}
+
+// Len returns the number of lines
+func (r Rope) Len() int {
+	return r.root.count()
+}
+
+// Has checks if there is a line at the given index
+func (r Rope) Has(index int) bool {
+	return index >= 0 && index < r.root.count()
+}
+
+// Line returns the line at the given index, or nil if the index is out of range.
+// The returned slice must not be modified.
+func (r Rope) Line(index int) []rune {
+	n := r.root
+	for n != nil {
+		leftCount := n.left.count()
+		switch {
+		case index < leftCount:
+			n = n.left
+		case index == leftCount:
+			return n.line
+		default:
+			index -= leftCount + 1
+			n = n.right
+		}
+	}
+	return nil
+}
+
+// setRopeLine returns a copy of the path to the given index, with the line replaced
+func setRopeLine(n *ropeNode, index int, line []rune) *ropeNode {
+	leftCount := n.left.count()
+	switch {
+	case index < leftCount:
+		return newRopeNode(setRopeLine(n.left, index, line), n.right, n.line, n.priority)
+	case index == leftCount:
+		return newRopeNode(n.left, n.right, line, n.priority)
+	default:
+		return newRopeNode(n.left, setRopeLine(n.right, index-leftCount-1, line), n.line, n.priority)
+	}
+}
+
+// Set replaces the line at the given index.
+// If the index is after the last line, empty lines are added up until the given index.
+func (r *Rope) Set(index int, line []rune) {
+	if index < 0 {
+		return
+	}
+	for r.Len() < index {
+		r.Append([]rune{})
+	}
+	if index == r.Len() {
+		r.Append(line)
+		return
+	}
+	r.root = setRopeLine(r.root, index, line)
+}
+
+// Insert inserts a line before the given index, so that the new line gets that index.
+// If the index is after the last line, empty lines are added first.
+func (r *Rope) Insert(index int, line []rune) {
+	if index < 0 {
+		return
+	}
+	for r.Len() < index {
+		r.Append([]rune{})
+	}
+	a, b := splitRope(r.root, index)
+	r.root = mergeRope(mergeRope(a, &ropeNode{line: line, size: 1, priority: rand.Uint32()}), b)
+}
+
+// Append adds a line after the last line
+func (r *Rope) Append(line []rune) {
+	r.root = mergeRope(r.root, &ropeNode{line: line, size: 1, priority: rand.Uint32()})
+}
+
+// Delete removes the line at the given index, if it exists
+func (r *Rope) Delete(index int) {
+	if !r.Has(index) {
+		return
+	}
+	a, b := splitRope(r.root, index)
+	_, b = splitRope(b, 1)
+	r.root = mergeRope(a, b)
+}
+
+// Truncate removes all lines from the given index and out
+func (r *Rope) Truncate(index int) {
+	if index < 0 {
+		index = 0
+	}
+	r.root, _ = splitRope(r.root, index)
+}
+
+// Lines returns all lines, in order.
+// The returned slices must not be modified.
+func (r Rope) Lines() [][]rune {
+	lines := make([][]rune, 0, r.Len())
+	var walk func(n *ropeNode)
+	walk = func(n *ropeNode) {
+		if n == nil {
+			return
+		}
+		walk(n.left)
+		lines = append(lines, n.line)
+		walk(n.right)
+	}
+	walk(r.root)
+	return lines
+}
+
+// String returns all lines, with a newline after each line
+func (r Rope) String() string {
+	var sb strings.Builder
+	for _, line := range r.Lines() {
+		sb.WriteString(string(line))
+		sb.WriteRune('\n')
+	}
+	return sb.String()
+}
+
+// Slice returns the lines from index from up to, but not including, index to.
+// The returned slices must not be modified.
+func (r Rope) Slice(from, to int) [][]rune {
+	from, to = max(from, 0), min(to, r.Len())
+	if from >= to {
+		return [][]rune{}
+	}
+	_, b := splitRope(r.root, from)
+	middle, _ := splitRope(b, to-from)
+	return Rope{middle}.Lines()
+}
+
+// Splice removes deleteCount lines at the given index, then inserts the given lines at that index
+func (r *Rope) Splice(index, deleteCount int, lines [][]rune) {
+	if index < 0 {
+		return
+	}
+	for r.Len() < index {
+		r.Append([]rune{})
+	}
+	a, b := splitRope(r.root, index)
+	_, c := splitRope(b, deleteCount)
+	r.root = mergeRope(mergeRope(a, NewRope(lines).root), c)
+}
+
+// ropeItem is either a whole subtree or just the line of a single node
+type ropeItem struct {
+	node  *ropeNode
+	whole bool
+}
+
+// ropeWalker can walk the lines of a rope, either forwards or backwards,
+// and can skip subtrees that are shared with another rope.
+type ropeWalker struct {
+	stack   []ropeItem
+	reverse bool
+}
+
+func newRopeWalker(r Rope, reverse bool) *ropeWalker {
+	w := &ropeWalker{reverse: reverse}
+	w.push(r.root, true)
+	return w
+}
+
+func (w *ropeWalker) push(n *ropeNode, whole bool) {
+	if n != nil {
+		w.stack = append(w.stack, ropeItem{n, whole})
+	}
+}
+
+func (w *ropeWalker) top() ropeItem {
+	return w.stack[len(w.stack)-1]
+}
+
+func (w *ropeWalker) pop() {
+	w.stack = w.stack[:len(w.stack)-1]
+}
+
+// expand replaces the whole subtree at the top of the stack with its parts
+func (w *ropeWalker) expand() {
+	n := w.top().node
+	w.pop()
+	if w.reverse {
+		w.push(n.left, true)
+		w.push(n, false)
+		w.push(n.right, true)
+	} else {
+		w.push(n.right, true)
+		w.push(n, false)
+		w.push(n.left, true)
+	}
+}
+
+// equalRunes checks if two rune slices have the same contents
+func equalRunes(a, b []rune) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	if len(a) == 0 || &a[0] == &b[0] {
+		return true
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// commonLines counts how many lines are equal at the start (or the end, if reverse is true) of both ropes,
+// but no more than the given limit. Subtrees that are shared between the two ropes are skipped over.
+func commonLines(a, b Rope, reverse bool, limit int) int {
+	var (
+		wa    = newRopeWalker(a, reverse)
+		wb    = newRopeWalker(b, reverse)
+		count int
+	)
+	for count < limit && len(wa.stack) > 0 && len(wb.stack) > 0 {
+		ta, tb := wa.top(), wb.top()
+		if ta.whole && tb.whole && ta.node == tb.node && count+ta.node.size <= limit {
+			// The same subtree at the same position, so all lines in it are equal
+			count += ta.node.size
+			wa.pop()
+			wb.pop()
+			continue
+		}
+		if ta.whole && (!tb.whole || ta.node.size >= tb.node.size) {
+			wa.expand()
+			continue
+		}
+		if tb.whole {
+			wb.expand()
+			continue
+		}
+		if !equalRunes(ta.node.line, tb.node.line) {
+			break
+		}
+		count++
+		wa.pop()
+		wb.pop()
+	}
+	return count
+}
+
+// DiffRopes finds the range of lines that differs between a and b.
+// Returns the first line index that differs, the lines in a that were replaced and the lines in b that replaced them.
+// Returns false if there are no differences.
+func DiffRopes(a, b Rope) (int, [][]rune, [][]rune, bool) {
+	if a.root == b.root {
+		return 0, nil, nil, false
+	}
+	la, lb := a.Len(), b.Len()
+	shortest := min(la, lb)
+	prefix := commonLines(a, b, false, shortest)
+	if prefix == la && prefix == lb {
+		return 0, nil, nil, false
+	}
+	suffix := commonLines(a, b, true, shortest-prefix)
+	return prefix, a.Slice(prefix, la-suffix), b.Slice(prefix, lb-suffix), true
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestRope(t *testing.T) {
+	var (
+		r     = NewRope([][]rune{[]rune("a"), []rune("b"), []rune("c")})
+		model = []string{"a", "b", "c"}
+	)
+	for i := 0; i < 2000; i++ {
+		s := strconv.Itoa(i)
+		switch n := len(model); rand.Intn(4) {
+		case 0:
+			index := rand.Intn(n + 1)
+			r.Insert(index, []rune(s))
+			model = append(model[:index], append([]string{s}, model[index:]...)...)
+		case 1:
+			if n > 0 {
+				index := rand.Intn(n)
+				r.Delete(index)
+				model = append(model[:index], model[index+1:]...)
+			}
+		case 2:
+			if n > 0 {
+				index := rand.Intn(n)
+				r.Set(index, []rune(s))
+				model[index] = s
+			}
+		case 3:
+			r.Append([]rune(s))
+			model = append(model, s)
+		}
+		if r.Len() != len(model) {
+			t.Fatalf("expected %d lines, got %d", len(model), r.Len())
+		}
+	}
+	for i, line := range r.Lines() {
+		if string(line) != model[i] || string(r.Line(i)) != model[i] {
+			t.Fatalf("line %d: expected %q, got %q", i, model[i], string(line))
+		}
+	}
+}
+
+func TestRopeCopy(t *testing.T) {
+	r := NewRope([][]rune{[]rune("a"), []rune("b")})
+	r2 := r
+	r2.Set(0, []rune("x"))
+	r2.Insert(1, []rune("y"))
+	r2.Delete(2)
+	if r.String() != "a\nb\n" {
+		t.Fatalf("the original rope was modified: %q", r.String())
+	}
+	if r2.String() != "x\ny\n" {
+		t.Fatalf("unexpected contents of the copied rope: %q", r2.String())
+	}
+}
+
+func ExampleRope_Set() {
+	var r Rope
+	r.Set(2, []rune("c"))
+	r.Truncate(3)
+	fmt.Print(r.Len(), r.String())
+	// Output:
+	// 3
+	//
+	// c
+}
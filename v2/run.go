@@ -36,30 +36,38 @@ func (e *Editor) Run() (string, error) {
 
 	// Make sure not to do anything with cmd here until it has been initialized by the switch below!
 
-	switch e.mode {
-	case mode.CMake:
-		cmd = exec.Command("cmake", "-B", "build", "-D", "CMAKE_BUILD_TYPE=Debug", "-S", sourceDir)
-	case mode.Kotlin:
-		jarName := e.exeName(sourceFilename, false) + ".jar"
-		cmd = exec.Command("java", "-jar", jarName)
-	case mode.Go:
-		cmd = exec.Command("go", "run", sourceFilename)
-	case mode.Lua:
-		cmd = exec.Command("lua", sourceFilename)
-	case mode.Make:
-		cmd = exec.Command("make")
-	case mode.Java:
-		cmd = exec.Command("java", "-jar", "main.jar")
-	case mode.Just:
-		cmd = exec.Command("just")
-	case mode.Python:
-		cmd = exec.Command("python", sourceFilename)
-	default:
-		exeName := filepath.Join(sourceDir, e.exeName(e.filename, true))
-		cmd = exec.Command(exeName)
+	// A run command in the project configuration file takes precedence
+	cfg, err := LoadProjectConfig(sourceFilename, e.mode)
+	if err != nil {
+		return "", err
+	}
+	if cfg != nil && cfg.Run != "" {
+		cmd = cfg.Command(cfg.Run, sourceFilename)
+	} else {
+		switch e.mode {
+		case mode.CMake:
+			cmd = exec.Command("cmake", "-B", "build", "-D", "CMAKE_BUILD_TYPE=Debug", "-S", sourceDir)
+		case mode.Kotlin:
+			jarName := e.exeName(sourceFilename, false) + ".jar"
+			cmd = exec.Command("java", "-jar", jarName)
+		case mode.Go:
+			cmd = exec.Command("go", "run", sourceFilename)
+		case mode.Lua:
+			cmd = exec.Command("lua", sourceFilename)
+		case mode.Make:
+			cmd = exec.Command("make")
+		case mode.Java:
+			cmd = exec.Command("java", "-jar", "main.jar")
+		case mode.Just:
+			cmd = exec.Command("just")
+		case mode.Python:
+			cmd = exec.Command("python", sourceFilename)
+		default:
+			exeName := filepath.Join(sourceDir, e.exeName(e.filename, true))
+			cmd = exec.Command(exeName)
+		}
+		cmd.Dir = sourceDir
 	}
-
-	cmd.Dir = sourceDir
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
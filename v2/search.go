@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/xyproto/vt100"
 )
@@ -15,8 +17,147 @@ var (
 	searchHistoryFilename = filepath.Join(userCacheDir, "o", "search.txt")
 	searchHistory         *[]string
 	errNoSearchMatch      = errors.New("no search match")
+
+	// regexpSearch is true if search terms are regular expressions, toggled with ctrl-r while searching
+	regexpSearch bool
+
+	// the most recently compiled search regexp, to avoid compiling it again for every line
+	lastSearchRegexpString string
+	lastSearchRegexp       *regexp.Regexp
 )
 
+// searchRegexp returns the compiled regular expression if searching for regular expressions is enabled.
+// Returns false if the search term should be searched for literally, also if the regular expression is invalid.
+func searchRegexp(s string) (*regexp.Regexp, bool) {
+	if !regexpSearch || s == "" {
+		return nil, false
+	}
+	if s == lastSearchRegexpString {
+		return lastSearchRegexp, lastSearchRegexp != nil
+	}
+	re, err := regexp.Compile(s)
+	if err != nil {
+		re = nil
+	}
+	lastSearchRegexpString = s
+	lastSearchRegexp = re
+	return re, re != nil
+}
+
+// searchIndex returns the byte index of the first match of the search term in the given line, or -1.
+// The search term is a regular expression if searching for regular expressions is enabled.
+func searchIndex(line, s string) int {
+	return searchIndexFrom(line, s, 0)
+}
+
+// searchIndexFrom returns the byte index of the first match of the search term in the given line that starts
+// at or after the byte index from, or -1. Regular expressions are matched against the whole line, so that
+// ^ and \b only match where they would in the whole line.
+func searchIndexFrom(line, s string, from int) int {
+	if from > len(line) {
+		return -1
+	}
+	if re, ok := searchRegexp(s); ok {
+		for _, loc := range re.FindAllStringIndex(line, -1) {
+			if loc[0] >= from {
+				return loc[0]
+			}
+		}
+		return -1
+	}
+	if pos := strings.Index(line[from:], s); pos != -1 {
+		return from + pos
+	}
+	return -1
+}
+
+// searchMatch finds the first match of the search term in line, starting at the byte index from.
+// Returns the byte indices of the match and the text to replace it with, where "$1" and similar
+// are expanded if searching for regular expressions is enabled. start is -1 if there are no matches.
+// Regular expressions are matched against the whole line, so that ^ and \b only match where they
+// would in the whole line.
+func searchMatch(line string, from int, searchFor, replaceWith string) (int, int, string) {
+	if from > len(line) {
+		return -1, -1, ""
+	}
+	if re, ok := searchRegexp(searchFor); ok {
+		for _, loc := range re.FindAllStringSubmatchIndex(line, -1) {
+			if loc[0] >= from {
+				return loc[0], loc[1], string(re.ExpandString(nil, replaceWith, line, loc))
+			}
+		}
+		return -1, -1, ""
+	}
+	if searchFor == "" {
+		return -1, -1, ""
+	}
+	pos := strings.Index(line[from:], searchFor)
+	if pos == -1 {
+		return -1, -1, ""
+	}
+	return from + pos, from + pos + len(searchFor), replaceWith
+}
+
+// nextSearchFrom returns the byte index to continue searching from, after a match that ended at the given byte index
+func nextSearchFrom(line string, start, end int) int {
+	if end > start {
+		return end
+	}
+	// Skip past an empty match
+	if end < len(line) {
+		_, size := utf8.DecodeRuneInString(line[end:])
+		return end + size
+	}
+	return end + 1
+}
+
+// ReplaceMatches replaces the first n matches of the search term, from the top of the document,
+// or all matches if n is negative. Returns the number of replacements.
+func (e *Editor) ReplaceMatches(searchFor, replaceWith string, n int) int {
+	counter := 0
+	for y := LineIndex(0); int(y) < e.Len() && counter != n; y++ {
+		line := e.Line(y)
+		var (
+			sb       strings.Builder
+			from     int
+			last     int
+			replaced bool
+		)
+		for counter != n {
+			start, end, replacement := searchMatch(line, from, searchFor, replaceWith)
+			if start == -1 {
+				break
+			}
+			sb.WriteString(line[last:start])
+			sb.WriteString(replacement)
+			last = end
+			replaced = true
+			counter++
+			from = nextSearchFrom(line, start, end)
+		}
+		if replaced {
+			sb.WriteString(line[last:])
+			e.SetLine(y, sb.String())
+		}
+	}
+	if counter > 0 {
+		e.changed = true
+	}
+	return counter
+}
+
+// searchMatchRunes returns the rune index and the rune length of every match of the regular expression in the given runes
+func searchMatchRunes(re *regexp.Regexp, runes []rune) map[int]int {
+	matches := make(map[int]int)
+	line := string(runes)
+	for _, loc := range re.FindAllStringIndex(line, -1) {
+		if loc[1] > loc[0] {
+			matches[utf8.RuneCountInString(line[:loc[0]])] = utf8.RuneCountInString(line[loc[0]:loc[1]])
+		}
+	}
+	return matches
+}
+
 // SetSearchTerm will set the current search term. This initializes a new search.
 func (e *Editor) SetSearchTerm(c *vt100.Canvas, status *StatusBar, s string) bool {
 	foundMatch := false
@@ -27,7 +168,7 @@ func (e *Editor) SetSearchTerm(c *vt100.Canvas, status *StatusBar, s string) boo
 	// Go to the first instance after the current line, if found
 	e.lineBeforeSearch = e.DataY()
 	for y := e.DataY(); y < LineIndex(e.Len()); y++ {
-		if strings.Contains(e.Line(y), s) {
+		if searchIndex(e.Line(y), s) != -1 {
 			// Found an instance, scroll there
 			// GoTo returns true if the screen should be redrawn
 			redraw, _ := e.GoTo(y, c, status)
@@ -96,14 +237,14 @@ func (e *Editor) forwardSearch(startIndex, stopIndex LineIndex) (int, LineIndex)
 			if x >= len(lineContents) {
 				continue
 			}
-			if strings.Contains(lineContents[x:], s) {
-				foundX = x + strings.Index(lineContents[x:], s)
+			if index := searchIndexFrom(lineContents, s, x); index != -1 {
+				foundX = index
 				foundY = y
 				break
 			}
 		} else {
-			if strings.Contains(lineContents, s) {
-				foundX = strings.Index(lineContents, s)
+			if index := searchIndex(lineContents, s); index != -1 {
+				foundX = index
 				foundY = y
 				break
 			}
@@ -140,14 +281,14 @@ func (e *Editor) backwardSearch(startIndex, stopIndex LineIndex) (int, LineIndex
 			if x >= len(lineContents) {
 				continue
 			}
-			if strings.Contains(lineContents[x:], s) {
-				foundX = x + strings.Index(lineContents[x:], s)
+			if index := searchIndexFrom(lineContents, s, x); index != -1 {
+				foundX = index
 				foundY = y
 				break
 			}
 		} else {
-			if strings.Contains(lineContents, s) {
-				foundX = strings.Index(lineContents, s)
+			if index := searchIndex(lineContents, s); index != -1 {
+				foundX = index
 				foundY = y
 				break
 			}
@@ -223,6 +364,14 @@ func (e *Editor) GoToNextMatch(c *vt100.Canvas, status *StatusBar, wrap, forward
 	return nil
 }
 
+// searchModePrompt returns the prompt for the search term, which tells if it is a regular expression
+func searchModePrompt() string {
+	if regexpSearch {
+		return "Search for a regular expression:"
+	}
+	return "Search:"
+}
+
 // SearchMode will enter the interactive "search mode" where the user can type in a string and then press return to search
 func (e *Editor) SearchMode(c *vt100.Canvas, status *StatusBar, tty *vt100.TTY, clear bool, undo *Undo) {
 	// Load the search history if needed. Ignore any errors.
@@ -232,7 +381,7 @@ func (e *Editor) SearchMode(c *vt100.Canvas, status *StatusBar, tty *vt100.TTY,
 	}
 
 	var (
-		searchPrompt       = "Search:"
+		searchPrompt       = searchModePrompt()
 		previousSearch     string
 		key                string
 		initialLocation    = e.DataY().LineNumber()
@@ -296,6 +445,16 @@ AGAIN:
 				e.SetSearchTerm(c, status, s)
 			}
 			doneCollectingLetters = true
+		case "c:18": // ctrl-r, toggle between searching for text and for a regular expression
+			if previousSearch != "" { // the replace term is not searched for
+				break
+			}
+			regexpSearch = !regexpSearch
+			searchPrompt = searchModePrompt()
+			e.SetSearchTerm(c, status, s)
+			e.GoToLineNumber(initialLocation, c, status, false)
+			status.SetMessage(searchPrompt + " " + s)
+			status.ShowNoTimeout(c, e)
 		case "c:9": // tab
 			// collect letters again, this time for the replace term
 			pressedTab = true
@@ -369,8 +528,12 @@ AGAIN:
 		// replace once
 		searchFor := previousSearch
 		replaceWith := s
-		replaced := strings.Replace(e.String(), searchFor, replaceWith, 1)
-		e.LoadBytes([]byte(replaced))
+		if _, ok := searchRegexp(searchFor); ok {
+			e.ReplaceMatches(searchFor, replaceWith, 1)
+		} else {
+			replaced := strings.Replace(e.String(), searchFor, replaceWith, 1)
+			e.LoadBytes([]byte(replaced))
+		}
 		status.messageAfterRedraw = "Replaced " + searchFor + " with " + replaceWith + ", once"
 		// Save "searchFor" to the search history
 		if trimmedSearchString := strings.TrimSpace(searchFor); trimmedSearchString != "" {
@@ -399,11 +562,16 @@ AGAIN:
 			replaceWithBytes = []byte(string(r))
 		}
 		// perform the replacements, and count the number of instances
-		allBytes := []byte(e.String())
-		instanceCount := bytes.Count(allBytes, searchForBytes)
-		allReplaced := bytes.ReplaceAll(allBytes, searchForBytes, replaceWithBytes)
-		// replace the contents
-		e.LoadBytes(allReplaced)
+		var instanceCount int
+		if _, ok := searchRegexp(previousSearch); ok {
+			instanceCount = e.ReplaceMatches(previousSearch, s, -1)
+		} else {
+			allBytes := []byte(e.String())
+			instanceCount = bytes.Count(allBytes, searchForBytes)
+			allReplaced := bytes.ReplaceAll(allBytes, searchForBytes, replaceWithBytes)
+			// replace the contents
+			e.LoadBytes(allReplaced)
+		}
 		// build a status message
 		extraS := ""
 		if instanceCount != 1 {
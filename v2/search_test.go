@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+)
+
+// enableRegexpSearch enables searching for regular expressions until the test is done
+func enableRegexpSearch(t *testing.T) {
+	regexpSearch = true
+	t.Cleanup(func() {
+		regexpSearch = false
+	})
+}
+
+func TestSearchRegexp(t *testing.T) {
+	if _, ok := searchRegexp("a+b"); ok {
+		t.Fatal("expected a+b to be searched for literally, until regular expressions are enabled")
+	}
+	if i := searchIndex("ls /usr/bin", "/usr/"); i != 3 {
+		t.Fatalf("expected /usr/ to be searched for literally, got %d", i)
+	}
+
+	enableRegexpSearch(t)
+	if _, ok := searchRegexp("a+b"); !ok {
+		t.Fatal("expected a+b to be a regular expression")
+	}
+	if _, ok := searchRegexp("("); ok {
+		t.Fatal("expected an invalid regular expression to be searched for literally")
+	}
+	if i := searchIndex("x := foo(42)", "[0-9]+"); i != 9 {
+		t.Fatalf("expected a match at 9, got %d", i)
+	}
+	if i := searchIndex("x := foo(42)", "foo"); i != 5 {
+		t.Fatalf("expected a match at 5, got %d", i)
+	}
+}
+
+func TestSearchLiteralSlashes(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.InsertStringAndMove(nil, "cd /usr/local\nuser")
+
+	if n := e.ReplaceMatches("/usr/", "/opt/", -1); n != 1 {
+		t.Fatalf("expected 1 replacement, got %d", n)
+	}
+	if e.String() != "cd /opt/local\nuser\n" {
+		t.Fatalf("expected /usr/ to be replaced literally, got %q", e.String())
+	}
+}
+
+func TestReplaceMatches(t *testing.T) {
+	enableRegexpSearch(t)
+	e := NewSimpleEditor(80)
+	e.InsertStringAndMove(nil, "key1 = value1\nkey2 = value2\nnothing here")
+
+	if n := e.ReplaceMatches(`(\w+) = (\w+)`, "$2: $1", -1); n != 2 {
+		t.Fatalf("expected 2 replacements, got %d", n)
+	}
+	if e.String() != "value1: key1\nvalue2: key2\nnothing here\n" {
+		t.Fatalf("unexpected contents after replacing with capture groups: %q", e.String())
+	}
+
+	if n := e.ReplaceMatches("e", "E", 1); n != 1 {
+		t.Fatalf("expected 1 replacement, got %d", n)
+	}
+	if e.String() != "valuE1: key1\nvalue2: key2\nnothing here\n" {
+		t.Fatalf("unexpected contents after replacing once: %q", e.String())
+	}
+
+	// Empty matches should not make the replacement loop forever
+	if n := e.ReplaceMatches("x*", "-", -1); n == 0 {
+		t.Fatal("expected the empty matches to be replaced")
+	}
+}
+
+func TestReplaceAnchoredMatches(t *testing.T) {
+	enableRegexpSearch(t)
+	e := NewSimpleEditor(80)
+	e.InsertStringAndMove(nil, "    x\nfoo foobar")
+
+	// ^ only matches at the start of the line, not at the start of the rest of the line
+	if n := e.ReplaceMatches("^ ", "", -1); n != 1 {
+		t.Fatalf("expected 1 replacement, got %d", n)
+	}
+	if e.Line(0) != "   x" {
+		t.Fatalf("expected one space to be removed, got %q", e.Line(0))
+	}
+	if n := e.ReplaceMatches(`\bfoo\b`, "bar", -1); n != 1 {
+		t.Fatalf("expected 1 replacement, got %d", n)
+	}
+	if e.Line(1) != "bar foobar" {
+		t.Fatalf("unexpected contents after replacing whole words: %q", e.Line(1))
+	}
+
+	if i := searchIndexFrom("aaa", "^a", 1); i != -1 {
+		t.Fatalf("expected no match after the start of the line, got %d", i)
+	}
+	if i := searchIndexFrom("foo foobar", `\Bbar`, 2); i != 7 {
+		t.Fatalf("expected a match at 7, got %d", i)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/xyproto/clip"
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+var errNoSelection = errors.New("no selection")
+
+// Selection is a region of text that goes from an anchor to the regular cursor.
+// A character-wise selection includes the rune under the cursor, and also the newline if the
+// cursor is after the end of the line. A line-wise selection always covers whole lines.
+// A rectangular selection covers the screen columns from the anchor column to the cursor column, on every line.
+type Selection struct {
+	anchor      Cursor
+	lineWise    bool
+	rectangular bool
+	column      int // the screen column of the anchor, for rectangular selections
+}
+
+// StartSelection anchors a new selection at the current position
+func (e *Editor) StartSelection(lineWise bool) {
+	e.selection = &Selection{anchor: e.dataCursor(), lineWise: lineWise}
+}
+
+// CycleSelection starts selecting text from the current position, or switches from selecting text to
+// selecting whole lines, from the same anchor, or stops selecting. Returns a status message.
+func (e *Editor) CycleSelection() string {
+	switch {
+	case e.selection == nil:
+		e.StartSelection(false)
+		return "Selecting text"
+	case !e.selection.lineWise && !e.selection.rectangular:
+		e.selection.lineWise = true
+		return "Selecting lines"
+	}
+	e.ClearSelection()
+	return "Stopped selecting"
+}
+
+// HasSelection checks if a selection is active
+func (e *Editor) HasSelection() bool {
+	return e.selection != nil
+}
+
+// ClearSelection stops selecting text
+func (e *Editor) ClearSelection() {
+	e.selection = nil
+}
+
+// SelectionBounds returns the start of the selection and the position right after the end of the selection
+func (e *Editor) SelectionBounds() (Cursor, Cursor) {
+	from, to := e.selection.anchor, e.dataCursor()
+	// The anchor may be after the end of the document, if lines have been removed since the selection started
+	from.y = min(from.y, LineIndex(e.Len()-1))
+	if to.less(from) {
+		from, to = to, from
+	}
+	if e.selection.lineWise || e.selection.rectangular {
+		return Cursor{0, from.y}, Cursor{0, to.y + 1}
+	}
+	if to.x >= len(e.lines.Line(int(to.y))) {
+		// Include the newline
+		return from, Cursor{0, to.y + 1}
+	}
+	return from, Cursor{to.x + 1, to.y}
+}
+
+// SelectedLines returns the first and the last line index of the lines that are part of the selection
+func (e *Editor) SelectedLines() (LineIndex, LineIndex) {
+	from, to := e.SelectionBounds()
+	last := to.y
+	if to.x == 0 && to.y > from.y {
+		last--
+	}
+	return from.y, min(last, LineIndex(e.Len()-1))
+}
+
+// SelectedText returns the selected text
+func (e *Editor) SelectedText() string {
+	if !e.HasSelection() {
+		return ""
+	}
+	if e.selection.rectangular {
+		return strings.Join(e.RectangleLines(), "\n")
+	}
+	from, to := e.SelectionBounds()
+	var sb strings.Builder
+	for y := from.y; y <= to.y && int(y) < e.lines.Len(); y++ {
+		line := e.lines.Line(int(y))
+		start, end := 0, len(line)
+		if y == from.y {
+			start = min(from.x, len(line))
+		}
+		if y == to.y {
+			end = min(to.x, len(line))
+		}
+		if start < end {
+			sb.WriteString(string(line[start:end]))
+		}
+		if y < to.y {
+			sb.WriteRune('\n')
+		}
+	}
+	return sb.String()
+}
+
+// CopySelection copies the selected text to the system clipboard, and returns the selected lines
+func (e *Editor) CopySelection() ([]string, error) {
+	s := e.SelectedText()
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if isDarwin() {
+		return lines, pbcopy(s)
+	}
+	return lines, clip.WriteAll(s, e.primaryClipboard)
+}
+
+// DeleteSelection removes the selected text, moves the cursor to where the selection started
+// and stops selecting text
+func (e *Editor) DeleteSelection(c *vt100.Canvas) {
+	if !e.HasSelection() {
+		return
+	}
+	if e.selection.rectangular {
+		e.DeleteRectangle(c)
+		return
+	}
+	from, to := e.SelectionBounds()
+	if e.selection.lineWise || (from.x == 0 && to.x == 0) {
+		// Remove whole lines
+		e.lines.Splice(int(from.y), int(to.y-from.y), nil)
+	} else {
+		first, last := e.lines.Line(int(from.y)), e.lines.Line(int(to.y))
+		joined := make([]rune, 0, from.x+len(last))
+		joined = append(joined, first[:min(from.x, len(first))]...)
+		joined = append(joined, last[min(to.x, len(last)):]...)
+		e.lines.Splice(int(from.y), int(to.y-from.y)+1, [][]rune{joined})
+	}
+	e.selection = nil
+	e.changed = true
+	e.redraw = true
+	e.redrawCursor = true
+	e.setDataCursor(c, Cursor{from.x, min(from.y, LineIndex(e.Len()-1))})
+}
+
+// insertText inserts the given text, which may contain newlines, at the given position
+func (e *Editor) insertText(cur Cursor, s string) {
+	line, x := e.cursorLine(cur)
+	textLines := strings.Split(s, "\n")
+	newLines := make([][]rune, len(textLines))
+	for i, textLine := range textLines {
+		newLines[i] = []rune(textLine)
+	}
+	last := len(newLines) - 1
+	newLines[0] = append(append([]rune{}, line[:x]...), newLines[0]...)
+	newLines[last] = append(newLines[last], line[x:]...)
+	if last > 0 && len(newLines[last]) == 0 && int(cur.y)+1 >= e.lines.Len() {
+		// Don't add an empty line at the end of the document
+		newLines = newLines[:last]
+	}
+	if e.lines.Has(int(cur.y)) {
+		e.lines.Splice(int(cur.y), 1, newLines)
+	} else {
+		e.lines.Splice(int(cur.y), 0, newLines)
+	}
+}
+
+// ReplaceSelection replaces the selected text with the given text, and stops selecting text
+func (e *Editor) ReplaceSelection(c *vt100.Canvas, s string) {
+	if !e.HasSelection() {
+		return
+	}
+	if e.selection.rectangular {
+		first, _, left, _ := e.RectangleBounds()
+		e.DeleteRectangle(c)
+		e.GoTo(first, c, nil)
+		e.pos.SetX(c, left)
+		e.PasteRectangle(c, strings.Split(s, "\n"))
+		return
+	}
+	from, _ := e.SelectionBounds()
+	e.DeleteSelection(c)
+	e.insertText(from, s)
+	e.setDataCursor(c, from)
+}
+
+// setSelectedLines replaces the selected lines with the given lines, and keeps the selection
+func (e *Editor) setSelectedLines(lines []string) {
+	first, last := e.SelectedLines()
+	runeLines := make([][]rune, len(lines))
+	for i, line := range lines {
+		runeLines[i] = []rune(line)
+	}
+	e.lines.Splice(int(first), int(last-first)+1, runeLines)
+	e.changed = true
+	e.redraw = true
+}
+
+// selectedLines returns the lines that are part of the selection
+func (e *Editor) selectedLines() []string {
+	first, last := e.SelectedLines()
+	lines := make([]string, 0, last-first+1)
+	for y := first; y <= last; y++ {
+		lines = append(lines, e.Line(y))
+	}
+	return lines
+}
+
+// IndentSelection indents all non-blank selected lines by one level
+func (e *Editor) IndentSelection() {
+	indentation := "\t"
+	if e.indentation.Spaces {
+		indentation = strings.Repeat(" ", e.indentation.PerTab)
+	}
+	lines := e.selectedLines()
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			lines[i] = indentation + line
+		}
+	}
+	e.setSelectedLines(lines)
+}
+
+// DedentSelection removes one level of indentation from all selected lines
+func (e *Editor) DedentSelection() {
+	lines := e.selectedLines()
+	for i, line := range lines {
+		if strings.HasPrefix(line, "\t") {
+			lines[i] = line[1:]
+			continue
+		}
+		spaces := len(line) - len(strings.TrimLeft(line, " "))
+		lines[i] = line[min(spaces, e.indentation.PerTab):]
+	}
+	e.setSelectedLines(lines)
+}
+
+// SortSelection sorts the selected lines
+func (e *Editor) SortSelection() {
+	lines := e.selectedLines()
+	sort.Strings(lines)
+	e.setSelectedLines(lines)
+}
+
+// ToggleCommentSelection comments out the selected lines, or comments them in if most of them are commented out
+func (e *Editor) ToggleCommentSelection() {
+	var (
+		commentMarker   = e.SingleLineCommentMarker()
+		lines           = e.selectedLines()
+		commentCounter  int
+		nonBlankCounter int
+	)
+	for _, line := range lines {
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			nonBlankCounter++
+			if strings.HasPrefix(trimmed, commentMarker) {
+				commentCounter++
+			}
+		}
+	}
+	space := " "
+	if e.mode == mode.Config { // For config files, assume things will be toggled in and out, without a space
+		space = ""
+	}
+	mostLinesAreComments := nonBlankCounter > 0 && commentCounter*2 >= nonBlankCounter
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			continue
+		case mostLinesAreComments && strings.HasPrefix(trimmed, commentMarker+" "):
+			lines[i] = strings.Replace(line, commentMarker+" ", "", 1)
+		case mostLinesAreComments:
+			lines[i] = strings.Replace(line, commentMarker, "", 1)
+		default:
+			lines[i] = commentMarker + space + line
+		}
+	}
+	e.setSelectedLines(lines)
+}
+
+// drawSelection draws the selected part of the given line, if any, with the selection colors.
+// y is the line index in the data and sy is the line on the canvas.
+func (e *Editor) drawSelection(c *vt100.Canvas, y LineIndex, cx, sy uint) {
+	if e.selection.rectangular {
+		e.drawRectangle(c, y, cx, sy)
+		return
+	}
+	from, to := e.SelectionBounds()
+	if y < from.y || y > to.y || (y == to.y && to.x == 0) {
+		return
+	}
+	line := e.lines.Line(int(y))
+	start, end := 0, len(line)+1 // + 1 for the newline
+	if y == from.y {
+		start = min(from.x, len(line))
+	}
+	if y == to.y {
+		end = min(to.x, len(line))
+	}
+	col := e.screenColumn(Cursor{start, y}) - e.pos.offsetX
+	for x := start; x < end; x++ {
+		r, width := ' ', 1
+		if x < len(line) {
+			r = line[x]
+			if r == '\t' {
+				r, width = ' ', e.indentation.PerTab
+			}
+		}
+		for i := 0; i < width; i++ {
+			if col >= 0 && cx+uint(col) < c.Width() {
+				c.WriteRuneBNoLock(cx+uint(col), sy, e.SelectionForeground, e.SelectionBackground, r)
+			}
+			col++
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSelection(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.InsertStringAndMove(nil, "one two\nthree\nfour five")
+
+	// Select from "two" to "fo", across three lines
+	e.setDataCursor(nil, Cursor{4, 0})
+	e.StartSelection(false)
+	e.setDataCursor(nil, Cursor{1, 2})
+	if s := e.SelectedText(); s != "two\nthree\nfo" {
+		t.Fatalf("unexpected selected text: %q", s)
+	}
+	if first, last := e.SelectedLines(); first != 0 || last != 2 {
+		t.Fatalf("unexpected selected lines: %d to %d", first, last)
+	}
+
+	e.DeleteSelection(nil)
+	if e.String() != "one ur five\n" {
+		t.Fatalf("unexpected contents after deleting the selection: %q", e.String())
+	}
+	if e.HasSelection() || e.dataCursor() != (Cursor{4, 0}) {
+		t.Fatalf("expected no selection and the cursor at the start of the deleted text, got %v", e.dataCursor())
+	}
+
+	// Select backwards, from after the end of the line
+	e.StartSelection(false)
+	e.setDataCursor(nil, Cursor{0, 0})
+	e.selection.anchor = Cursor{11, 0}
+	if s := e.SelectedText(); s != "one ur five\n" {
+		t.Fatalf("expected the newline to be selected: %q", s)
+	}
+	e.ReplaceSelection(nil, "six\nseven\n")
+	if e.String() != "six\nseven\n" {
+		t.Fatalf("unexpected contents after replacing the selection: %q", e.String())
+	}
+}
+
+func TestSelectLines(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.indentation.Spaces = false
+	e.InsertStringAndMove(nil, "c\n\na\nb")
+
+	e.setDataCursor(nil, Cursor{0, 3})
+	e.StartSelection(true)
+	e.setDataCursor(nil, Cursor{0, 0})
+	if s := e.SelectedText(); s != "c\n\na\nb\n" {
+		t.Fatalf("unexpected selected text: %q", s)
+	}
+
+	e.SortSelection()
+	if e.String() != "\na\nb\nc\n" {
+		t.Fatalf("unexpected contents after sorting the selected lines: %q", e.String())
+	}
+
+	e.IndentSelection()
+	if e.String() != "\n\ta\n\tb\n\tc\n" {
+		t.Fatalf("unexpected contents after indenting the selected lines: %q", e.String())
+	}
+	e.DedentSelection()
+	if e.String() != "\na\nb\nc\n" {
+		t.Fatalf("unexpected contents after dedenting the selected lines: %q", e.String())
+	}
+
+	e.DeleteSelection(nil)
+	if e.lines.Len() != 0 {
+		t.Fatalf("expected all lines to be deleted, got: %q", e.String())
+	}
+}
+
+func TestCycleSelection(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.InsertStringAndMove(nil, "one\ntwo\nthree")
+	e.setDataCursor(nil, Cursor{1, 0})
+
+	if msg := e.CycleSelection(); msg != "Selecting text" || !e.HasSelection() || e.selection.lineWise {
+		t.Fatalf("expected a text selection, got %q", msg)
+	}
+	e.setDataCursor(nil, Cursor{1, 1})
+	if s := e.SelectedText(); s != "ne\ntw" {
+		t.Fatalf("unexpected selected text: %q", s)
+	}
+	// The anchor stays the same when switching to whole lines
+	if msg := e.CycleSelection(); msg != "Selecting lines" || e.selection.anchor != (Cursor{1, 0}) {
+		t.Fatalf("expected a line-wise selection from the same anchor, got %q", msg)
+	}
+	if s := e.SelectedText(); s != "one\ntwo\n" {
+		t.Fatalf("unexpected selected lines: %q", s)
+	}
+	if msg := e.CycleSelection(); msg != "Stopped selecting" || e.HasSelection() {
+		t.Fatalf("expected no selection, got %q", msg)
+	}
+}
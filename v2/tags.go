@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/xyproto/vt100"
+)
+
+var errNoTag = errors.New("no such tag")
+
+// Tag is the location of a definition, as found in a tags file or by scanning the source files
+type Tag struct {
+	Name     string     // the name of the function, type or variable
+	Filename string     // the absolute filename
+	Line     LineNumber // the line number, or 0 if the pattern must be searched for
+	Pattern  string     // the line to search for, if the line number is not known
+}
+
+// FindTagsFile looks for a "tags" file in the given directory and then in the parent directories.
+// Returns an empty string if no tags file was found.
+func FindTagsFile(dir string) string {
+	for {
+		tagsFilename := filepath.Join(dir, "tags")
+		if fi, err := os.Stat(tagsFilename); err == nil && fi.Mode().IsRegular() {
+			return tagsFilename
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// parseTagAddress converts a ctags address, like 42 or /^func main() {$/, to a line number or a search pattern
+func parseTagAddress(address string) (LineNumber, string) {
+	if n, err := strconv.Atoi(address); err == nil {
+		return LineNumber(n), ""
+	}
+	if len(address) >= 2 && (address[0] == '/' || address[0] == '?') && address[len(address)-1] == address[0] {
+		pattern := address[1 : len(address)-1]
+		pattern = strings.TrimPrefix(pattern, "^")
+		pattern = strings.TrimSuffix(pattern, "$")
+		pattern = strings.NewReplacer(`\/`, `/`, `\?`, `?`, `\\`, `\`).Replace(pattern)
+		return 0, pattern
+	}
+	return 0, ""
+}
+
+// LookupTags searches the given tags file, in the Universal Ctags format, for the given name.
+// Filenames in the tags file are relative to the directory of the tags file.
+func LookupTags(tagsFilename, name string) ([]Tag, error) {
+	f, err := os.Open(tagsFilename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		tags    []Tag
+		dir     = filepath.Dir(tagsFilename)
+		prefix  = name + "\t"
+		scanner = bufio.NewScanner(f)
+	)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		// The address ends with ;" if there are extension fields, like line:42
+		address, extensions, _ := strings.Cut(fields[2], `;"`)
+		lineNumber, pattern := parseTagAddress(address)
+		for _, extension := range strings.Split(extensions, "\t") {
+			if value, ok := strings.CutPrefix(extension, "line:"); ok {
+				if n, err := strconv.Atoi(value); err == nil {
+					lineNumber = LineNumber(n)
+				}
+			}
+		}
+		filename := fields[1]
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(dir, filename)
+		}
+		tags = append(tags, Tag{name, filename, lineNumber, pattern})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return nil, errNoTag
+	}
+	return tags, nil
+}
+
+// definitionName returns the name that is defined on the given line, if it starts with the given function prefix.
+// Handles Go methods, and the prefixes that follow the name, like " ->" for Erlang.
+func definitionName(line, funcPrefix string) string {
+	var rest string
+	if strings.HasPrefix(funcPrefix, " ") {
+		// The prefix follows the name, and the definition is not indented
+		if line == "" || unicode.IsSpace([]rune(line)[0]) || !strings.Contains(line, funcPrefix) {
+			return ""
+		}
+		rest = line
+	} else {
+		trimmedLine := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmedLine, funcPrefix) {
+			return ""
+		}
+		rest = strings.TrimSpace(strings.TrimPrefix(trimmedLine, funcPrefix))
+		// Skip the receiver of a Go method
+		if strings.HasPrefix(rest, "(") {
+			if i := strings.Index(rest, ")"); i != -1 {
+				rest = strings.TrimSpace(rest[i+1:])
+			}
+		}
+	}
+	end := strings.IndexFunc(rest, func(r rune) bool {
+		return !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+	})
+	if end == -1 {
+		end = len(rest)
+	}
+	return rest[:end]
+}
+
+// IndexDefinitions scans the files in the given directory that have the given extension, and returns the
+// locations of the functions that are defined with the given function prefix, by name.
+func IndexDefinitions(dir, ext, funcPrefix string) map[string][]Tag {
+	index := make(map[string][]Tag)
+	filenames, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+	if err != nil {
+		return index
+	}
+	for _, filename := range filenames {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			continue
+		}
+		for i, line := range strings.Split(string(data), "\n") {
+			if name := definitionName(line, funcPrefix); name != "" {
+				index[name] = append(index[name], Tag{name, filename, LineNumber(i + 1), ""})
+			}
+		}
+	}
+	return index
+}
+
+// TagLineIndex returns the line index of the given tag, searching the file for the pattern if needed
+func TagLineIndex(tag Tag) (LineIndex, error) {
+	if tag.Line > 0 {
+		return tag.Line.LineIndex(), nil
+	}
+	data, err := os.ReadFile(tag.Filename)
+	if err != nil {
+		return 0, err
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimRight(line, "\r") == tag.Pattern {
+			return LineIndex(i), nil
+		}
+	}
+	return 0, errNoTag
+}
+
+// TagGoToDefinition looks up the word under the cursor in the nearest tags file, or, if there is none,
+// in an index of the functions in the files in the same directory. If a definition is found, it is opened
+// with JumpTo, so that ctrl-b can go back. Returns true if it was possible to go to the definition.
+func (e *Editor) TagGoToDefinition(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) bool {
+	// Use the last part of words like package.Function
+	fields := strings.Split(e.WordAtCursor(), ".")
+	name := strings.Trim(fields[len(fields)-1], "-")
+	if name == "" {
+		return false
+	}
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return false
+	}
+	dir := filepath.Dir(absFilename)
+
+	var tags []Tag
+	if tagsFilename := FindTagsFile(dir); tagsFilename != "" {
+		tags, _ = LookupTags(tagsFilename, name)
+	}
+	if funcPrefix := e.FuncPrefix(); len(tags) == 0 && funcPrefix != "" {
+		tags = IndexDefinitions(dir, filepath.Ext(absFilename), funcPrefix)[name]
+	}
+
+	// Prefer definitions in the current file, then in the same directory
+	var found *Tag
+	for i, tag := range tags {
+		if tag.Filename == absFilename {
+			found = &tags[i]
+			break
+		}
+		if found == nil || (filepath.Dir(tag.Filename) == dir && filepath.Dir(found.Filename) != dir) {
+			found = &tags[i]
+		}
+	}
+	if found == nil {
+		return false
+	}
+	y, err := TagLineIndex(*found)
+	if err != nil {
+		return false
+	}
+	if !e.JumpTo(c, tty, status, found.Filename, y) {
+		return false
+	}
+	// Place the cursor at the name, if it is on the line
+	if x := strings.Index(e.Line(y), name); x != -1 {
+		e.setDataCursor(c, Cursor{len([]rune(e.Line(y)[:x])), y})
+		e.HorizontalScrollIfNeeded(c)
+	}
+	return true
+}
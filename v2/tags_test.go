@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookupTags(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "pkg", "sub")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tagsData := "!_TAG_FILE_FORMAT\t2\t/extended format/\n" +
+		"Hello\tpkg/hello.go\t/^func Hello() string {$/;\"\tf\n" +
+		"World\tpkg/world.go\t12;\"\tf\n" +
+		"Other\tpkg/other.go\t/^func Other(a \\/ b) {$/;\"\tf\tline:7\n"
+	if err := os.WriteFile(filepath.Join(dir, "tags"), []byte(tagsData), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pkg", "hello.go"), []byte("package pkg\n\nfunc Hello() string {\n\treturn \"hi\"\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tagsFilename := FindTagsFile(sub)
+	if tagsFilename != filepath.Join(dir, "tags") {
+		t.Fatalf("expected to find the tags file in a parent directory, got %q", tagsFilename)
+	}
+
+	tags, err := LookupTags(tagsFilename, "Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Filename != filepath.Join(dir, "pkg", "hello.go") || tags[0].Pattern != "func Hello() string {" {
+		t.Fatalf("unexpected tag: %+v", tags)
+	}
+	if y, err := TagLineIndex(tags[0]); err != nil || y != 2 {
+		t.Fatalf("expected line index 2, got %d (%v)", y, err)
+	}
+
+	if tags, err := LookupTags(tagsFilename, "World"); err != nil || tags[0].Line != 12 {
+		t.Fatalf("expected line 12, got %+v (%v)", tags, err)
+	}
+	if tags, err := LookupTags(tagsFilename, "Other"); err != nil || tags[0].Line != 7 || tags[0].Pattern != "func Other(a / b) {" {
+		t.Fatalf("expected line 7 from the extension field, got %+v (%v)", tags, err)
+	}
+	if _, err := LookupTags(tagsFilename, "Hell"); err != errNoTag {
+		t.Fatalf("expected no tag for a prefix of a name, got %v", err)
+	}
+}
+
+func TestIndexDefinitions(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte("package main\n\nfunc (e *Editor) Draw(c *Canvas) {\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.go"), []byte("package main\n\n// func Commented() {}\nfunc main() {\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	index := IndexDefinitions(dir, ".go", "func ")
+	if tags := index["Draw"]; len(tags) != 1 || tags[0].Line != 3 || filepath.Base(tags[0].Filename) != "a.go" {
+		t.Fatalf("expected the Draw method on line 3 of a.go, got %+v", tags)
+	}
+	if tags := index["main"]; len(tags) != 1 || tags[0].Line != 4 {
+		t.Fatalf("expected main on line 4, got %+v", tags)
+	}
+	if _, ok := index["Commented"]; ok {
+		t.Fatal("expected commented out functions to be skipped")
+	}
+	if name := definitionName("start(Args) ->", " ->"); name != "start" {
+		t.Fatalf("expected start, got %q", name)
+	}
+	if name := definitionName("    ok ->", " ->"); name != "" {
+		t.Fatalf("expected indented clauses to be skipped, got %q", name)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/xyproto/files"
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+var (
+	errNoTestUnderCursor = errors.New("no test function at the cursor")
+
+	// func TestX(t *testing.T), but also examples and fuzz tests, that go test -run can select
+	goTestFuncRegexp = regexp.MustCompile(`^func ((?:Test|Example|Fuzz)\w*)\(`)
+
+	// fn x(), pub fn x(), async fn x() and pub(crate) fn x()
+	rustFuncRegexp = regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:async\s+)?fn\s+(\w+)`)
+
+	// def test_x(...) and async def test_x(...)
+	pythonDefRegexp = regexp.MustCompile(`^\s*(?:async\s+)?def\s+(\w+)\s*\(`)
+)
+
+// testFunctionName finds the name of the test function that encloses the line with the given index,
+// by searching upwards for the closest function definition. Returns an empty string if that function is not a test.
+func testFunctionName(m mode.Mode, lines []string, y int) string {
+	if y >= len(lines) {
+		y = len(lines) - 1
+	}
+	for i := y; i >= 0; i-- {
+		line := lines[i]
+		switch m {
+		case mode.Go:
+			if !strings.HasPrefix(line, "func ") {
+				continue
+			}
+			if match := goTestFuncRegexp.FindStringSubmatch(line); match != nil {
+				return match[1]
+			}
+			return ""
+		case mode.Rust:
+			match := rustFuncRegexp.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			// Look for #[test] or #[tokio::test] among the attributes above the function
+			for j := i - 1; j >= 0; j-- {
+				attribute := strings.TrimSpace(lines[j])
+				if !strings.HasPrefix(attribute, "#[") {
+					break
+				}
+				if strings.Contains(attribute, "test]") || strings.Contains(attribute, "test(") {
+					return match[1]
+				}
+			}
+			return ""
+		case mode.Python:
+			match := pythonDefRegexp.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			if strings.HasPrefix(match[1], "test") {
+				return match[1]
+			}
+			return ""
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// TestUnderCursor returns the name of the test function that the cursor is in, or an empty string
+func (e *Editor) TestUnderCursor() string {
+	lines := make([]string, int(e.DataY())+1)
+	for i := range lines {
+		lines[i] = e.Line(LineIndex(i))
+	}
+	return testFunctionName(e.mode, lines, int(e.DataY()))
+}
+
+// CanRunTest checks if the current mode has support for running a single test
+func (e *Editor) CanRunTest() bool {
+	switch e.mode {
+	case mode.Go, mode.Rust, mode.Python:
+		return true
+	}
+	return false
+}
+
+// cargoDir returns the closest directory with a Cargo.toml file, searching upwards from the given directory.
+// Returns the given directory if no Cargo.toml file is found.
+func cargoDir(sourceDir string) string {
+	for dir := sourceDir; dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if files.IsFile(filepath.Join(dir, "Cargo.toml")) {
+			return dir
+		}
+	}
+	return sourceDir
+}
+
+// TestCommand creates a command that runs only the given test, for the given source file.
+// A test command in the project configuration file takes precedence, where {test} is replaced with the test name.
+func (e *Editor) TestCommand(sourceFilename, testName string) (*exec.Cmd, error) {
+	cfg, err := LoadProjectConfig(sourceFilename, e.mode)
+	if err != nil {
+		return nil, err
+	}
+	if cfg != nil && cfg.Test != "" {
+		return cfg.Command(strings.ReplaceAll(cfg.Test, "{test}", shellQuote(testName)), sourceFilename), nil
+	}
+	sourceDir := filepath.Dir(sourceFilename)
+	var cmd *exec.Cmd
+	switch e.mode {
+	case mode.Go:
+		cmd = exec.Command("go", "test", "-count=1", "-run", "^"+testName+"$", ".")
+		cmd.Dir = sourceDir
+	case mode.Rust:
+		cmd = exec.Command("cargo", "test", testName)
+		// Filenames in the output from cargo are relative to the directory of Cargo.toml
+		cmd.Dir = cargoDir(sourceDir)
+	case mode.Python:
+		cmd = exec.Command("pytest", "-k", testName, sourceFilename)
+		cmd.Dir = sourceDir
+	default:
+		return nil, errors.New("running a single test is not supported for " + e.mode.String())
+	}
+	return cmd, nil
+}
+
+// RunTestUnderCursor runs the test function that the cursor is in, in the background.
+// The output is shown in the output pane, and the failures are collected in the problems list.
+func (e *Editor) RunTestUnderCursor(c *vt100.Canvas, status *StatusBar) error {
+	testName := e.TestUnderCursor()
+	if testName == "" {
+		return errNoTestUnderCursor
+	}
+	sourceFilename, err := filepath.Abs(e.filename)
+	if err != nil {
+		return err
+	}
+	cmd, err := e.TestCommand(sourceFilename, testName)
+	if err != nil {
+		return err
+	}
+	if !e.startBuilding() {
+		return errors.New("already building")
+	}
+	status.ClearAll(c)
+	e.DrawOutput(c, 20, "", "Running "+testName+"...", e.DebugRegistersBackground, true)
+	go func() {
+		defer e.setBuilding(false)
+		output, err := cmd.CombinedOutput()
+		outputString := strings.TrimSpace(string(output))
+		SetProblems(ParseProblems(outputString, cmd.Dir), err != nil) // the key loop redraws the highlighted lines
+		title := testName + " passed"
+		background := e.DebugRunningBackground
+		if err != nil {
+			title = testName + " failed"
+			background = e.DebugStoppedBackground
+		}
+		if outputString == "" {
+			outputString = title
+		}
+		e.DrawOutput(c, 20, title, outputString, background, true)
+	}()
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+func TestTestFunctionName(t *testing.T) {
+	goSource := strings.Split("package main\n\nfunc TestAdd(t *testing.T) {\n\tif add(2, 2) != 4 {\n\t\tt.Fail()\n\t}\n}\n\nfunc add(a, b int) int {\n\treturn a + b\n}\n", "\n")
+	if name := testFunctionName(mode.Go, goSource, 4); name != "TestAdd" {
+		t.Fatalf("expected TestAdd, got %q", name)
+	}
+	if name := testFunctionName(mode.Go, goSource, 9); name != "" {
+		t.Fatalf("expected no test in a helper function, got %q", name)
+	}
+
+	rustSource := strings.Split("#[cfg(test)]\nmod tests {\n    #[test]\n    #[should_panic]\n    fn it_works() {\n        assert_eq!(2 + 2, 5);\n    }\n\n    fn helper() {}\n}\n", "\n")
+	if name := testFunctionName(mode.Rust, rustSource, 5); name != "it_works" {
+		t.Fatalf("expected it_works, got %q", name)
+	}
+	if name := testFunctionName(mode.Rust, rustSource, 8); name != "" {
+		t.Fatalf("expected no test in a function without #[test], got %q", name)
+	}
+
+	pythonSource := strings.Split("class TestMath:\n    def test_add(self):\n        assert 1 + 1 == 2\n", "\n")
+	if name := testFunctionName(mode.Python, pythonSource, 2); name != "test_add" {
+		t.Fatalf("expected test_add, got %q", name)
+	}
+}
+
+func TestRunSingleGoTest(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/single\n\ngo 1.21\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	testSource := "package single\n\nimport \"testing\"\n\nfunc TestPass(t *testing.T) {}\n\nfunc TestFail(t *testing.T) {\n\tt.Error(\"wrong answer\")\n}\n"
+	sourceFilename := filepath.Join(dir, "single_test.go")
+	if err := os.WriteFile(sourceFilename, []byte(testSource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewSimpleEditor(80)
+	e.mode = mode.Go
+	e.InsertStringAndMove(nil, testSource)
+	e.GoTo(7, nil, nil)
+	testName := e.TestUnderCursor()
+	if testName != "TestFail" {
+		t.Fatalf("expected TestFail, got %q", testName)
+	}
+
+	cmd, err := e.TestCommand(sourceFilename, testName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Env = append(os.Environ(), "GOFLAGS=")
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected the test to fail: %s", output)
+	}
+	found := ParseProblems(string(output), cmd.Dir)
+	if len(found) != 1 || found[0].Line != 8 || found[0].Message != "wrong answer" {
+		t.Fatalf("unexpected problems: %+v\n%s", found, output)
+	}
+
+	// Only the test under the cursor should have been run
+	cmd, _ = e.TestCommand(sourceFilename, "TestPass")
+	cmd.Env = append(os.Environ(), "GOFLAGS=")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("expected TestPass to pass: %s", output)
+	}
+}
@@ -47,6 +47,8 @@ type Theme struct {
 	HeaderBulletColor           vt100.AttributeColor
 	MultiLineString             vt100.AttributeColor
 	DebugInstructionsBackground vt100.AttributeColor
+	SelectionForeground         vt100.AttributeColor
+	SelectionBackground         vt100.AttributeColor
 	Git                         vt100.AttributeColor
 	MultiLineComment            vt100.AttributeColor
 	SearchHighlight             vt100.AttributeColor
@@ -176,6 +178,8 @@ func NewDefaultTheme() Theme {
 		DebugOutputBackground:       vt100.BackgroundGray,
 		DebugInstructionsForeground: vt100.LightYellow,
 		DebugInstructionsBackground: vt100.BackgroundMagenta,
+		SelectionForeground:         vt100.Black,
+		SelectionBackground:         vt100.BackgroundCyan,
 		BoxUpperEdge:                vt100.White,
 	}
 }
@@ -259,6 +263,8 @@ func NewSynthwaveTheme() Theme {
 		DebugOutputBackground:       vt100.BackgroundGray,
 		DebugInstructionsForeground: vt100.LightGray,
 		DebugInstructionsBackground: vt100.BackgroundRed,
+		SelectionForeground:         vt100.Black,
+		SelectionBackground:         vt100.BackgroundMagenta,
 		BoxUpperEdge:                vt100.White,
 	}
 }
@@ -342,6 +348,8 @@ func NewRedBlackTheme() Theme {
 		DebugOutputBackground:       vt100.BackgroundGray,
 		DebugInstructionsForeground: vt100.Red,
 		DebugInstructionsBackground: vt100.BackgroundGray,
+		SelectionForeground:         vt100.White,
+		SelectionBackground:         vt100.BackgroundRed,
 		BoxUpperEdge:                vt100.Black,
 	}
 }
@@ -425,6 +433,8 @@ func NewLightBlueEditTheme() Theme {
 		DebugOutputBackground:       vt100.BackgroundYellow,
 		DebugInstructionsForeground: vt100.LightYellow,
 		DebugInstructionsBackground: vt100.BackgroundCyan,
+		SelectionForeground:         vt100.Black,
+		SelectionBackground:         vt100.BackgroundCyan,
 		BoxUpperEdge:                vt100.White,
 	}
 }
@@ -508,6 +518,8 @@ func NewDarkBlueEditTheme() Theme {
 		DebugOutputBackground:       vt100.BackgroundGray,
 		DebugInstructionsForeground: vt100.White,
 		DebugInstructionsBackground: vt100.BackgroundGray,
+		SelectionForeground:         vt100.Black,
+		SelectionBackground:         vt100.BackgroundCyan,
 		BoxUpperEdge:                vt100.LightYellow,
 	}
 }
@@ -590,6 +602,8 @@ func NewLightVSTheme() Theme {
 		DebugOutputBackground:       vt100.BackgroundGray,
 		DebugInstructionsForeground: vt100.Black,
 		DebugInstructionsBackground: vt100.BackgroundGray,
+		SelectionForeground:         vt100.White,
+		SelectionBackground:         vt100.BackgroundBlue,
 		BoxUpperEdge:                vt100.Black,
 	}
 }
@@ -672,6 +686,8 @@ func NewDarkVSTheme() Theme {
 		DebugOutputBackground:       vt100.BackgroundGray,
 		DebugInstructionsForeground: vt100.Black,
 		DebugInstructionsBackground: vt100.BackgroundGray,
+		SelectionForeground:         vt100.Black,
+		SelectionBackground:         vt100.BackgroundCyan,
 		BoxUpperEdge:                vt100.Black,
 	}
 }
@@ -781,6 +797,8 @@ func NewNoColorDarkBackgroundTheme() Theme {
 		DebugOutputBackground:       vt100.BackgroundGray,
 		DebugInstructionsForeground: vt100.Black,
 		DebugInstructionsBackground: vt100.BackgroundGray,
+		SelectionForeground:         vt100.Black,
+		SelectionBackground:         vt100.BackgroundGray,
 		BoxUpperEdge:                vt100.Black,
 	}
 }
@@ -863,6 +881,8 @@ func NewNoColorLightBackgroundTheme() Theme {
 		DebugOutputBackground:       vt100.BackgroundGray,
 		DebugInstructionsForeground: vt100.White,
 		DebugInstructionsBackground: vt100.BackgroundGray,
+		SelectionForeground:         vt100.Black,
+		SelectionBackground:         vt100.BackgroundGray,
 		BoxUpperEdge:                vt100.White,
 	}
 }
@@ -3,46 +3,85 @@ package main
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 	"unsafe"
 )
 
-// Undo is a struct that can store several states of the editor and position
+// UndoStep is a single edit operation in the undo history.
+// The lines in removed were replaced by the lines in inserted, starting at the given line index.
+type UndoStep struct {
+	removed  [][]rune // the lines before the edit
+	inserted [][]rune // the lines after the edit
+	before   Position // the cursor position before the edit
+	after    Position // the cursor position after the edit
+	index    int      // the first line index that was changed
+}
+
+// undoNode is a state in the undo tree. The step leads from the parent state to this state.
+type undoNode struct {
+	parent   *undoNode
+	children []*undoNode // the most recently visited child is last, and is the one that redo leads to
+	step     UndoStep    // the edit operation from the parent state, empty for the root
+	time     time.Time   // when this state was created
+	id       int         // states are numbered in the order they are created
+}
+
+// UndoState describes a state in the undo tree, so that it can be presented to the user
+type UndoState struct {
+	Time    time.Time // when the state was created
+	Preview string    // the diff of the edit operation that led to this state, on one line
+	Diff    string    // the diff of the edit operation that led to this state, as a unified diff hunk
+	ID      int       // for jumping to this state with GoTo
+	Edits   int       // the number of edit operations from the oldest state
+	Current bool      // is this the current state?
+}
+
+// Undo is a tree of edit operations and cursor positions, for undo and redo.
+// Undoing and then making a new edit starts a new branch, the previous branch is kept.
 type Undo struct {
-	mut                  *sync.RWMutex
-	editorCopies         []Editor
-	editorLineCopies     []map[int][]rune
-	editorPositionCopies []Position
-	index                int
-	size                 int
-	maxMemoryUse         uint64 // can be <= 0 to not check for memory use
-	ignoreSnapshots      bool   // used when playing back macros
+	mut             *sync.RWMutex
+	root            *undoNode // the oldest state that is kept
+	current         *undoNode // the state at the time of the last snapshot
+	lines           Rope      // the lines at the time of the last snapshot
+	pos             Position  // the cursor position at the time of the last snapshot
+	size            int       // the maximum number of edit operations to store
+	count           int       // the current number of edit operations in the tree
+	nextID          int       // the id of the next state that is created
+	memoryUse       uint64    // the current memory use of the stored edit operations
+	maxMemoryUse    uint64    // can be <= 0 to not check for memory use
+	hasSnapshot     bool      // has a snapshot been taken?
+	ignoreSnapshots bool      // used when playing back macros
 }
 
 const (
-	// number of undo actions possible to store in the circular buffer
+	// number of undo actions possible to store
 	defaultUndoCount = 1024
 
-	// maximum amount of memory the undo buffers can use before re-using buffers, 0 to disable
-	defaultUndoMemory = 0 // 32 * 1024 * 1024
+	// maximum amount of memory the undo history can use before the oldest edit operations are dropped, 0 to disable
+	defaultUndoMemory = 32 * 1024 * 1024
 )
 
 var (
-	// Circular undo buffer with room for N actions, change false to true to check for too limit memory use
+	// Undo history with room for N actions
 	undo = NewUndo(defaultUndoCount, defaultUndoMemory)
 
 	// Save the contents of one switch.
 	// Used when switching between a .c or .cpp file to the corresponding .h file.
-	switchBuffer = NewUndo(1, defaultUndoMemory)
+	switchBuffer *Editor
 
 	// Save a copy of the undo stack when switching between files
 	switchUndoBackup = NewUndo(defaultUndoCount, defaultUndoMemory)
+
+	errNoSuchUndoState = errors.New("no such state in the undo history")
 )
 
-// NewUndo takes arguments that are only for initializing the undo buffers.
-// The *Position and *vt100.Canvas is used only as a default values for the elements in the undo buffers.
+// NewUndo takes the maximum number of edit operations to store, and the maximum memory use
 func NewUndo(size int, maxMemoryUse uint64) *Undo {
-	return &Undo{&sync.RWMutex{}, make([]Editor, size), make([]map[int][]rune, size), make([]Position, size), 0, size, maxMemoryUse, false}
+	root := &undoNode{time: time.Now()}
+	return &Undo{mut: &sync.RWMutex{}, root: root, current: root, nextID: 1, size: size, maxMemoryUse: maxMemoryUse}
 }
 
 // IgnoreSnapshots is used when playing back macros, to snapshot the macro playback as a whole instead
@@ -50,31 +89,169 @@ func (u *Undo) IgnoreSnapshots(b bool) {
 	u.ignoreSnapshots = b
 }
 
-func lineMapMemoryFootprint(m map[int][]rune) uint64 {
-	var sum uint64
-	for _, v := range m {
-		sum += uint64(cap(v))
+// MemoryFootprint returns how much memory one UndoStep is using
+func (step *UndoStep) MemoryFootprint() uint64 {
+	sum := uint64(unsafe.Sizeof(*step))
+	for _, lines := range [][][]rune{step.removed, step.inserted} {
+		for _, line := range lines {
+			sum += uint64(unsafe.Sizeof(line)) + uint64(len(line))*uint64(unsafe.Sizeof(rune(0)))
+		}
 	}
 	return sum
 }
 
-// MemoryFootprint returns how much memory one Undo struct is using
-// TODO: Check if the size of the slices that contains structs are correct
+// Diff returns the lines that were removed and inserted by the edit operation, as a unified diff hunk
+func (step *UndoStep) Diff() string {
+	toStrings := func(lines [][]rune) []string {
+		strs := make([]string, len(lines))
+		for i, line := range lines {
+			strs[i] = string(line)
+		}
+		return strs
+	}
+	return lineDiff(toStrings(step.removed), toStrings(step.inserted), LineNumber(step.index+1))
+}
+
+// Preview returns the diff of the edit operation on one line, like "line 12: -fmt.Println(x) +fmt.Println(y)".
+// At most two of the removed and inserted lines are included.
+func (step *UndoStep) Preview() string {
+	const maxLines = 2
+	var changed []string
+	for _, line := range strings.Split(step.Diff(), "\n") {
+		if !strings.HasPrefix(line, "-") && !strings.HasPrefix(line, "+") {
+			continue // the hunk header, or a line of context
+		}
+		if trimmed := strings.TrimSpace(line[1:]); trimmed != "" {
+			changed = append(changed, line[:1]+trimmed)
+		}
+	}
+	if len(changed) > maxLines {
+		changed = append(changed[:maxLines], "...")
+	}
+	return fmt.Sprintf("line %d: %s", step.index+1, strings.Join(changed, " "))
+}
+
+// MemoryFootprint returns how much memory the stored edit operations are using
 func (u *Undo) MemoryFootprint() uint64 {
-	var sum uint64
-	for _, m := range u.editorLineCopies {
-		sum += lineMapMemoryFootprint(m)
-	}
-	sum += uint64(unsafe.Sizeof(u.index))
-	sum += uint64(unsafe.Sizeof(u.size))
-	sum += uint64(unsafe.Sizeof(u.editorCopies))
-	sum += uint64(unsafe.Sizeof(u.editorPositionCopies))
-	sum += uint64(unsafe.Sizeof(u.mut))
-	sum += uint64(unsafe.Sizeof(u.maxMemoryUse))
-	return sum
+	u.mut.RLock()
+	defer u.mut.RUnlock()
+	return u.memoryUse
+}
+
+// subtreeSize returns the number of edit operations and the memory they use, for this state and all states after it
+func (n *undoNode) subtreeSize() (int, uint64) {
+	count, memoryUse := 1, n.step.MemoryFootprint()
+	for _, child := range n.children {
+		c, m := child.subtreeSize()
+		count += c
+		memoryUse += m
+	}
+	return count, memoryUse
+}
+
+// removeChild removes the given child state from the list of children
+func (n *undoNode) removeChild(child *undoNode) {
+	for i, c := range n.children {
+		if c == child {
+			n.children = append(n.children[:i:i], n.children[i+1:]...)
+			return
+		}
+	}
+}
+
+// visitChild makes the given child state the one that redo leads to
+func (n *undoNode) visitChild(child *undoNode) {
+	n.removeChild(child)
+	n.children = append(n.children, child)
+}
+
+// depth returns the number of edit operations from the root to this state
+func (n *undoNode) depth() int {
+	d := 0
+	for p := n.parent; p != nil; p = p.parent {
+		d++
+	}
+	return d
+}
+
+// find returns the state with the given id, in the subtree starting at this state, or nil
+func (n *undoNode) find(id int) *undoNode {
+	if n.id == id {
+		return n
+	}
+	for _, child := range n.children {
+		if found := child.find(id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// prune drops the oldest edit operations if there are too many or if they use too much memory.
+// Branches that are not leading to the current state are dropped first.
+// The most recent edit operation is always kept.
+func (u *Undo) prune() {
+	for u.count > 1 && (u.count > u.size || (u.maxMemoryUse > 0 && u.memoryUse > u.maxMemoryUse)) {
+		// Find the child of the root that leads to the current state
+		trunk := u.current
+		for trunk != nil && trunk.parent != u.root {
+			trunk = trunk.parent
+		}
+		// Find the oldest other branch from the root
+		var oldest *undoNode
+		for _, child := range u.root.children {
+			if child != trunk && (oldest == nil || child.id < oldest.id) {
+				oldest = child
+			}
+		}
+		if oldest != nil {
+			u.root.removeChild(oldest)
+			count, memoryUse := oldest.subtreeSize()
+			u.count -= count
+			u.memoryUse -= memoryUse
+			continue
+		}
+		if trunk == nil || trunk == u.current {
+			break
+		}
+		// Drop the oldest edit operation, so that the state after it becomes the oldest state
+		u.memoryUse -= trunk.step.MemoryFootprint()
+		u.count--
+		trunk.step = UndoStep{} // let the lines be garbage collected
+		trunk.parent = nil
+		u.root.children = nil
+		u.root = trunk
+	}
+}
+
+// commit records the changes since the last snapshot as a new state after the current one, if there are any changes.
+// If edit operations have been undone, this starts a new branch in the undo tree.
+func (u *Undo) commit(e *Editor) {
+	if !u.hasSnapshot {
+		return
+	}
+	index, removed, inserted, changed := DiffRopes(u.lines, e.lines)
+	if !changed {
+		return
+	}
+	n := &undoNode{parent: u.current, step: UndoStep{removed, inserted, u.pos, e.pos, index}, time: time.Now(), id: u.nextID}
+	u.nextID++
+	u.current.children = append(u.current.children, n)
+	u.current = n
+	u.count++
+	u.memoryUse += n.step.MemoryFootprint()
+	u.prune()
 }
 
-// Snapshot will store a snapshot, and move to the next position in the circular buffer
+// remember stores the current lines and cursor position, so that the next changes can be found
+func (u *Undo) remember(e *Editor) {
+	u.lines = e.lines
+	u.pos = e.pos
+	u.hasSnapshot = true
+}
+
+// Snapshot will record the changes since the previous snapshot as one edit operation,
+// and then remember the current state, so that the next edit can be undone
 func (u *Undo) Snapshot(e *Editor) {
 	if u.ignoreSnapshots {
 		return
@@ -83,92 +260,166 @@ func (u *Undo) Snapshot(e *Editor) {
 	u.mut.Lock()
 	defer u.mut.Unlock()
 
-	u.editorCopies[u.index] = *e
-	u.editorLineCopies[u.index] = e.CopyLines()
-	u.editorPositionCopies[u.index] = e.pos
+	u.commit(e)
+	u.remember(e)
+}
 
-	// Go forward 1 step in the circular buffer
-	u.index++
-	// Circular buffer wrap
-	if u.index >= u.size {
-		u.index = 0
-	}
+// back applies the edit operation that led to the current state backwards, and moves to the previous state
+func (u *Undo) back(e *Editor) {
+	n := u.current
+	e.lines.Splice(n.step.index, len(n.step.inserted), n.step.removed)
+	e.pos = n.step.before
+	e.changed = true
+	// Let redo lead back to this state
+	n.parent.visitChild(n)
+	u.current = n.parent
+}
 
-	// If the undo buffer uses too much memory, reduce the size to 10
-	if u.maxMemoryUse > 0 && u.MemoryFootprint() > u.maxMemoryUse {
-		newSize := 10
+// forward applies the edit operation that leads to the given child state, and moves to that state
+func (u *Undo) forward(e *Editor, child *undoNode) {
+	e.lines.Splice(child.step.index, len(child.step.removed), child.step.inserted)
+	e.pos = child.step.after
+	e.changed = true
+	u.current.visitChild(child)
+	u.current = child
+}
 
-		smallest := newSize
-		if u.size < smallest {
-			smallest = u.size
-		}
+// Restore will undo the most recent edit operation
+func (u *Undo) Restore(e *Editor) error {
+	u.mut.Lock()
+	defer u.mut.Unlock()
 
-		newUndo := NewUndo(newSize, u.maxMemoryUse)
-		newUndo.index = u.index
-		if newUndo.index >= newUndo.size {
-			newUndo.index = 0
-		}
-		newUndo.mut = u.mut
+	u.commit(e)
 
-		u.mut.Lock()
-		defer u.mut.Unlock()
+	if u.current.parent == nil {
+		return errors.New("nothing to undo")
+	}
 
-		// Copy over the contents to the new undo struct
-		offset := u.index
-		for i := 0; i < smallest; i++ {
-			copyFromPos := i + offset
-			if copyFromPos > u.size {
-				copyFromPos -= u.size
-			}
-			copyToPos := i
-			fmt.Println(copyFromPos, copyToPos)
+	u.back(e)
+	u.remember(e)
+	return nil
+}
 
-			newUndo.editorCopies[copyToPos] = u.editorCopies[copyFromPos]
-			newUndo.editorLineCopies[copyToPos] = u.editorLineCopies[copyFromPos]
-			newUndo.editorPositionCopies[copyToPos] = u.editorPositionCopies[copyFromPos]
-		}
+// Redo will apply the edit operation that was most recently undone
+func (u *Undo) Redo(e *Editor) error {
+	u.mut.Lock()
+	defer u.mut.Unlock()
 
-		// Replace the undo struct
-		*u = *newUndo
+	u.commit(e)
 
-		// Adjust the index after the size has been changed
-		if u.index >= u.size {
-			u.index = 0
-		}
+	if len(u.current.children) == 0 {
+		return errors.New("nothing to redo")
 	}
+
+	u.forward(e, u.current.children[len(u.current.children)-1])
+	u.remember(e)
+	return nil
 }
 
-// Restore will restore a previous snapshot, and move to the previous position in the circular buffer
-func (u *Undo) Restore(e *Editor) error {
+// GoTo will undo and redo edit operations until the editor is in the state with the given id,
+// which can be on a different branch of the undo tree
+func (u *Undo) GoTo(e *Editor, id int) error {
 	u.mut.Lock()
 	defer u.mut.Unlock()
 
-	// Go back 1 step in the circular buffer
-	u.index--
-	// Circular buffer wrap
-	if u.index < 0 {
-		u.index = u.size - 1
+	u.commit(e)
+
+	target := u.root.find(id)
+	if target == nil {
+		return errNoSuchUndoState
 	}
 
-	// Restore the state from this index, if there is something there
-	if lines := u.editorLineCopies[u.index]; len(lines) > 0 {
+	// Find the states from the target state and back to the root
+	var path []*undoNode
+	onPath := make(map[*undoNode]bool)
+	for n := target; n != nil; n = n.parent {
+		path = append(path, n)
+		onPath[n] = true
+	}
+
+	// Undo until reaching a state that the target state comes after
+	for !onPath[u.current] {
+		u.back(e)
+	}
+
+	// Then redo until reaching the target state
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i].parent == u.current {
+			u.forward(e, path[i])
+		}
+	}
 
-		*e = u.editorCopies[u.index]
-		e.lines = lines
-		e.pos = u.editorPositionCopies[u.index]
+	u.remember(e)
+	return nil
+}
 
-		return nil
+// state returns a description of the given state
+func (u *Undo) state(n *undoNode) UndoState {
+	preview, diff := "the oldest state", ""
+	if n.parent != nil {
+		preview, diff = n.step.Preview(), n.step.Diff()
 	}
-	return errors.New("no undo state at this index")
+	return UndoState{n.time, preview, diff, n.id, n.depth(), n == u.current}
+}
+
+// Branches returns the most recent state of every branch in the undo tree, the most recently created first
+func (u *Undo) Branches() []UndoState {
+	u.mut.RLock()
+	defer u.mut.RUnlock()
+
+	var tips []UndoState
+	var collect func(n *undoNode)
+	collect = func(n *undoNode) {
+		if len(n.children) == 0 {
+			tips = append(tips, u.state(n))
+		}
+		for _, child := range n.children {
+			collect(child)
+		}
+	}
+	collect(u.root)
+
+	sort.Slice(tips, func(i, j int) bool { return tips[i].ID > tips[j].ID })
+	return tips
+}
+
+// BranchStates returns the states from the state with the given id and back to the oldest state.
+// If there are more than maxStates states, only the most recent ones and the oldest state are returned.
+func (u *Undo) BranchStates(id, maxStates int) ([]UndoState, error) {
+	u.mut.RLock()
+	defer u.mut.RUnlock()
+
+	n := u.root.find(id)
+	if n == nil {
+		return nil, errNoSuchUndoState
+	}
+	var states []UndoState
+	for ; n != nil; n = n.parent {
+		if len(states) < maxStates-1 || n.parent == nil {
+			states = append(states, u.state(n))
+		}
+	}
+	return states, nil
+}
+
+// OnBranch checks if the current state is the state with the given id, or comes before it
+func (u *Undo) OnBranch(id int) bool {
+	u.mut.RLock()
+	defer u.mut.RUnlock()
+
+	return u.current.find(id) != nil
 }
 
-// Index will return the current undo index, in the undo buffers
-func (u *Undo) Index() int {
-	return u.index
+// CanRedo returns true if there are edit operations that can be redone
+func (u *Undo) CanRedo() bool {
+	u.mut.RLock()
+	defer u.mut.RUnlock()
+	return len(u.current.children) > 0
 }
 
-// Len will return the current number of stored undo snapshots.
-// This is the same as the index int that points to the next free slot.
+// Len will return the current number of edit operations that can be undone
 func (u *Undo) Len() int {
-	return u.index
+	u.mut.RLock()
+	defer u.mut.RUnlock()
+	return u.current.depth()
 }
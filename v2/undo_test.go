@@ -0,0 +1,126 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUndoRedo(t *testing.T) {
+	e := NewSimpleEditor(80)
+	u := NewUndo(defaultUndoCount, defaultUndoMemory)
+	u.Snapshot(e)
+	e.InsertStringAndMove(nil, "hello")
+	u.Snapshot(e)
+	e.InsertLineBelow()
+	e.Down(nil, nil)
+	e.InsertStringAndMove(nil, "world")
+	if e.String() != "hello\nworld\n" {
+		t.Fatalf("unexpected contents: %q", e.String())
+	}
+	if err := u.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	if e.String() != "hello\n" {
+		t.Fatalf("expected the second line to be undone, got: %q", e.String())
+	}
+	if err := u.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	if e.String() != "\n" {
+		t.Fatalf("expected an empty document, got: %q", e.String())
+	}
+	if err := u.Restore(e); err == nil {
+		t.Fatal("expected nothing more to undo")
+	}
+	if err := u.Redo(e); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Redo(e); err != nil {
+		t.Fatal(err)
+	}
+	if e.String() != "hello\nworld\n" {
+		t.Fatalf("expected both edits to be redone, got: %q", e.String())
+	}
+	if err := u.Redo(e); err == nil {
+		t.Fatal("expected nothing more to redo")
+	}
+}
+
+func TestUndoNewEditClearsRedo(t *testing.T) {
+	e := NewSimpleEditor(80)
+	u := NewUndo(defaultUndoCount, defaultUndoMemory)
+	u.Snapshot(e)
+	e.InsertStringAndMove(nil, "a")
+	u.Restore(e)
+	if !u.CanRedo() {
+		t.Fatal("expected to be able to redo")
+	}
+	u.Snapshot(e)
+	e.InsertStringAndMove(nil, "b")
+	u.Snapshot(e)
+	if u.CanRedo() {
+		t.Fatal("expected a new edit to clear the redo history")
+	}
+}
+
+func TestUndoMemoryLimit(t *testing.T) {
+	e := NewSimpleEditor(80)
+	u := NewUndo(defaultUndoCount, 1024)
+	for i := 0; i < 100; i++ {
+		u.Snapshot(e)
+		e.InsertStringAndMove(nil, "0123456789abcdef")
+		e.InsertLineBelow()
+		e.Down(nil, nil)
+	}
+	u.Snapshot(e)
+	if u.MemoryFootprint() > 1024 {
+		t.Fatalf("the undo history uses %d bytes, more than the limit", u.MemoryFootprint())
+	}
+	if u.Len() == 0 || u.Len() >= 100 {
+		t.Fatalf("expected some, but not all, edit operations to be kept, got %d", u.Len())
+	}
+}
+
+func TestUndoTreeBranches(t *testing.T) {
+	e := NewSimpleEditor(80)
+	u := NewUndo(defaultUndoCount, defaultUndoMemory)
+	u.Snapshot(e)
+	e.InsertStringAndMove(nil, "first")
+	u.Snapshot(e)
+	firstBranch := u.Branches()[0]
+
+	// Undo, then try a second approach, which starts a new branch
+	u.Restore(e)
+	u.Snapshot(e)
+	e.InsertStringAndMove(nil, "second")
+	u.Snapshot(e)
+
+	branches := u.Branches()
+	if len(branches) != 2 {
+		t.Fatalf("expected 2 branches, got %d", len(branches))
+	}
+	if branches[1].ID != firstBranch.ID || !u.OnBranch(branches[0].ID) || u.OnBranch(firstBranch.ID) {
+		t.Fatalf("expected the second branch to be the current and most recent one, got %v", branches)
+	}
+
+	// Jump back to the first approach
+	if err := u.GoTo(e, firstBranch.ID); err != nil {
+		t.Fatal(err)
+	}
+	if e.String() != "first\n" {
+		t.Fatalf("expected the first branch to be restored, got: %q", e.String())
+	}
+	if err := u.Restore(e); err != nil || e.String() != "\n" {
+		t.Fatalf("expected to be able to undo the first branch, got: %q", e.String())
+	}
+	if err := u.Redo(e); err != nil || e.String() != "first\n" {
+		t.Fatalf("expected redo to follow the first branch, got: %q", e.String())
+	}
+
+	states, err := u.BranchStates(branches[0].ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 || states[1].Edits != 0 || states[0].Preview != "line 1: +second" || states[0].Diff != "@@ -1,0 +1,1 @@\n+second\n" {
+		t.Fatalf("unexpected states on the second branch: %v", states)
+	}
+}
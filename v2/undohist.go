@@ -0,0 +1,237 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// undoHistoryDir is where the undo history is stored, one file per absolute filename
+var undoHistoryDir = filepath.Join(userCacheDir, "o", "undo")
+
+var (
+	// errUndoHistoryMismatch is returned when the file has changed since the undo history was saved
+	errUndoHistoryMismatch = errors.New("the file has changed since the undo history was saved")
+
+	// errUndoHistoryCorrupt is returned when the saved undo history does not form a tree
+	errUndoHistoryCorrupt = errors.New("the saved undo history is corrupt")
+)
+
+// savedPosition is the on-disk representation of a Position
+type savedPosition struct {
+	SX, SY, OffsetX, OffsetY, ScrollSpeed, SavedX int
+}
+
+// savedUndoStep is the on-disk representation of an UndoStep
+type savedUndoStep struct {
+	Removed  []string
+	Inserted []string
+	Before   savedPosition
+	After    savedPosition
+	Index    int
+}
+
+// savedUndoState is the on-disk representation of a state in the undo tree.
+// Parent is the index of the parent state, or -1 for the oldest state.
+type savedUndoState struct {
+	Time   time.Time
+	Step   savedUndoStep
+	Parent int
+	ID     int
+}
+
+// savedUndoHistory is the on-disk representation of the undo history for one file.
+// The states are stored so that parents come before their children.
+// Hash is the hash of the file contents of the current state.
+type savedUndoHistory struct {
+	Hash    string
+	States  []savedUndoState
+	Current int
+}
+
+// undoHistoryFilename returns the filename for storing the undo history of the given absolute filename
+func undoHistoryFilename(absFilename string) string {
+	hash := sha256.Sum256([]byte(absFilename))
+	return filepath.Join(undoHistoryDir, hex.EncodeToString(hash[:]))
+}
+
+// contentHash returns a hash of the given editor contents
+func contentHash(e *Editor) string {
+	hash := sha256.Sum256([]byte(e.String()))
+	return hex.EncodeToString(hash[:])
+}
+
+func toSavedPosition(p Position) savedPosition {
+	return savedPosition{p.sx, p.sy, p.offsetX, p.offsetY, p.scrollSpeed, p.savedX}
+}
+
+func (p savedPosition) Position() Position {
+	return Position{p.SX, p.SY, p.OffsetX, p.OffsetY, p.ScrollSpeed, p.SavedX}
+}
+
+func toRuneLines(lines []string) [][]rune {
+	runeLines := make([][]rune, len(lines))
+	for i, line := range lines {
+		runeLines[i] = []rune(line)
+	}
+	return runeLines
+}
+
+func toStringLines(lines [][]rune) []string {
+	stringLines := make([]string, len(lines))
+	for i, line := range lines {
+		stringLines[i] = string(line)
+	}
+	return stringLines
+}
+
+func toSavedUndoStep(step UndoStep) savedUndoStep {
+	return savedUndoStep{toStringLines(step.removed), toStringLines(step.inserted), toSavedPosition(step.before), toSavedPosition(step.after), step.index}
+}
+
+func (s savedUndoStep) UndoStep() UndoStep {
+	return UndoStep{toRuneLines(s.Removed), toRuneLines(s.Inserted), s.Before.Position(), s.After.Position(), s.Index}
+}
+
+// toSavedUndoStates returns all states in the undo tree, with parents before children,
+// and the index of the current state
+func (u *Undo) toSavedUndoStates() ([]savedUndoState, int) {
+	var (
+		states  []savedUndoState
+		current int
+	)
+	var collect func(n *undoNode, parent int)
+	collect = func(n *undoNode, parent int) {
+		index := len(states)
+		if n == u.current {
+			current = index
+		}
+		states = append(states, savedUndoState{n.time, toSavedUndoStep(n.step), parent, n.id})
+		for _, child := range n.children {
+			collect(child, index)
+		}
+	}
+	collect(u.root, -1)
+	return states, current
+}
+
+// SaveHistory writes the undo history for the given editor to the cache directory.
+// If the editor contents differ from the file on disk (if the editor is closed without saving),
+// a final undo step is added that goes from the editor contents to the file contents,
+// so that the unsaved changes can be brought back with undo.
+func (u *Undo) SaveHistory(e *Editor, absFilename string) error {
+	if noWriteToCache || !ShouldKeep(absFilename) {
+		return nil
+	}
+
+	// Read the file in the same way as it will be read the next time it is opened
+	onDisk := NewSimpleEditor(e.wrapWidth)
+	if err := onDisk.ReadFileAndProcessLines(absFilename); err != nil {
+		return err
+	}
+
+	u.mut.Lock()
+	u.commit(e)
+	states, current := u.toSavedUndoStates()
+	nextID := u.nextID
+	u.mut.Unlock()
+
+	if index, removed, inserted, changed := DiffRopes(e.lines, onDisk.lines); changed && e.changed {
+		step := UndoStep{removed, inserted, e.pos, e.pos, index}
+		states = append(states, savedUndoState{time.Now(), toSavedUndoStep(step), current, nextID})
+		current = len(states) - 1
+	}
+
+	filename := undoHistoryFilename(absFilename)
+	if len(states) <= 1 {
+		// Nothing to save, remove any previously saved undo history
+		os.Remove(filename)
+		return nil
+	}
+
+	// First create the folder, if needed, in a best effort attempt
+	os.MkdirAll(undoHistoryDir, os.ModePerm)
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	history := savedUndoHistory{contentHash(onDisk), states, current}
+	if err := gob.NewEncoder(gz).Encode(history); err != nil {
+		gz.Close()
+		return err
+	}
+	return gz.Close()
+}
+
+// LoadHistory reads the undo history for the given editor from the cache directory.
+// If the file has changed since the undo history was saved, the undo history is thrown away.
+func (u *Undo) LoadHistory(e *Editor, absFilename string) error {
+	filename := undoHistoryFilename(absFilename)
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	var history savedUndoHistory
+	if err := gob.NewDecoder(gz).Decode(&history); err != nil {
+		return err
+	}
+
+	if history.Hash != contentHash(e) {
+		if !noWriteToCache {
+			os.Remove(filename)
+		}
+		return errUndoHistoryMismatch
+	}
+
+	if history.Current < 0 || history.Current >= len(history.States) {
+		return errUndoHistoryCorrupt
+	}
+
+	// Build the undo tree
+	nodes := make([]*undoNode, len(history.States))
+	for i, s := range history.States {
+		if s.Parent >= i || (s.Parent < 0) != (i == 0) {
+			return errUndoHistoryCorrupt
+		}
+		nodes[i] = &undoNode{time: s.Time, id: s.ID}
+		if i > 0 {
+			nodes[i].step = s.Step.UndoStep()
+			nodes[i].parent = nodes[s.Parent]
+			nodes[s.Parent].children = append(nodes[s.Parent].children, nodes[i])
+		}
+	}
+
+	u.mut.Lock()
+	defer u.mut.Unlock()
+
+	u.root = nodes[0]
+	u.current = nodes[history.Current]
+	u.count = len(nodes) - 1
+	u.nextID = 0
+	u.memoryUse = 0
+	for i, n := range nodes {
+		u.nextID = max(u.nextID, n.id+1)
+		if i > 0 {
+			u.memoryUse += n.step.MemoryFootprint()
+		}
+	}
+	u.remember(e)
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUndoHistory(t *testing.T) {
+	tempDir := t.TempDir()
+	oldUndoHistoryDir := undoHistoryDir
+	undoHistoryDir = filepath.Join(tempDir, "undo")
+	t.Cleanup(func() {
+		undoHistoryDir = oldUndoHistoryDir
+	})
+	filename := filepath.Join(tempDir, "hello.txt")
+	if err := os.WriteFile(filename, []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Edit the file, but quit without saving
+	e := NewSimpleEditor(80)
+	if err := e.ReadFileAndProcessLines(filename); err != nil {
+		t.Fatal(err)
+	}
+	u := NewUndo(defaultUndoCount, defaultUndoMemory)
+	u.Snapshot(e)
+	e.InsertStringAndMove(nil, "well, ")
+	if err := u.SaveHistory(e, filename); err != nil {
+		t.Fatal(err)
+	}
+
+	// Open the file again, and undo to get the unsaved changes back
+	e2 := NewSimpleEditor(80)
+	if err := e2.ReadFileAndProcessLines(filename); err != nil {
+		t.Fatal(err)
+	}
+	original := e2.String()
+	u2 := NewUndo(defaultUndoCount, defaultUndoMemory)
+	if err := u2.LoadHistory(e2, filename); err != nil {
+		t.Fatal(err)
+	}
+	if err := u2.Restore(e2); err != nil {
+		t.Fatal(err)
+	}
+	if e2.String() != "well, "+original {
+		t.Fatalf("expected the unsaved changes to be restored, got: %q", e2.String())
+	}
+	if err := u2.Restore(e2); err != nil {
+		t.Fatal(err)
+	}
+	if e2.String() != original {
+		t.Fatalf("expected the original contents, got: %q", e2.String())
+	}
+
+	// Change the file outside of the editor, then the undo history should be thrown away
+	if err := os.WriteFile(filename, []byte("changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e3 := NewSimpleEditor(80)
+	if err := e3.ReadFileAndProcessLines(filename); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewUndo(defaultUndoCount, defaultUndoMemory).LoadHistory(e3, filename); err != errUndoHistoryMismatch {
+		t.Fatalf("expected the undo history to be thrown away, got: %v", err)
+	}
+}
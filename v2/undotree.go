@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xyproto/vt100"
+)
+
+// formatUndoTime formats the time when an undo state was created, with the date only if it is not today
+func formatUndoTime(t time.Time) string {
+	if now := time.Now(); t.YearDay() == now.YearDay() && t.Year() == now.Year() {
+		return t.Format("15:04:05")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// UndoTreeMenu lets the user select a branch of the undo tree, and then a state on that branch to jump to
+func (e *Editor) UndoTreeMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, undo *Undo) {
+	// Make room for the menu title and margins
+	maxStates := 20
+	if c != nil && int(c.H())-6 > 3 {
+		maxStates = int(c.H()) - 6
+	}
+
+	branches := undo.Branches()
+	if len(branches) > maxStates {
+		branches = branches[:maxStates]
+	}
+
+	// Select a branch, if there is more than one
+	tip := branches[0]
+	if len(branches) > 1 {
+		var (
+			menuChoices  = make([]string, len(branches))
+			useMenuIndex int
+		)
+		for i, branch := range branches {
+			menuChoices[i] = fmt.Sprintf("%s, %d edits, %s", formatUndoTime(branch.Time), branch.Edits, branch.Preview)
+			if undo.OnBranch(branch.ID) {
+				menuChoices[i] += " (current)"
+				useMenuIndex = i
+			}
+		}
+		selected := e.Menu(status, tty, "Select an undo branch", menuChoices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, useMenuIndex, false)
+		if selected < 0 {
+			return
+		}
+		tip = branches[selected]
+	}
+
+	// Select a state on the branch
+	states, err := undo.BranchStates(tip.ID, maxStates)
+	if err != nil {
+		status.SetError(err)
+		status.Show(c, e)
+		return
+	}
+	var (
+		menuChoices  = make([]string, len(states))
+		useMenuIndex int
+	)
+	for i, state := range states {
+		menuChoices[i] = fmt.Sprintf("%s, %s", formatUndoTime(state.Time), state.Preview)
+		if state.Current {
+			menuChoices[i] += " (current)"
+			useMenuIndex = i
+		}
+	}
+	selected := e.Menu(status, tty, "Jump to an earlier state", menuChoices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, useMenuIndex, false)
+	if selected < 0 {
+		return
+	}
+
+	// Show the removed and inserted lines of the edit that led to the selected state, and ask the user
+	if diff := states[selected].Diff; diff != "" && !states[selected].Current {
+		e.DrawOutput(c, 20, "The edit that led to this state", strings.ReplaceAll(strings.TrimRight(diff, "\n"), "\t", "    "), e.DebugRunningBackground, true)
+		status.ClearAll(c)
+		status.SetMessage("Jump to this state? (y/n)")
+		status.ShowNoTimeout(c, e)
+	ASK:
+		for {
+			switch tty.String() {
+			case "y", "Y", "c:13":
+				break ASK
+			case "n", "N", "q", "Q", "c:27", "c:17":
+				status.ClearAll(c)
+				e.redraw = true
+				return
+			}
+		}
+	}
+
+	if err := undo.GoTo(e, states[selected].ID); err != nil {
+		status.SetError(err)
+		status.Show(c, e)
+		return
+	}
+	e.redraw = true
+	e.redrawCursor = true
+	status.SetMessageAfterRedraw("Jumped to the state from " + formatUndoTime(states[selected].Time))
+}